@@ -26,6 +26,131 @@ const parseQuery = (rawQuery) => {
   return { cleanedQuery, flags };
 };
 
+// Type-directed search over the signature index, mirrors wgsl/signature.go:
+// `vec3<f32>, f32 -> f32` finds functions taking at least these parameters,
+// in any order. `_` and single uppercase letters are type variables.
+const predeclaredAliases = {};
+for (const [suffix, scalar] of Object.entries({ f: "f32", h: "f16", i: "i32", u: "u32" })) {
+  for (let n = 2; n <= 4; n++) {
+    predeclaredAliases[`vec${n}${suffix}`] = `vec${n}<${scalar}>`;
+  }
+  if (suffix !== "f" && suffix !== "h") continue;
+  for (let c = 2; c <= 4; c++) {
+    for (let r = 2; r <= 4; r++) {
+      predeclaredAliases[`mat${c}x${r}${suffix}`] = `mat${c}x${r}<${scalar}>`;
+    }
+  }
+}
+
+const removePath = (ident) => ident.trim().split("::").at(-1);
+
+const splitParams = (s) => {
+  if (!s.trim()) return [];
+  const parts = [];
+  let current = "";
+  let depth = 0;
+  for (const char of s) {
+    if (char === "<") depth++;
+    if (char === ">") depth--;
+    if (char === "," && depth === 0) {
+      parts.push(current.trim());
+      current = "";
+      continue;
+    }
+    current += char;
+  }
+  parts.push(current.trim());
+  return parts;
+};
+
+const splitTemplateType = (typ) => {
+  typ = typ.trim();
+  const open = typ.indexOf("<");
+  if (open === -1 || !typ.endsWith(">")) return [removePath(typ), []];
+  return [removePath(typ.slice(0, open)), splitParams(typ.slice(open + 1, -1))];
+};
+
+const normalizeTypeAlias = (typ) => {
+  typ = typ.trim();
+  if (predeclaredAliases[typ]) return predeclaredAliases[typ];
+  const [name, args] = splitTemplateType(typ);
+  if (!args.length) return typ;
+  return `${name}<${args.map(normalizeTypeAlias).join(", ")}>`;
+};
+
+const normalizeSignatureType = (typ) =>
+  normalizeTypeAlias(typ.replace(/[A-Za-z_]\w*(?:::[A-Za-z_]\w*)*/g, removePath));
+
+const parseSignatureQuery = (query) => {
+  const [params, returnType = ""] = query.split("->");
+  return {
+    params: splitParams(params).map(normalizeSignatureType),
+    returnType: normalizeSignatureType(returnType),
+  };
+};
+
+const matchType = (pattern, typ, vars) => {
+  if (pattern === "_") return true;
+  if (/^[A-Z]$/.test(pattern)) {
+    if (pattern in vars) return vars[pattern] === typ;
+    vars[pattern] = typ;
+    return true;
+  }
+
+  const [patternName, patternArgs] = splitTemplateType(pattern);
+  const [name, args] = splitTemplateType(typ);
+  if (patternName !== name) return false;
+  if (!patternArgs.length) return true;
+  if (patternArgs.length !== args.length) return false;
+  return patternArgs.every((arg, i) => matchType(arg, args[i], vars));
+};
+
+const assignParams = (patterns, params, used, vars) => {
+  if (!patterns.length) return [];
+
+  for (let i = 0; i < params.length; i++) {
+    if (used[i]) continue;
+
+    const attempt = { ...vars };
+    if (!matchType(patterns[0], params[i], attempt)) continue;
+
+    used[i] = true;
+    const rest = assignParams(patterns.slice(1), params, used, attempt);
+    used[i] = false;
+
+    if (rest) {
+      Object.assign(vars, attempt);
+      return [i, ...rest];
+    }
+  }
+
+  return null;
+};
+
+const searchSignatures = (index, query) => {
+  const { params, returnType } = parseSignatureQuery(query);
+  const matches = [];
+
+  for (const entry of index) {
+    if (params.length > entry.params.length) continue;
+
+    const vars = {};
+    if (returnType && !matchType(returnType, entry.returnType, vars)) continue;
+
+    const assignment = assignParams(params, entry.params, [], vars);
+    if (!assignment) continue;
+
+    let penalty = 2 * (entry.params.length - params.length);
+    if (assignment.some((v, i) => i > 0 && v < assignment[i - 1])) penalty++;
+    penalty += entry.rankPenalty ?? 0;
+    matches.push({ item: entry, penalty });
+  }
+
+  return matches.sort(
+    (a, b) => a.penalty - b.penalty || a.item.name.localeCompare(b.item.name),
+  );
+};
+
 document.addEventListener("keydown", (event) => {
   if (event.key === "Escape") {
     document.activeElement.blur();
@@ -43,9 +168,17 @@ document.addEventListener("keydown", (event) => {
   }
 });
 
-fetch(`/public/search-info-${version}.json`)
-  .then((res) => res.json())
-  .then(async (shadersFunctions) => {
+Promise.all([
+  fetch(`/public/search-info-${version}.json`).then((res) => res.json()),
+  // signature search is optional, a missing index leaves name search working
+  fetch(`/public/signature-index-${version}.json`)
+    .then((res) => res.json())
+    .catch((error) => {
+      console.warn("Signature index unavailable:", error);
+      return [];
+    }),
+])
+  .then(async ([shadersFunctions, signatureIndex]) => {
     const input = document.getElementById("search-input");
     const resultsContainer = document.getElementById("results");
 
@@ -63,6 +196,10 @@ fetch(`/public/search-info-${version}.json`)
       query = query.trim();
       if (!query) return [];
 
+      if (query.includes("->")) {
+        return searchSignatures(signatureIndex, query).slice(0, 10);
+      }
+
       const { cleanedQuery, flags } = parseQuery(query);
 
       let filteredData = shadersFunctions;
@@ -73,7 +210,11 @@ fetch(`/public/search-info-${version}.json`)
       }
 
       const fuse = new Fuse(filteredData, fuseOptions);
-      return fuse.search(cleanedQuery).slice(0, 10);
+      // stable sort, deprecated items keep their relative order at the end
+      return fuse
+        .search(cleanedQuery)
+        .sort((a, b) => !!a.item.deprecated - !!b.item.deprecated)
+        .slice(0, 10);
     }
 
     const search = currentUrl.searchParams.get("search") ?? "";
@@ -0,0 +1,27 @@
+// Sorts a table by the clicked header. Cells with a data-value sort
+// numerically, clicking the same header again reverses the order.
+document.addEventListener("click", (event) => {
+  const header = event.target.closest("th[data-sort]");
+  if (!header) return;
+
+  const table = header.closest("table");
+  const tbody = table.querySelector("tbody");
+  const column = Array.from(header.parentNode.children).indexOf(header);
+  const descending = header.dataset.order !== "desc";
+
+  table.querySelectorAll("th[data-sort]").forEach((th) => delete th.dataset.order);
+  header.dataset.order = descending ? "desc" : "asc";
+
+  const value = (row) => {
+    const cell = row.children[column];
+    return cell.dataset.value !== undefined ? Number(cell.dataset.value) : cell.textContent.trim();
+  };
+
+  const rows = Array.from(tbody.rows).sort((a, b) => {
+    const [x, y] = [value(a), value(b)];
+    const order = typeof x === "number" ? x - y : x.localeCompare(y);
+    return descending ? -order : order;
+  });
+
+  tbody.append(...rows);
+});
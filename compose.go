@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	config "main/config"
+	utils "main/utils"
+	wgsl "main/wgsl"
+)
+
+// flattens a file and its imports into one WGSL source, the way naga_oil
+// hands it to naga
+func runCompose(config config.Config) {
+	if config.File == "" {
+		log.Fatal("Error: 'file' is a required argument for compose")
+	}
+
+	registry := parseProject(config, getWgslFilesList(config))
+
+	file := findSourceFile(registry, config.File)
+	if file == nil {
+		log.Fatalf("Error: '%s' is not part of the source tree", config.File)
+	}
+
+	composed, err := registry.Compose(file, config.EntryPoint, wgsl.ParseShaderDefs(config.ShaderDefs))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if config.SourceMap != "" {
+		sourceMapJSON, err := json.MarshalIndent(composed, "", "  ")
+		if err != nil {
+			log.Fatal("Error marshaling source map:", err)
+		}
+
+		err = os.WriteFile(config.SourceMap, sourceMapJSON, 0644)
+		if err != nil {
+			log.Fatal("Error writing source map:", err)
+		}
+	}
+
+	if config.Out == "" {
+		fmt.Print(composed.Source)
+		return
+	}
+
+	err = os.WriteFile(config.Out, []byte(composed.Source), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// renders the composed shader of every entry point without shader defs, next
+// to the page of its file, e.g. crates/bevy_pbr/render/pbr/composed/fragment.html
+func writeComposedViews(registry *wgsl.ModuleRegistry, config config.Config, versionedOutput string) {
+	for _, file := range registry.Files {
+		if file.Language != wgsl.LanguageWGSL {
+			continue
+		}
+
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			if fn.StageAttribute == "" {
+				continue
+			}
+
+			composed, err := registry.Compose(file, fn.Name, map[string]string{})
+			if err != nil {
+				log.Printf("⚠️ Skipping composed view of %s::%s: %v", file.ModuleName(), fn.Name, err)
+				continue
+			}
+
+			composedPath := filepath.Join(strings.TrimSuffix(file.WgslPath, ".html"), "composed", fn.Name+".html")
+			outputPath := strings.ReplaceAll(filepath.Join(versionedOutput, composedPath), "src/", "")
+
+			err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			lines := wgsl.HighlightSource(strings.TrimSuffix(composed.Source, "\n"), 1)
+			rows := make([]map[string]interface{}, len(lines))
+			for j, line := range lines {
+				rows[j] = map[string]interface{}{
+					"html":    line.Html,
+					"mapping": composed.SourceMap[j],
+				}
+			}
+
+			modules := make(map[string]bool)
+			for _, mapping := range composed.SourceMap {
+				if mapping.Module != "" {
+					modules[mapping.Module] = true
+				}
+			}
+			moduleNames := make([]string, 0, len(modules))
+			for module := range modules {
+				moduleNames = append(moduleNames, module)
+			}
+			sort.Strings(moduleNames)
+
+			renderTemplateToFile(COMPOSED_TEMPLATE_SOURCE, map[string]interface{}{
+				"version":    config.Version,
+				"filename":   file.Filename,
+				"entryPoint": fn.Name,
+				"fileLink":   utils.NormalizeLink(file.Link) + "#" + fn.Name,
+				"modules":    moduleNames,
+				"rows":       rows,
+			}, outputPath)
+
+			fn.ComposedLink = utils.NormalizeLink(filepath.Join(config.Version, composedPath))
+		}
+	}
+}
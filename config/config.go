@@ -4,35 +4,111 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+
+	utils "main/utils"
+)
+
+const (
+	CommandDocs    = "docs"
+	CommandRustgen = "rustgen"
+	CommandCompose = "compose"
+	CommandSearch  = "search"
 )
 
 type Config struct {
+	// subcommand given as the first argument, defaults to docs
+	Command         string
 	SourcePath      string
 	FileFilter      string
 	OutputDir       string
 	SourceGithubURL string
+	Repository      string
 	Version         string
+	SpecTable       string
+	HtmlAllowlist   string
+	Reflection      bool
+	Composed        bool
+
+	// rustgen and compose
+	File       string
+	EntryPoint string
+	Visibility string
+	Out        string
+	ShaderDefs string
+	SourceMap  string
+
+	// search
+	Query string
 }
 
 func GetConfig() Config {
 	sourcePath := flag.String("source", "", "Source file path")
-	fileFilter := flag.String("filter", "*.wgsl", "Source file filter")
+	fileFilter := flag.String("filter", "*.wgsl,*.wesl,*.glsl,*.vert,*.frag,*.comp", "Comma separated source file patterns")
 	outputDir := flag.String("outputDir", "./dist", "Output directory")
 	sourceGithubURL := flag.String("sourceGithubURL", "https://github.com/bevyengine/bevy/tree/release-0.15.0/", "sourceGithubURL")
+	repository := flag.String("repository", "", "GitHub repository linked by issue references such as #1234, defaults to the one of sourceGithubURL")
 	version := flag.String("version", "0.15.0", "version")
+	reflection := flag.Bool("reflection", false, "Export pipeline reflection JSON for every entry point")
+	specTable := flag.String("specTable", "", "Path to a WGSL spec reference table overriding the bundled one")
+	htmlAllowlist := flag.String("htmlAllowlist", "", "Path to an HTML allowlist for comment markup overriding the bundled one")
+	composed := flag.Bool("composed", false, "Generate a composed view page for every entry point")
+
+	file := flag.String("file", "", "rustgen: WGSL file to generate bind group layouts for")
+	entryPoint := flag.String("entryPoint", "", "rustgen: limit generation to the bindings used by this entry point")
+	visibility := flag.String("visibility", "", "rustgen: comma separated shader stages, defaults to the entry point stage or vertex,fragment")
+	out := flag.String("out", "", "rustgen, compose: output file, defaults to stdout")
+	shaderDefs := flag.String("defs", "", "compose: comma separated shader defs, e.g. MULTISAMPLED,MAX_LIGHTS=8")
+	sourceMap := flag.String("sourceMap", "", "compose: write the source map of the composed shader to this JSON file")
+	query := flag.String("query", "", "search: function signature, e.g. 'vec3<f32>, vec3<f32> -> f32'")
+
+	command := CommandDocs
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
 
-	flag.Parse()
+	flag.CommandLine.Parse(args)
+
+	switch command {
+	case CommandDocs, CommandRustgen, CommandCompose, CommandSearch:
+	default:
+		log.Fatalf("Error: unknown command '%s'", command)
+	}
 
 	if *sourcePath == "" {
 		log.Fatal("Error: 'source' is a required argument")
 	}
 
 	config := Config{
+		Command:         command,
 		SourcePath:      *sourcePath,
 		FileFilter:      *fileFilter,
 		OutputDir:       *outputDir,
 		SourceGithubURL: *sourceGithubURL,
+		Repository:      *repository,
 		Version:         *version,
+		SpecTable:       *specTable,
+		HtmlAllowlist:   *htmlAllowlist,
+		Reflection:      *reflection,
+		Composed:        *composed,
+		File:            *file,
+		EntryPoint:      *entryPoint,
+		Visibility:      *visibility,
+		Out:             *out,
+		ShaderDefs:      *shaderDefs,
+		SourceMap:       *sourceMap,
+		Query:           *query,
+	}
+
+	if config.Repository == "" {
+		config.Repository = utils.RepositoryURL(config.SourceGithubURL)
+	}
+
+	if config.Command != CommandDocs {
+		return config
 	}
 
 	fmt.Println("🚀 Starting WGSL Documentation Generator")
@@ -42,6 +118,12 @@ func GetConfig() Config {
 	fmt.Printf("📁 Output Directory     : %s\n", config.OutputDir)
 	fmt.Printf("🌐 GitHub Source URL    : %s\n", config.SourceGithubURL)
 	fmt.Printf("🏷️ Documentation Version: %s\n", config.Version)
+	if config.Reflection {
+		fmt.Printf("🧬 Pipeline Reflection  : enabled\n")
+	}
+	if config.Composed {
+		fmt.Printf("🧩 Composed Views       : enabled\n")
+	}
 	fmt.Println("========================================")
 
 	return config
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"path/filepath"
+
+	config "main/config"
+	wgsl "main/wgsl"
+)
+
+// renders the per version report of near-duplicate functions
+func writeDuplicatesReport(pairs []wgsl.DuplicatePair, config config.Config, versionedOutput string) {
+	renderTemplateToFile(DUPLICATES_TEMPLATE_SOURCE, map[string]interface{}{
+		"version":   config.Version,
+		"threshold": wgsl.DuplicateSimilarityThreshold,
+		"pairs":     pairs,
+	}, filepath.Join(versionedOutput, "duplicates.html"))
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -19,6 +20,9 @@ import (
 	progressbar "github.com/schollz/progressbar/v3"
 )
 
+// markdown links, search results show their text only
+var markdownLinkPattern = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+
 var copyToPublic = []string{
 	"assets/styles.css",
 	"assets/favicon.ico",
@@ -32,26 +36,77 @@ var copyToPublic = []string{
 	"templates/search-result.hbs",
 	"assets/info-dark.png",
 	"assets/info-light.png",
+	"assets/pipeline-reflection.schema.json",
+	"assets/sort-table.js",
 }
 
 func main() {
 	config := config.GetConfig()
+	if err := utils.LoadWgslSpec(config.SpecTable); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	utils.LoadHtmlAllowlist(config.HtmlAllowlist)
+
+	switch config.Command {
+	case "rustgen":
+		runRustgen(config)
+	case "compose":
+		runCompose(config)
+	case "search":
+		runSearch(config)
+	default:
+		generateDocs(config)
+	}
+}
+
+// parses every file matched by the source filter and runs the project wide analyses
+func parseProject(config config.Config, filePaths []string) *wgsl.ModuleRegistry {
+	wgslFiles := make([]wgsl.WgslFile, 0, len(filePaths))
+
+	parsingBar := progressbar.Default(int64(len(filePaths)), "📄 Reading Shader Files")
+
+	for _, filePath := range filePaths {
+		wgslFiles = append(wgslFiles, wgsl.ParseSourceFile(&config, filePath))
+		parsingBar.Add(1)
+	}
+
+	registry := wgsl.NewModuleRegistry(wgslFiles)
+	registry.AnalyzeResourceUsage()
+	registry.AnalyzeShaderDefReachability()
+	registry.AnalyzeComplexity()
+	registry.AnalyzeUniformity()
+	registry.LinkFlagGroups()
+	registry.CheckDeprecatedImports()
+	registry.CheckParamDocs()
+	registry.CheckRecursiveStructures()
+	registry.CheckMath()
+	registry.ResolveDocLinks(config.Repository)
+	registry.HighlightSources()
+	registry.CheckCommentMarkup()
+
+	// documentation warnings, the shader diagnostics are shown on the pages
+	for _, diagnostic := range registry.Diagnostics.All() {
+		switch diagnostic.Code {
+		case "deprecated-import", "unknown-param-doc", "unresolved-doc-link", "malformed-math", "stripped-markup", "recursive-struct":
+			log.Printf("⚠️ %s:%d: %s", diagnostic.File, diagnostic.Span.Line, diagnostic.Message)
+		}
+	}
+
+	return registry
+}
+
+func generateDocs(config config.Config) {
 	filePaths := getWgslFilesList(config)
 	totalFiles := int64(len(filePaths))
 
-	utils.LoadWgslTypes()
 	SetupHandlebars()
 
+	registry := parseProject(config, filePaths)
+
 	searchInfo := make([]ShaderSearchableInfo, 0, 4096)
 	declaredImportPaths := make(map[string]string)
-	wgslFiles := make([]wgsl.WgslFile, 0, len(filePaths))
-
-	parsingBar := progressbar.Default(totalFiles, "📄 Reading WGSL Files")
-
-	for _, filePath := range filePaths {
-		wgslFile := wgsl.ParseWGSLFile(&config, filePath)
-		wgslFiles = append(wgslFiles, wgslFile)
 
+	for _, wgslFile := range registry.Files {
 		normalizedLink := utils.NormalizeLink(wgslFile.Link)
 
 		exportable := wgslFile.ImportPath != nil
@@ -64,15 +119,31 @@ func main() {
 			len(wgslFile.Functions)+len(wgslFile.Structures)+len(wgslFile.Consts)+len(wgslFile.Bindings),
 		)
 
+		if summary := wgslFile.ModuleSummary(); summary != "" {
+			localSearchInfo = append(localSearchInfo, ShaderSearchableInfo{
+				Link:       normalizedLink,
+				Filename:   wgslFile.Filename,
+				Exportable: exportable,
+				Name:       wgslFile.ModuleName(),
+				Anchor:     "module-doc",
+				Type:       "module",
+				Comment:    wgslFile.ModuleDoc,
+				Summary:    markdownLinkPattern.ReplaceAllString(summary, "$1"),
+			})
+		}
+
 		for _, fn := range wgslFile.Functions {
 			localSearchInfo = append(localSearchInfo, ShaderSearchableInfo{
 				Link:           normalizedLink,
 				Filename:       wgslFile.Filename,
 				Exportable:     exportable,
 				Name:           fn.Name,
+				Anchor:         fn.Anchor,
+				Variant:        fn.VariantCondition,
 				Type:           "function",
 				StageAttribute: fn.StageAttribute,
 				Comment:        fn.Comment,
+				Deprecated:     fn.Tags.Deprecated,
 			})
 		}
 
@@ -82,7 +153,10 @@ func main() {
 				Filename:   wgslFile.Filename,
 				Exportable: exportable,
 				Name:       structure.Name,
+				Anchor:     structure.Anchor,
+				Variant:    structure.VariantCondition,
 				Type:       "struct",
+				Deprecated: structure.Tags.Deprecated,
 			})
 		}
 
@@ -93,6 +167,7 @@ func main() {
 				Exportable: exportable,
 				Name:       consts.Name,
 				Type:       "const",
+				Deprecated: consts.Tags.Deprecated,
 			})
 		}
 
@@ -102,13 +177,13 @@ func main() {
 				Filename:   wgslFile.Filename,
 				Exportable: exportable,
 				Name:       binding.Name,
+				Anchor:     binding.Anchor,
 				Type:       "binding",
+				Deprecated: binding.Tags.Deprecated,
 			})
 		}
 
 		searchInfo = append(searchInfo, localSearchInfo...)
-
-		parsingBar.Add(1)
 	}
 
 	compiledTemplate, err := raymond.Parse(WGSL_DOC_TEMPLATE_SOURCE)
@@ -116,15 +191,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	versionedOutput := filepath.Join(config.OutputDir, config.Version)
+
+	if config.Composed {
+		writeComposedViews(registry, config, versionedOutput)
+	}
+
 	processingBar := progressbar.Default(totalFiles, "🛠️ Generating Documentation")
 
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, runtime.NumCPU())
 
-	versionedOutput := filepath.Join(config.OutputDir, config.Version)
+	// "Used in" sections need the type links of every file
+	for _, wgslFile := range registry.Files {
+		wgslFile.ResolveTypeLinks(declaredImportPaths)
+	}
+	typeUsage := registry.IndexTypeUsage()
+	signatureIndex := registry.SignatureIndex()
 
-	for _, wgslFile := range wgslFiles {
-		wgslFile := wgslFile
+	for _, wgslFile := range registry.Files {
 		wg.Add(1)
 		sem <- struct{}{}
 
@@ -132,7 +217,6 @@ func main() {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			wgslFile.ResolveTypeLinks(declaredImportPaths)
 			wgslFile.GenerateWgslPage(compiledTemplate, versionedOutput)
 			processingBar.Add(1)
 		}()
@@ -141,18 +225,10 @@ func main() {
 	wg.Wait()
 
 	files := []map[string]string{}
-	for _, filePath := range filePaths {
-		docPath, err := filepath.Rel(config.SourcePath, filePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		docPath = strings.Replace(docPath, "src/", "", 1)
-		docPath = strings.TrimSuffix(docPath, ".wgsl")
-		docPath = utils.DedupPathParts(docPath) + ".html"
-
+	for _, wgslFile := range registry.Files {
 		files = append(files, map[string]string{
-			"file": docPath,
+			"file":    wgslFile.WgslPath,
+			"summary": wgslFile.ModuleSummary(),
 		})
 	}
 
@@ -160,12 +236,74 @@ func main() {
 		"files":          files,
 		"skipHomeButton": true,
 		"version":        config.Version,
+		"specVersion":    utils.WgslSpecVersion(),
 	}, filepath.Join(versionedOutput, "index.html"))
 
+	writeMetricsReport(registry, config, versionedOutput)
+
+	notes := registry.Notes()
+	writeNotesReport(notes, config, versionedOutput)
+
+	duplicates := registry.FindDuplicates()
+	writeDuplicatesReport(duplicates, config, versionedOutput)
+
 	renderTemplateToFile(NOT_FOUND_TEMPLATE_SOURCE, map[string]interface{}{},
 		filepath.Join(config.OutputDir, "404.html"))
 
+	if config.Reflection {
+		writePipelineReflection(registry, versionedOutput)
+	}
+
 	copyItemsToPublic(&config, searchInfo)
+	writePublicIndex(&config, "type-usage", typeUsage)
+	writePublicIndex(&config, "signature-index", signatureIndex)
+	writePublicIndex(&config, "duplicates", duplicates)
+	writePublicIndex(&config, "notes", notes)
+	writePublicIndex(&config, "diagnostics", registry.Diagnostics.All())
+}
+
+// writes one reflection document per entry point next to the generated pages,
+// e.g. reflection/crates/bevy_pbr/render/pbr/fragment.json
+func writePipelineReflection(registry *wgsl.ModuleRegistry, versionedOutput string) {
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			if fn.StageAttribute == "" {
+				continue
+			}
+
+			reflection := registry.PipelineReflection(file, fn)
+			reflectionJSON, err := json.MarshalIndent(reflection, "", "  ")
+			if err != nil {
+				log.Fatal("Error marshaling pipeline reflection:", err)
+			}
+
+			outputPath := filepath.Join(versionedOutput, "reflection", strings.TrimSuffix(file.WgslPath, ".html"), fn.Name+".json")
+			err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			err = os.WriteFile(outputPath, reflectionJSON, 0644)
+			if err != nil {
+				log.Fatal("Error writing pipeline reflection:", err)
+			}
+		}
+	}
+}
+
+// exports a project wide index for tools and the search page next to the
+// search info, e.g. public/type-usage-0.15.0.json
+func writePublicIndex(config *config.Config, name string, index any) {
+	indexJSON, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		log.Fatalf("Error marshaling %s: %v", name, err)
+	}
+
+	err = os.WriteFile(filepath.Join(config.OutputDir, "public", fmt.Sprintf("%s-%s.json", name, config.Version)), indexJSON, 0644)
+	if err != nil {
+		log.Fatalf("Error writing %s: %v", name, err)
+	}
 }
 
 func renderTemplateToFile(templateSrc string, context map[string]interface{}, outputPath string) {
@@ -184,7 +322,17 @@ func renderTemplateToFile(templateSrc string, context map[string]interface{}, ou
 }
 
 func getWgslFilesList(config config.Config) []string {
-	cmd := exec.Command("find", config.SourcePath, "-type", "f", "-name", config.FileFilter)
+	// the filter is a comma separated list of patterns, e.g. *.wgsl,*.glsl
+	args := []string{config.SourcePath, "-type", "f", "("}
+	for i, pattern := range strings.Split(config.FileFilter, ",") {
+		if i > 0 {
+			args = append(args, "-o")
+		}
+		args = append(args, "-name", strings.TrimSpace(pattern))
+	}
+	args = append(args, ")")
+
+	cmd := exec.Command("find", args...)
 	stdout, err := cmd.Output()
 	if err != nil {
 		log.Fatal(err)
@@ -221,11 +369,18 @@ func copyItemsToPublic(config *config.Config, searchInfo []ShaderSearchableInfo)
 }
 
 type ShaderSearchableInfo struct {
-	Link           string `json:"link"`
-	Filename       string `json:"filename"`
-	Exportable     bool   `json:"exportable"`
-	Name           string `json:"name"`
+	Link       string `json:"link"`
+	Filename   string `json:"filename"`
+	Exportable bool   `json:"exportable"`
+	Name       string `json:"name"`
+	// variant anchor of items defined in several shader def branches
+	Anchor         string `json:"anchor,omitempty"`
+	Variant        string `json:"variant,omitempty"`
 	Type           string `json:"type"`
 	StageAttribute string `json:"stageAttribute"`
 	Comment        string `json:"comment"`
+	// first paragraph of the module documentation, for modules
+	Summary string `json:"summary,omitempty"`
+	// deprecated items are ranked after the others
+	Deprecated bool `json:"deprecated,omitempty"`
 }
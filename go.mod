@@ -4,17 +4,17 @@ go 1.23.1
 
 require (
 	github.com/aymerick/raymond v2.0.2+incompatible
+	github.com/gomarkdown/markdown v0.0.0-20250311123330-531bef5e742b
 	github.com/samber/lo v1.49.1
 	github.com/schollz/progressbar/v3 v3.18.0
+	github.com/stretchr/testify v1.10.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gomarkdown/markdown v0.0.0-20250311123330-531bef5e742b // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/term v0.32.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
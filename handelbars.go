@@ -2,10 +2,14 @@ package main
 
 import (
 	_ "embed"
+	"html"
+	"reflect"
 	"strings"
 
+	utils "main/utils"
+	wgsl "main/wgsl"
+
 	"github.com/aymerick/raymond"
-	"github.com/gomarkdown/markdown"
 )
 
 //go:embed templates/wgsl-doc.hbs
@@ -17,6 +21,18 @@ var NOT_FOUND_TEMPLATE_SOURCE string
 //go:embed templates/home.hbs
 var HOME_DOC_TEMPLATE_SOURCE string
 
+//go:embed templates/composed.hbs
+var COMPOSED_TEMPLATE_SOURCE string
+
+//go:embed templates/metrics.hbs
+var METRICS_TEMPLATE_SOURCE string
+
+//go:embed templates/duplicates.hbs
+var DUPLICATES_TEMPLATE_SOURCE string
+
+//go:embed templates/notes.hbs
+var NOTES_TEMPLATE_SOURCE string
+
 //go:embed templates/partials/shader-defs-list.hbs
 var SHADER_DEFS_LIST_TEMPLATE string
 
@@ -38,11 +54,20 @@ var HEADER_TEMPLATE string
 //go:embed templates/partials/version-selector.hbs
 var VERSION_SELECTOR_TEMPLATE string
 
+//go:embed templates/partials/doc-tags.hbs
+var DOC_TAGS_TEMPLATE string
+
+//go:embed templates/partials/variants.hbs
+var VARIANTS_TEMPLATE string
+
 func SetupHandlebars() {
 	raymond.RegisterHelper("eq", eq)
 	raymond.RegisterHelper("neq", neq)
 	raymond.RegisterHelper("parse-markdown", parseMarkdown)
 	raymond.RegisterHelper("contains", contains)
+	raymond.RegisterHelper("attribute-link", utils.GetAttributeLink)
+	raymond.RegisterHelper("attribute-value", attributeValue)
+	raymond.RegisterHelper("len", length)
 
 	raymond.RegisterPartial("shader-defs-list", SHADER_DEFS_LIST_TEMPLATE)
 	raymond.RegisterPartial("type", TYPE_TEMPLATE)
@@ -51,6 +76,8 @@ func SetupHandlebars() {
 	raymond.RegisterPartial("annotations", ANNOTATIONS_TEMPLATE)
 	raymond.RegisterPartial("header", HEADER_TEMPLATE)
 	raymond.RegisterPartial("version-selector", VERSION_SELECTOR_TEMPLATE)
+	raymond.RegisterPartial("doc-tags", DOC_TAGS_TEMPLATE)
+	raymond.RegisterPartial("variants", VARIANTS_TEMPLATE)
 }
 
 func eq(a, b interface{}) bool {
@@ -61,11 +88,42 @@ func neq(a, b interface{}) bool {
 	return a != b
 }
 
+// renders the markdown of a comment to sanitized HTML, see utils.RenderMarkdown
 func parseMarkdown(text string) string {
-	maybeUnsafeHTML := markdown.ToHTML([]byte(text), nil, nil)
-	return strings.TrimSpace(string(maybeUnsafeHTML))
+	rendered, _ := utils.RenderMarkdown(text)
+	return rendered
+}
+
+// raymond does not resolve `.length` on Go slices
+func length(value interface{}) int {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return v.Len()
+	}
+	return 0
 }
 
 func contains(needle, haystack string) bool {
 	return strings.Contains(haystack, needle)
 }
+
+// renders the arguments of an attribute, linking the ones found in the spec
+// table and highlighting number literals
+func attributeValue(name string, args []string) string {
+	rendered := make([]string, len(args))
+
+	for i, arg := range args {
+		escaped := html.EscapeString(arg)
+
+		if link := utils.GetAttributeValueLink(name, arg); link != "" {
+			rendered[i] = `<a href="` + link + `" target="_blank" rel="noopener noreferrer" class="value">` + escaped + `</a>`
+		} else if lexemes := wgsl.Lex(arg); len(lexemes) == 1 && lexemes[0].Kind == wgsl.LexNumber {
+			rendered[i] = `<span class="hl-number">` + escaped + `</span>`
+		} else {
+			rendered[i] = escaped
+		}
+	}
+
+	return strings.Join(rendered, ", ")
+}
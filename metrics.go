@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+
+	config "main/config"
+	wgsl "main/wgsl"
+)
+
+type metricsRow struct {
+	Name    string               `json:"name"`
+	Module  string               `json:"module"`
+	Link    string               `json:"link"`
+	Stage   string               `json:"stage"`
+	Metrics wgsl.FunctionMetrics `json:"metrics"`
+}
+
+// renders the per version hotspots page listing entry points and functions,
+// heaviest first
+func writeMetricsReport(registry *wgsl.ModuleRegistry, config config.Config, versionedOutput string) {
+	var entryPoints, functions []metricsRow
+
+	for _, file := range registry.Files {
+		for _, fn := range file.Functions {
+			row := metricsRow{
+				Name:    fn.Name,
+				Module:  file.ModuleName(),
+				Link:    file.ItemLink(fn.Name),
+				Stage:   fn.StageAttribute,
+				Metrics: fn.Metrics,
+			}
+
+			if fn.StageAttribute != "" {
+				entryPoints = append(entryPoints, row)
+			} else {
+				functions = append(functions, row)
+			}
+		}
+	}
+
+	for _, rows := range [][]metricsRow{entryPoints, functions} {
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := rows[i].Metrics, rows[j].Metrics
+			if a.Cyclomatic != b.Cyclomatic {
+				return a.Cyclomatic > b.Cyclomatic
+			}
+			return a.Lines > b.Lines
+		})
+	}
+
+	renderTemplateToFile(METRICS_TEMPLATE_SOURCE, map[string]interface{}{
+		"version": config.Version,
+		"sections": []map[string]interface{}{
+			{"title": "Entry points", "rows": entryPoints},
+			{"title": "Functions", "rows": functions},
+		},
+	}, filepath.Join(versionedOutput, "metrics.html"))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	config "main/config"
+	wgsl "main/wgsl"
+)
+
+// renders the per version known issues page listing the TODO, FIXME, HACK
+// and NOTE comments, and the notes resolved or added since the previous
+// version exported in the output directory
+func writeNotesReport(notes []wgsl.ShaderNote, config config.Config, versionedOutput string) {
+	kinds := []map[string]interface{}{}
+	for _, kind := range []string{"FIXME", "HACK", "TODO", "NOTE"} {
+		count := 0
+		for _, note := range notes {
+			if note.Kind == kind {
+				count++
+			}
+		}
+		kinds = append(kinds, map[string]interface{}{"kind": kind, "count": count})
+	}
+
+	context := map[string]interface{}{
+		"version": config.Version,
+		"kinds":   kinds,
+		"notes":   notes,
+	}
+
+	if previousVersion := previousNotesVersion(config); previousVersion != "" {
+		previous := readNotesExport(config, previousVersion)
+		context["previousVersion"] = previousVersion
+		context["diff"] = wgsl.DiffNotes(previous, notes)
+	}
+
+	renderTemplateToFile(NOTES_TEMPLATE_SOURCE, context, filepath.Join(versionedOutput, "notes.html"))
+}
+
+// returns the latest version older than the current one with a notes export
+// in the public directory, or ""
+func previousNotesVersion(config config.Config) string {
+	exports, err := filepath.Glob(filepath.Join(config.OutputDir, "public", "notes-*.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	previous := ""
+	for _, export := range exports {
+		version := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(export), "notes-"), ".json")
+		if compareVersions(version, config.Version) < 0 && (previous == "" || compareVersions(version, previous) > 0) {
+			previous = version
+		}
+	}
+	return previous
+}
+
+func readNotesExport(config config.Config, version string) []wgsl.ShaderNote {
+	data, err := os.ReadFile(filepath.Join(config.OutputDir, "public", "notes-"+version+".json"))
+	if err != nil {
+		log.Fatalf("Error reading the notes of %s: %v", version, err)
+	}
+
+	var notes []wgsl.ShaderNote
+	err = json.Unmarshal(data, &notes)
+	if err != nil {
+		log.Fatalf("Error parsing the notes of %s: %v", version, err)
+	}
+	return notes
+}
+
+// compares dotted versions such as 0.15.3 part by part, numerically when
+// both parts are numbers
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		if i >= len(aParts) {
+			return -1
+		}
+		if i >= len(bParts) {
+			return 1
+		}
+
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		switch {
+		case aErr == nil && bErr == nil && aNumber != bNumber:
+			if aNumber < bNumber {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && aParts[i] != bParts[i]:
+			return strings.Compare(aParts[i], bParts[i])
+		}
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	config "main/config"
+	wgsl "main/wgsl"
+)
+
+// generates Rust `BindGroupLayoutEntries` for a single file, or for the
+// bindings a single entry point actually uses
+func runRustgen(config config.Config) {
+	if config.File == "" {
+		log.Fatal("Error: 'file' is a required argument for rustgen")
+	}
+
+	registry := parseProject(config, getWgslFilesList(config))
+
+	file := findSourceFile(registry, config.File)
+	if file == nil {
+		log.Fatalf("Error: '%s' is not part of the source tree", config.File)
+	}
+
+	visibility := []string{"vertex", "fragment"}
+	if config.Visibility != "" {
+		visibility = strings.Split(config.Visibility, ",")
+	}
+
+	var groups []wgsl.BindGroupLayout
+	source := file.ModuleName()
+
+	if config.EntryPoint != "" {
+		idx := slices.IndexFunc(file.Functions, func(v wgsl.Function) bool {
+			return v.Name == config.EntryPoint && v.StageAttribute != ""
+		})
+		if idx == -1 {
+			log.Fatalf("Error: '%s' is not an entry point of %s", config.EntryPoint, file.Filename)
+		}
+
+		fn := &file.Functions[idx]
+		if config.Visibility == "" {
+			visibility = []string{fn.StageAttribute}
+		}
+
+		groups = registry.PipelineReflection(file, fn).BindGroups
+		source += "::" + fn.Name
+	} else {
+		groups = registry.FileBindGroupLayouts(file, nil)
+	}
+
+	rust, err := wgsl.GenerateRustBindGroupLayouts(source, groups, visibility)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if config.Out == "" {
+		fmt.Print(rust)
+		return
+	}
+
+	err = os.WriteFile(config.Out, []byte(rust), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// finds the file at path, or else the only file whose path ends with the
+// path components of path, e.g. `render/pbr.wgsl`
+func findSourceFile(registry *wgsl.ModuleRegistry, path string) *wgsl.WgslFile {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	suffix := string(filepath.Separator) + filepath.Clean(path)
+
+	var matches []*wgsl.WgslFile
+	for _, file := range registry.Files {
+		fileAbsPath, err := filepath.Abs(file.FilePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fileAbsPath == absPath {
+			return file
+		}
+		if strings.HasSuffix(fileAbsPath, suffix) {
+			matches = append(matches, file)
+		}
+	}
+
+	if len(matches) > 1 {
+		paths := make([]string, len(matches))
+		for i, file := range matches {
+			paths[i] = file.FilePath
+		}
+		log.Fatalf("Error: '%s' matches several files: %s", path, strings.Join(paths, ", "))
+	}
+	if len(matches) == 1 {
+		return matches[0]
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	config "main/config"
+	wgsl "main/wgsl"
+)
+
+// lists the functions matching a type signature query, best matches first
+func runSearch(config config.Config) {
+	if config.Query == "" {
+		log.Fatal("Error: 'query' is a required argument for search")
+	}
+
+	registry := parseProject(config, getWgslFilesList(config))
+	matches := wgsl.SearchSignatures(registry.SignatureIndex(), wgsl.ParseSignatureQuery(config.Query))
+
+	if len(matches) == 0 {
+		fmt.Printf("No function matches '%s'\n", config.Query)
+		return
+	}
+
+	for _, match := range matches {
+		fmt.Printf("%s\n    %s\n", match.Signature, match.Module)
+	}
+}
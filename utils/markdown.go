@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// RenderMarkdown renders the markdown of a comment to sanitized HTML and
+// returns what the sanitizer stripped. `$...$` and `$$...$$` formulas are
+// converted to MathML and malformed ones are shown as code.
+func RenderMarkdown(text string) (string, []string) {
+	var formulas []string
+	withPlaceholders := ReplaceMath(text, func(span MathSpan) string {
+		source := text[span.Start:span.End]
+		mathML, err := TexToMathML(span.Tex, span.Display)
+		if err != nil {
+			if strings.Contains(source, "`") {
+				return "`` " + source + " ``"
+			}
+			return "`" + source + "`"
+		}
+
+		formulas = append(formulas, mathML)
+		// letters only, so that markdown leaves it alone
+		return fmt.Sprintf("MATHPLACEHOLDER%dX", len(formulas)-1)
+	})
+
+	// formulas are rendered above, not by MathJax in the browser
+	markdownParser := parser.NewWithExtensions(parser.CommonExtensions &^ parser.MathJax)
+	maybeUnsafeHTML := string(markdown.ToHTML([]byte(withPlaceholders), markdownParser, nil))
+	for i, formula := range formulas {
+		maybeUnsafeHTML = strings.Replace(maybeUnsafeHTML, fmt.Sprintf("MATHPLACEHOLDER%dX", i), formula, 1)
+	}
+
+	sanitized, stripped := SanitizeHTML(maybeUnsafeHTML)
+	return strings.TrimSpace(sanitized), stripped
+}
@@ -0,0 +1,610 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// MathSpan is a `$...$` or `$$...$$` formula of a markdown text. Start and
+// End include the delimiters.
+type MathSpan struct {
+	Start   int
+	End     int
+	Tex     string
+	Display bool
+}
+
+// FindMath returns the formulas of a markdown text, skipping code spans and
+// fenced code blocks. Like pandoc, an inline formula must not start or end
+// with a space and the closing `$` must not be followed by a digit, so that
+// prices such as `$5 and $10` are left alone.
+func FindMath(text string) []MathSpan {
+	var spans []MathSpan
+	lineStart := true
+
+	for i := 0; i < len(text); {
+		if lineStart {
+			lineStart = false
+			if strings.HasPrefix(strings.TrimLeft(text[i:], " \t"), "```") {
+				i = skipFence(text, i)
+				continue
+			}
+		}
+
+		switch text[i] {
+		case '\n':
+			lineStart = true
+			i++
+		case '\\':
+			i += 2
+		case '`':
+			i = skipCodeSpan(text, i)
+		case '$':
+			if strings.HasPrefix(text[i:], "$$") {
+				end := strings.Index(text[i+2:], "$$")
+				if end == -1 {
+					i += 2
+					continue
+				}
+				spans = append(spans, MathSpan{Start: i, End: i + 2 + end + 2, Tex: strings.TrimSpace(text[i+2 : i+2+end]), Display: true})
+				i += 2 + end + 2
+				continue
+			}
+
+			if end := inlineMathEnd(text, i); end != -1 {
+				spans = append(spans, MathSpan{Start: i, End: end + 1, Tex: text[i+1 : end]})
+				i = end + 1
+				continue
+			}
+			i++
+		default:
+			i++
+		}
+	}
+
+	return spans
+}
+
+// returns the offset of the `$` closing the inline formula opened at start,
+// or -1
+func inlineMathEnd(text string, start int) int {
+	if start+1 >= len(text) || unicode.IsSpace(rune(text[start+1])) {
+		return -1
+	}
+
+	for j := start + 1; j < len(text) && text[j] != '\n'; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '`':
+			// a formula does not cross a code span
+			return -1
+		case '$':
+			if unicode.IsSpace(rune(text[j-1])) || (j+1 < len(text) && text[j+1] >= '0' && text[j+1] <= '9') {
+				return -1
+			}
+			return j
+		}
+	}
+	return -1
+}
+
+// returns the offset after the fenced code block starting on the line at i
+func skipFence(text string, i int) int {
+	lineEnd := func(from int) int {
+		if end := strings.IndexByte(text[from:], '\n'); end != -1 {
+			return from + end + 1
+		}
+		return len(text)
+	}
+
+	for j := lineEnd(i); j < len(text); j = lineEnd(j) {
+		if strings.HasPrefix(strings.TrimLeft(text[j:], " \t"), "```") {
+			return lineEnd(j)
+		}
+	}
+	return len(text)
+}
+
+// returns the offset after the code span opened by the backticks at i, or
+// after the backticks when it is not closed
+func skipCodeSpan(text string, i int) int {
+	ticks := i
+	for ticks < len(text) && text[ticks] == '`' {
+		ticks++
+	}
+	fence := text[i:ticks]
+
+	if end := strings.Index(text[ticks:], fence); end != -1 {
+		return ticks + end + len(fence)
+	}
+	return ticks
+}
+
+// ReplaceMath returns text with every formula replaced by replace.
+func ReplaceMath(text string, replace func(MathSpan) string) string {
+	var builder strings.Builder
+	last := 0
+
+	for _, span := range FindMath(text) {
+		builder.WriteString(text[last:span.Start])
+		builder.WriteString(replace(span))
+		last = span.End
+	}
+	builder.WriteString(text[last:])
+
+	return builder.String()
+}
+
+var greekLetters = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε", "zeta": "ζ",
+	"eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ",
+	"nu": "ν", "xi": "ξ", "pi": "π", "rho": "ρ", "varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ",
+	"upsilon": "υ", "phi": "ϕ", "varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π", "Sigma": "Σ",
+	"Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+// symbols rendered as identifiers
+var mathIdentifiers = map[string]string{
+	"infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ", "hbar": "ℏ", "emptyset": "∅",
+}
+
+var mathOperators = map[string]string{
+	"cdot": "⋅", "times": "×", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆", "circ": "∘",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈", "equiv": "≡",
+	"sim": "∼", "simeq": "≃", "propto": "∝", "ll": "≪", "gg": "≫",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"leftrightarrow": "↔", "Leftrightarrow": "⇔", "mapsto": "↦",
+	"in": "∈", "notin": "∉", "subset": "⊂", "subseteq": "⊆", "supset": "⊃", "cup": "∪", "cap": "∩",
+	"forall": "∀", "exists": "∃", "neg": "¬", "wedge": "∧", "vee": "∨", "oplus": "⊕", "otimes": "⊗",
+	"perp": "⊥", "parallel": "∥", "mid": "∣", "vert": "|", "Vert": "‖",
+	"cdots": "⋯", "ldots": "…", "dots": "…", "vdots": "⋮",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+}
+
+// operators whose scripts are drawn under and over them in display math
+var largeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+}
+
+var mathFunctions = []string{
+	"sin", "cos", "tan", "cot", "sec", "csc", "arcsin", "arccos", "arctan", "sinh", "cosh", "tanh",
+	"log", "ln", "exp", "det", "deg", "dim", "arg", "gcd", "min", "max", "sup", "inf", "lim",
+}
+
+// functions whose subscript is drawn under them in display math
+var limitFunctions = []string{"lim", "min", "max", "sup", "inf"}
+
+var mathAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "‾", "vec": "→", "tilde": "~", "widetilde": "~",
+	"dot": "˙", "ddot": "¨",
+}
+
+var mathSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", "!": "-0.1667em",
+	"quad": "1em", "qquad": "2em",
+}
+
+var mathVariants = map[string]string{
+	"mathbf": "bold", "boldsymbol": "bold-italic", "mathit": "italic", "mathrm": "normal",
+	"operatorname": "normal", "mathcal": "script", "mathbb": "double-struck", "mathsf": "sans-serif",
+	"mathtt": "monospace",
+}
+
+// TexToMathML converts a TeX formula to a MathML `<math>` element. Only the
+// math mode subset used in comments is supported: scripts, fractions, roots,
+// Greek letters, common operators and functions, accents, `\left`/`\right`
+// delimiters, `\text` and font commands. The source is kept as a TeX
+// annotation.
+func TexToMathML(tex string, display bool) (string, error) {
+	row, err := texToMathMLRow(tex, display)
+	if err != nil {
+		return "", err
+	}
+
+	mode := "inline"
+	if display {
+		mode = "block"
+	}
+
+	return fmt.Sprintf(
+		`<math xmlns="http://www.w3.org/1998/Math/MathML" display="%s"><semantics><mrow>%s</mrow><annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		mode, row, html.EscapeString(tex),
+	), nil
+}
+
+// converts a formula to the elements of a row, without the `<math>` element
+func texToMathMLRow(tex string, display bool) (string, error) {
+	parser := texParser{src: tex, display: display}
+	return parser.parseRow("")
+}
+
+type texParser struct {
+	src     string
+	pos     int
+	display bool
+}
+
+// an element of a row, large operators and limit functions take their
+// scripts under and over them in display math
+type texAtom struct {
+	mathML    string
+	underOver bool
+}
+
+// whether the parser is at a `\right` command, and not at `\rightarrow`
+func (p *texParser) atRight() bool {
+	rest := p.src[p.pos:]
+	return strings.HasPrefix(rest, `\right`) && (len(rest) == len(`\right`) || !unicode.IsLetter(rune(rest[len(`\right`)])))
+}
+
+func (p *texParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// parses atoms up to the end of the source, a closing brace or the `\right`
+// closing a `\left`, which are not consumed
+func (p *texParser) parseRow(closing string) (string, error) {
+	var builder strings.Builder
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.src) {
+			if closing != "" {
+				return "", fmt.Errorf("missing `%s`", closing)
+			}
+			return builder.String(), nil
+		}
+
+		switch {
+		case p.src[p.pos] == '}' && closing == "":
+			return "", errors.New("unbalanced `}`")
+		case p.atRight() && closing == "":
+			return "", errors.New("`\\right` without `\\left`")
+		case p.src[p.pos] == '}' || p.atRight():
+			return builder.String(), nil
+		}
+
+		atom, err := p.parseAtom()
+		if err != nil {
+			return "", err
+		}
+
+		scripted, err := p.parseScripts(atom)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(scripted)
+	}
+}
+
+// parses the `_` and `^` scripts following an atom
+func (p *texParser) parseScripts(base texAtom) (string, error) {
+	var sub, sup string
+	hasSub, hasSup := false, false
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.src) || (p.src[p.pos] != '_' && p.src[p.pos] != '^') {
+			break
+		}
+
+		script := p.src[p.pos]
+		p.pos++
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", err
+		}
+
+		if script == '_' {
+			if hasSub {
+				return "", errors.New("double subscript")
+			}
+			sub, hasSub = arg, true
+		} else {
+			if hasSup {
+				return "", errors.New("double superscript")
+			}
+			sup, hasSup = arg, true
+		}
+	}
+
+	underOver := base.underOver && p.display
+	switch {
+	case hasSub && hasSup && underOver:
+		return "<munderover>" + base.mathML + sub + sup + "</munderover>", nil
+	case hasSub && hasSup:
+		return "<msubsup>" + base.mathML + sub + sup + "</msubsup>", nil
+	case hasSub && underOver:
+		return "<munder>" + base.mathML + sub + "</munder>", nil
+	case hasSub:
+		return "<msub>" + base.mathML + sub + "</msub>", nil
+	case hasSup && underOver:
+		return "<mover>" + base.mathML + sup + "</mover>", nil
+	case hasSup:
+		return "<msup>" + base.mathML + sup + "</msup>", nil
+	}
+	return base.mathML, nil
+}
+
+// parses the argument of a command or script, a group or a single token
+func (p *texParser) parseArg() (string, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] == '}' {
+		return "", errors.New("missing argument")
+	}
+
+	if p.src[p.pos] != '{' && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+		return "<mn>" + p.src[p.pos-1:p.pos] + "</mn>", nil
+	}
+
+	atom, err := p.parseAtom()
+	return atom.mathML, err
+}
+
+// returns the source of a braced argument without parsing it, used by
+// `\text` and the font commands
+func (p *texParser) rawArg() (string, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return "", errors.New("missing `{`")
+	}
+
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end == -1 {
+		return "", errors.New("missing `}`")
+	}
+
+	arg := p.src[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+	return arg, nil
+}
+
+func (p *texParser) parseGroup() (string, error) {
+	p.pos++
+	row, err := p.parseRow("}")
+	if err != nil {
+		return "", err
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != '}' {
+		return "", errors.New("missing `}`")
+	}
+	p.pos++
+	return "<mrow>" + row + "</mrow>", nil
+}
+
+func (p *texParser) parseAtom() (texAtom, error) {
+	c := p.src[p.pos]
+
+	switch {
+	case c == '{':
+		group, err := p.parseGroup()
+		return texAtom{mathML: group}, err
+
+	case c == '\\':
+		return p.parseCommand()
+
+	case c >= '0' && c <= '9' || c == '.' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		return texAtom{mathML: "<mn>" + p.src[start:p.pos] + "</mn>"}, nil
+
+	case c < 0x80 && unicode.IsLetter(rune(c)):
+		p.pos++
+		return texAtom{mathML: "<mi>" + string(c) + "</mi>"}, nil
+
+	case c == '\'':
+		p.pos++
+		return texAtom{mathML: "<mo>′</mo>"}, nil
+
+	case c == '~':
+		p.pos++
+		return texAtom{mathML: `<mspace width="0.3333em"/>`}, nil
+
+	case c == '-':
+		p.pos++
+		return texAtom{mathML: "<mo>−</mo>"}, nil
+
+	case strings.IndexByte("+=<>()[],./|!:;*?", c) != -1:
+		p.pos++
+		return texAtom{mathML: "<mo>" + html.EscapeString(string(c)) + "</mo>"}, nil
+
+	case c >= 0x80:
+		// unicode symbols such as `α` typed directly
+		r := []rune(p.src[p.pos:])[0]
+		p.pos += len(string(r))
+		if unicode.IsLetter(r) {
+			return texAtom{mathML: "<mi>" + string(r) + "</mi>"}, nil
+		}
+		return texAtom{mathML: "<mo>" + string(r) + "</mo>"}, nil
+	}
+
+	return texAtom{}, fmt.Errorf("unexpected `%c`", c)
+}
+
+func (p *texParser) parseCommand() (texAtom, error) {
+	p.pos++
+	if p.pos >= len(p.src) {
+		return texAtom{}, errors.New("trailing `\\`")
+	}
+
+	// control symbols such as `\,` or `\{`
+	if c := p.src[p.pos]; !unicode.IsLetter(rune(c)) {
+		p.pos++
+		if width, ok := mathSpaces[string(c)]; ok {
+			return texAtom{mathML: `<mspace width="` + width + `"/>`}, nil
+		}
+		switch c {
+		case '{', '}', '$', '%', '#', '&', '_':
+			return texAtom{mathML: "<mo>" + html.EscapeString(string(c)) + "</mo>"}, nil
+		case '|':
+			return texAtom{mathML: "<mo>‖</mo>"}, nil
+		}
+		return texAtom{}, fmt.Errorf("unknown command `\\%c`", c)
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) && p.src[p.pos] < 0x80 {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+
+	if letter, ok := greekLetters[name]; ok {
+		if unicode.IsUpper([]rune(letter)[0]) {
+			return texAtom{mathML: `<mi mathvariant="normal">` + letter + "</mi>"}, nil
+		}
+		return texAtom{mathML: "<mi>" + letter + "</mi>"}, nil
+	}
+	if symbol, ok := mathIdentifiers[name]; ok {
+		return texAtom{mathML: "<mi>" + symbol + "</mi>"}, nil
+	}
+	if symbol, ok := mathOperators[name]; ok {
+		return texAtom{mathML: "<mo>" + symbol + "</mo>"}, nil
+	}
+	if symbol, ok := largeOperators[name]; ok {
+		return texAtom{mathML: `<mo largeop="true">` + symbol + "</mo>", underOver: !strings.Contains(name, "int")}, nil
+	}
+	for _, function := range mathFunctions {
+		if name == function {
+			underOver := false
+			for _, limit := range limitFunctions {
+				underOver = underOver || name == limit
+			}
+			return texAtom{mathML: "<mi>" + name + "</mi><mo>&#x2061;</mo>", underOver: underOver}, nil
+		}
+	}
+	if width, ok := mathSpaces[name]; ok {
+		return texAtom{mathML: `<mspace width="` + width + `"/>`}, nil
+	}
+	if accent, ok := mathAccents[name]; ok {
+		arg, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: `<mover accent="true">` + arg + "<mo>" + accent + "</mo></mover>"}, nil
+	}
+	if variant, ok := mathVariants[name]; ok {
+		arg, err := p.rawArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		if strings.ContainsAny(arg, `\{}^_$`) {
+			return texAtom{}, fmt.Errorf("unsupported argument of `\\%s`", name)
+		}
+		return texAtom{mathML: `<mi mathvariant="` + variant + `">` + html.EscapeString(strings.TrimSpace(arg)) + "</mi>"}, nil
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac":
+		numerator, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		denominator, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: "<mfrac>" + numerator + denominator + "</mfrac>"}, nil
+
+	case "sqrt":
+		p.skipSpaces()
+		if p.pos < len(p.src) && p.src[p.pos] == '[' {
+			end := strings.IndexByte(p.src[p.pos:], ']')
+			if end == -1 {
+				return texAtom{}, errors.New("missing `]`")
+			}
+			index, err := texToMathMLRow(p.src[p.pos+1:p.pos+end], p.display)
+			if err != nil {
+				return texAtom{}, err
+			}
+			p.pos += end + 1
+			radicand, err := p.parseArg()
+			if err != nil {
+				return texAtom{}, err
+			}
+			return texAtom{mathML: "<mroot>" + radicand + "<mrow>" + index + "</mrow></mroot>"}, nil
+		}
+		radicand, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: "<msqrt>" + radicand + "</msqrt>"}, nil
+
+	case "text", "textrm", "mbox":
+		text, err := p.rawArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: "<mtext>" + html.EscapeString(text) + "</mtext>"}, nil
+
+	case "underline":
+		arg, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: `<munder accentunder="true">` + arg + "<mo>_</mo></munder>"}, nil
+
+	case "left":
+		open, err := p.parseDelimiter()
+		if err != nil {
+			return texAtom{}, err
+		}
+		body, err := p.parseRow(`\right`)
+		if err != nil {
+			return texAtom{}, err
+		}
+		if !p.atRight() {
+			return texAtom{}, errors.New("missing `\\right`")
+		}
+		p.pos += len(`\right`)
+		closing, err := p.parseDelimiter()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return texAtom{mathML: "<mrow>" + open + body + closing + "</mrow>"}, nil
+	}
+
+	return texAtom{}, fmt.Errorf("unknown command `\\%s`", name)
+}
+
+// parses the delimiter following `\left` or `\right`, `.` is an empty one
+func (p *texParser) parseDelimiter() (string, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return "", errors.New("missing delimiter")
+	}
+
+	if p.src[p.pos] == '.' {
+		p.pos++
+		return "", nil
+	}
+
+	var symbol string
+	if p.src[p.pos] == '\\' {
+		atom, err := p.parseCommand()
+		if err != nil {
+			return "", err
+		}
+		symbol = strings.TrimSuffix(strings.TrimPrefix(atom.mathML, "<mo>"), "</mo>")
+		if symbol == atom.mathML {
+			return "", errors.New("invalid delimiter")
+		}
+	} else {
+		if strings.IndexByte("()[]|/", p.src[p.pos]) == -1 {
+			return "", fmt.Errorf("invalid delimiter `%c`", p.src[p.pos])
+		}
+		symbol = p.src[p.pos : p.pos+1]
+		p.pos++
+	}
+
+	return `<mo fence="true" stretchy="true">` + symbol + "</mo>", nil
+}
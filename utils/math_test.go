@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMathRendering(t *testing.T) {
+	text := "Costs $5 and $10, `$x$` is code, $\\frac{a}{b}$ and\n$$\n\\sum_{i=0}^{n} x_i^2\n$$\n```\n$y$\n```\n$\\alpha$"
+	spans := FindMath(text)
+	assert.Equal(t, []string{`\frac{a}{b}`, `\sum_{i=0}^{n} x_i^2`, `\alpha`}, []string{spans[0].Tex, spans[1].Tex, spans[2].Tex})
+	assert.Equal(t, []bool{false, true, false}, []bool{spans[0].Display, spans[1].Display, spans[2].Display})
+	assert.Equal(t, `$\frac{a}{b}$`, text[spans[0].Start:spans[0].End])
+
+	mathML, err := TexToMathML(`\frac{1}{\pi} \cdot x^2`, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="inline"><semantics><mrow>`+
+		`<mfrac><mrow><mn>1</mn></mrow><mrow><mi>π</mi></mrow></mfrac><mo>⋅</mo><msup><mi>x</mi><mn>2</mn></msup>`+
+		`</mrow><annotation encoding="application/x-tex">\frac{1}{\pi} \cdot x^2</annotation></semantics></math>`, mathML)
+
+	mathML, err = TexToMathML(`\sum_{i}^{n} \left( a \rightarrow \sqrt[3]{b} \right)`, true)
+	assert.NoError(t, err)
+	assert.Contains(t, mathML, `display="block"`)
+	assert.Contains(t, mathML, `<munderover><mo largeop="true">∑</mo><mrow><mi>i</mi></mrow><mrow><mi>n</mi></mrow></munderover>`)
+	assert.Contains(t, mathML, `<mrow><mo fence="true" stretchy="true">(</mo><mi>a</mi><mo>→</mo><mroot><mrow><mi>b</mi></mrow><mrow><mn>3</mn></mrow></mroot><mo fence="true" stretchy="true">)</mo></mrow>`)
+
+	for tex, message := range map[string]string{
+		`\frac{a}`:        "missing argument",
+		`x^2^3`:           "double superscript",
+		`{a`:              "missing `}`",
+		`a}`:              "unbalanced `}`",
+		`\foo`:            "unknown command `\\foo`",
+		`\left( a`:        "missing `\\right`",
+		`\mathbf{\alpha}`: "unsupported argument of `\\mathbf`",
+	} {
+		_, err := TexToMathML(tex, false)
+		assert.EqualError(t, err, message, tex)
+	}
+}
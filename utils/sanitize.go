@@ -0,0 +1,198 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+//go:embed html-allowlist.json
+var HtmlAllowlistData []byte
+var htmlAllowlist HtmlAllowlist
+
+// HtmlAllowlist is the markup allowed in rendered comments. Elements missing
+// from it are unwrapped, keeping their text, except for the DropContent ones
+// which are removed whole.
+type HtmlAllowlist struct {
+	// allowed elements and their allowed attributes
+	Elements    map[string][]string `json:"elements"`
+	DropContent []string            `json:"dropContent"`
+	// schemes allowed in href and src, relative URLs are always allowed
+	URLSchemes []string `json:"urlSchemes"`
+}
+
+var htmlTagPattern = regexp.MustCompile("^<(/?)([a-zA-Z][a-zA-Z0-9-]*)((?:\\s+[^\\s\"'>/=]+(?:\\s*=\\s*(?:\"[^\"]*\"|'[^']*'|[^\\s\"'=<>`]+))?)*)\\s*(/?)>")
+var htmlAttributePattern = regexp.MustCompile("([^\\s\"'>/=]+)(?:\\s*=\\s*(?:\"([^\"]*)\"|'([^']*)'|([^\\s\"'=<>`]+)))?")
+var htmlVoidElements = []string{"br", "hr", "img"}
+
+// LoadHtmlAllowlist loads the bundled allowlist, or the one at overridePath
+// when it is set.
+func LoadHtmlAllowlist(overridePath string) {
+	data := HtmlAllowlistData
+	if overridePath != "" {
+		var err error
+		data, err = os.ReadFile(overridePath)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to read HTML allowlist %s: %v", overridePath, err))
+		}
+	}
+
+	htmlAllowlist = HtmlAllowlist{}
+	err := json.Unmarshal(data, &htmlAllowlist)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to parse HTML allowlist: %v", err))
+	}
+}
+
+// SanitizeHTML keeps the elements, attributes and URLs of the allowlist and
+// returns a description of everything else it removed. External links are
+// marked `rel="noopener nofollow"`, unmatched `<` are escaped and elements
+// left open are closed.
+func SanitizeHTML(input string) (string, []string) {
+	var builder strings.Builder
+	var stripped []string
+	var open []string
+
+	strip := func(what string) {
+		if !slices.Contains(stripped, what) {
+			stripped = append(stripped, what)
+		}
+	}
+
+	for i := 0; i < len(input); {
+		lt := strings.IndexByte(input[i:], '<')
+		if lt == -1 {
+			builder.WriteString(input[i:])
+			break
+		}
+		builder.WriteString(input[i : i+lt])
+		i += lt
+
+		if strings.HasPrefix(input[i:], "<!--") {
+			end := strings.Index(input[i:], "-->")
+			if end == -1 {
+				i = len(input)
+			} else {
+				i += end + len("-->")
+			}
+			continue
+		}
+
+		match := htmlTagPattern.FindStringSubmatch(input[i:])
+		if match == nil {
+			builder.WriteString("&lt;")
+			i++
+			continue
+		}
+		i += len(match[0])
+		closing, name, attributes, selfClosing := match[1] == "/", strings.ToLower(match[2]), match[3], match[4] == "/"
+
+		allowed, ok := htmlAllowlist.Elements[name]
+		if !ok {
+			if closing {
+				continue
+			}
+			strip(fmt.Sprintf("`<%s>` element", name))
+			if slices.Contains(htmlAllowlist.DropContent, name) && !selfClosing {
+				i = skipElementContent(input, i, name)
+			}
+			continue
+		}
+
+		if closing {
+			for k := len(open) - 1; k >= 0; k-- {
+				if open[k] == name {
+					for len(open) > k {
+						builder.WriteString("</" + open[len(open)-1] + ">")
+						open = open[:len(open)-1]
+					}
+					break
+				}
+			}
+			continue
+		}
+
+		builder.WriteString("<" + name)
+		href := ""
+		for _, attribute := range htmlAttributePattern.FindAllStringSubmatch(attributes, -1) {
+			attributeName := strings.ToLower(attribute[1])
+			value := html.UnescapeString(attribute[2] + attribute[3] + attribute[4])
+
+			switch {
+			case name == "a" && attributeName == "rel":
+				// set below for external links
+				continue
+			case !slices.Contains(allowed, attributeName):
+				strip(fmt.Sprintf("`%s` attribute of `<%s>`", attributeName, name))
+				continue
+			case (attributeName == "href" || attributeName == "src") && !allowedURL(value):
+				strip(fmt.Sprintf("`%s:` URL", urlScheme(value)))
+				continue
+			case attributeName == "href":
+				href = value
+			}
+			builder.WriteString(" " + attributeName + `="` + html.EscapeString(value) + `"`)
+		}
+		if name == "a" && (urlScheme(href) == "http" || urlScheme(href) == "https") {
+			builder.WriteString(` rel="noopener nofollow"`)
+		}
+
+		switch {
+		case selfClosing:
+			builder.WriteString("/>")
+		case slices.Contains(htmlVoidElements, name):
+			builder.WriteString(">")
+		default:
+			builder.WriteString(">")
+			open = append(open, name)
+		}
+	}
+
+	for k := len(open) - 1; k >= 0; k-- {
+		builder.WriteString("</" + open[k] + ">")
+	}
+
+	return builder.String(), stripped
+}
+
+// returns the offset after the tag closing the element name opened before i,
+// or the end of input
+func skipElementContent(input string, i int, name string) int {
+	end := strings.Index(strings.ToLower(input[i:]), "</"+name)
+	if end == -1 {
+		return len(input)
+	}
+	i += end
+	closing := strings.IndexByte(input[i:], '>')
+	if closing == -1 {
+		return len(input)
+	}
+	return i + closing + 1
+}
+
+func allowedURL(url string) bool {
+	scheme := urlScheme(url)
+	return scheme == "" || slices.Contains(htmlAllowlist.URLSchemes, scheme)
+}
+
+// urlScheme returns the lowercased scheme of url, "" for relative URLs. Spaces
+// and control characters, which browsers ignore, are removed first.
+func urlScheme(url string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url)
+
+	colon := strings.IndexByte(cleaned, ':')
+	if colon == -1 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		return ""
+	}
+	return strings.ToLower(cleaned[:colon])
+}
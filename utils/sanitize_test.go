@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHtmlSanitizer(t *testing.T) {
+	assert.NoError(t, LoadWgslSpec(""))
+	LoadHtmlAllowlist("")
+
+	sanitized, stripped := SanitizeHTML(`<p onclick="x()">Hi <script>alert("<b>")</script><b>bold</b> <a href="https://example.com" rel="opener">ext</a> <a href="/0.16.0/types.html#Mesh">Mesh</a> <a href=" java&#09;script:alert(1)">js</a> <img src=x onerror=alert(1)> 1 < 2 <!-- note --><em>open`)
+	assert.Equal(t, `<p>Hi bold <a href="https://example.com" rel="noopener nofollow">ext</a> <a href="/0.16.0/types.html#Mesh">Mesh</a> <a>js</a> <img src="x"> 1 &lt; 2 <em>open</em></p>`, sanitized)
+	assert.Equal(t, []string{
+		"`onclick` attribute of `<p>`",
+		"`<script>` element",
+		"`<b>` element",
+		"`javascript:` URL",
+		"`onerror` attribute of `<img>`",
+	}, stripped)
+
+	rendered, stripped := RenderMarkdown("Lambert $\\frac{1}{\\pi}$ and `<script>`.\n\n```wgsl\nlet x = 1.0;\n```")
+	assert.Empty(t, stripped)
+	assert.Contains(t, rendered, `<mfrac><mrow><mn>1</mn></mrow><mrow><mi>π</mi></mrow></mfrac>`)
+	assert.Contains(t, rendered, `<code>&lt;script&gt;</code>`)
+}
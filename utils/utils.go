@@ -9,15 +9,94 @@ import (
 	"strings"
 )
 
-//go:embed wgpu-types.json
-var WgpuTypesData []byte
-var wgpuTypes map[string]string
+//go:embed wgsl-spec.json
+var WgslSpecData []byte
+var wgslSpec WgslSpec
+
+// WgslSpec is the bundled WGSL reference table. Entries are either anchors
+// relative to SpecURL or absolute URLs.
+type WgslSpec struct {
+	Version          string            `json:"version"`
+	SpecURL          string            `json:"specURL"`
+	Types            map[string]string `json:"types"`
+	Attributes       map[string]string `json:"attributes"`
+	BuiltinValues    map[string]string `json:"builtinValues"`
+	Interpolation    map[string]string `json:"interpolation"`
+	AddressSpaces    map[string]string `json:"addressSpaces"`
+	AccessModes      map[string]string `json:"accessModes"`
+	TexelFormats     map[string]string `json:"texelFormats"`
+	BuiltinFunctions map[string]string `json:"builtinFunctions"`
+}
+
+// LoadWgslSpec loads the bundled spec table, or the one at overridePath when
+// it is set, so the table can be refreshed without rebuilding.
+func LoadWgslSpec(overridePath string) error {
+	data, source := WgslSpecData, "bundled wgsl-spec.json"
+	if overridePath != "" {
+		var err error
+		data, err = os.ReadFile(overridePath)
+		if err != nil {
+			return fmt.Errorf("failed to read spec table %s: %w", overridePath, err)
+		}
+		source = overridePath
+	}
 
-func LoadWgslTypes() {
-	err := json.Unmarshal(WgpuTypesData, &wgpuTypes)
+	err := json.Unmarshal(data, &wgslSpec)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to parse wgpu-types.json: %v", err))
+		return fmt.Errorf("failed to parse spec table %s: %w", source, err)
+	}
+	return nil
+}
+
+func WgslSpecVersion() string {
+	return wgslSpec.Version
+}
+
+func specLink(table map[string]string, name string) string {
+	anchor, ok := table[strings.TrimSpace(name)]
+	if !ok {
+		return ""
 	}
+	if strings.HasPrefix(anchor, "http") {
+		return anchor
+	}
+	return wgslSpec.SpecURL + anchor
+}
+
+func GetAttributeLink(name string) string {
+	return specLink(wgslSpec.Attributes, name)
+}
+
+// GetAttributeValueLink links a single attribute argument, e.g. `position`
+// in `@builtin(position)` or `flat` in `@interpolate(flat)`.
+func GetAttributeValueLink(attribute, value string) string {
+	switch attribute {
+	case "builtin":
+		return specLink(wgslSpec.BuiltinValues, value)
+	case "interpolate":
+		return specLink(wgslSpec.Interpolation, value)
+	}
+	return ""
+}
+
+// GetTypeComponentLink links any identifier that may appear inside a type or
+// a `var<...>` template list: types, address spaces, access modes and texel formats.
+func GetTypeComponentLink(name string) string {
+	for _, table := range []map[string]string{
+		wgslSpec.Types,
+		wgslSpec.AddressSpaces,
+		wgslSpec.AccessModes,
+		wgslSpec.TexelFormats,
+	} {
+		if link := specLink(table, name); link != "" {
+			return link
+		}
+	}
+	return ""
+}
+
+func GetBuiltinFunctionLink(name string) string {
+	return specLink(wgslSpec.BuiltinFunctions, name)
 }
 
 func SplitParams(s string) []string {
@@ -31,9 +110,9 @@ func SplitParams(s string) []string {
 
 	for _, char := range s {
 		switch char {
-		case '<':
+		case '<', '(', '[':
 			depth++
-		case '>':
+		case '>', ')', ']':
 			depth--
 		case ',':
 			if depth == 0 {
@@ -62,10 +141,7 @@ func GetTypeLink(t string) string {
 	if i := strings.Index(baseType, "<"); i != -1 {
 		baseType = baseType[:i]
 	}
-	if link, ok := wgpuTypes[baseType]; ok {
-		return link
-	}
-	return ""
+	return specLink(wgslSpec.Types, baseType)
 }
 
 func NormalizeLink(link string) string {
@@ -122,3 +198,15 @@ func PrintAsJson[T any](v T) {
 
 	fmt.Println(string(printJson))
 }
+
+// RepositoryURL returns the repository of a GitHub tree or blob URL, such as
+// https://github.com/bevyengine/bevy for
+// https://github.com/bevyengine/bevy/tree/release-0.15.0/.
+func RepositoryURL(githubURL string) string {
+	for _, marker := range []string{"/tree/", "/blob/"} {
+		if i := strings.Index(githubURL, marker); i != -1 {
+			return githubURL[:i]
+		}
+	}
+	return strings.TrimSuffix(githubURL, "/")
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadWgslSpec(t *testing.T) {
+	assert.NoError(t, LoadWgslSpec(""))
+	assert.NotEmpty(t, WgslSpecVersion())
+
+	path := filepath.Join(t.TempDir(), "spec.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": `), 0644))
+	assert.EqualError(t, LoadWgslSpec(path), "failed to parse spec table "+path+": unexpected end of JSON input")
+
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	assert.ErrorContains(t, LoadWgslSpec(missing), "failed to read spec table "+missing)
+}
@@ -0,0 +1,133 @@
+package wgsl
+
+import (
+	"slices"
+	"strings"
+)
+
+// parseAttributes reads the attributes at the start of text, such as
+// `@builtin(position) @invariant` or `@workgroup_size(8, 8, #{N})`, and
+// returns them with the text following the last one. Comments between
+// attributes are skipped and arguments may nest parentheses.
+func parseAttributes(text string) ([]Annotation, string) {
+	annotations := make([]Annotation, 0)
+	lexemes := slices.DeleteFunc(SignificantLexemes(Lex(text)), isLineDirective)
+	rest := 0
+
+	for i := 0; i+1 < len(lexemes) && lexemes[i].Text == "@" && lexemes[i+1].Kind == LexIdent; {
+		annotation := Annotation{Name: lexemes[i+1].Text}
+		i += 2
+
+		if i < len(lexemes) && lexemes[i].Text == "(" {
+			closing := skipBalanced(lexemes, i, "(", ")")
+			if closing > len(lexemes) || lexemes[closing-1].Text != ")" {
+				break
+			}
+
+			annotation.Value = strings.TrimSpace(text[lexemes[i].Pos+1 : lexemes[closing-1].Pos])
+			annotation.Args = splitAttributeArgs(lexemes[i+1:closing-1], text)
+			i = closing
+		}
+
+		annotations = append(annotations, annotation)
+		rest = lexemes[i-1].Pos + len(lexemes[i-1].Text)
+	}
+
+	return annotations, strings.TrimSpace(text[rest:])
+}
+
+// splits the arguments of an attribute on the commas outside of nested
+// parentheses, a trailing comma is allowed
+func splitAttributeArgs(lexemes []Lexeme, text string) []string {
+	var args []string
+	depth := 0
+	start := 0
+
+	appendArg := func(end int) {
+		if start < end {
+			first, last := lexemes[start], lexemes[end-1]
+			args = append(args, text[first.Pos:last.Pos+len(last.Text)])
+		}
+		start = end + 1
+	}
+
+	for i, lexeme := range lexemes {
+		switch lexeme.Text {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ",":
+			if depth == 0 {
+				appendArg(i)
+			}
+		}
+	}
+	appendArg(len(lexemes))
+
+	return args
+}
+
+// attributesStart returns the offset of the first attribute preceding the
+// declaration keyword at pos, or pos when it has none. Shader def directives
+// between the attributes are skipped.
+func attributesStart(lexemes []Lexeme, pos int) int {
+	k := slices.IndexFunc(lexemes, func(v Lexeme) bool { return v.Pos == pos })
+	start := pos
+
+	for j := k - 1; j > 0; {
+		switch {
+		case isLineDirective(lexemes[j]):
+			j--
+			continue
+		case lexemes[j].Text == ")":
+			depth := 0
+			for ; j >= 0; j-- {
+				if lexemes[j].Text == ")" {
+					depth++
+				} else if lexemes[j].Text == "(" {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			j--
+		}
+
+		if j < 1 || lexemes[j].Kind != LexIdent || lexemes[j-1].Text != "@" {
+			break
+		}
+		start = lexemes[j-1].Pos
+		j -= 2
+	}
+
+	return start
+}
+
+func isLineDirective(lexeme Lexeme) bool {
+	return lexeme.Kind == LexDirective && !strings.HasPrefix(lexeme.Text, "#{")
+}
+
+func singleArgAnnotation(name, value string) Annotation {
+	return Annotation{Name: name, Value: value, Args: []string{value}}
+}
+
+func annotationValue(annotations []Annotation, name string) (string, bool) {
+	for _, annotation := range annotations {
+		if annotation.Name == name {
+			return annotation.Value, true
+		}
+	}
+	return "", false
+}
+
+// annotationArgs returns the arguments of the first attribute named name
+func annotationArgs(annotations []Annotation, name string) ([]string, bool) {
+	for _, annotation := range annotations {
+		if annotation.Name == name {
+			return annotation.Args, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,183 @@
+package wgsl
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	utils "main/utils"
+)
+
+const (
+	// pairs below this Jaccard similarity of normalized bodies are not reported
+	DuplicateSimilarityThreshold = 0.8
+	// bodies shorter than this, in normalized lexemes, are too small to matter
+	duplicateMinLexemes  = 16
+	duplicateShingleSize = 4
+)
+
+var duplicateKinds = []string{"exact", "renamed", "near"}
+
+var cloneKeywords = []string{
+	"let", "var", "const", "if", "else", "for", "while", "loop", "continuing", "break",
+	"continue", "return", "switch", "case", "default", "discard", "true", "false",
+}
+
+type DuplicateFunction struct {
+	Name       string `json:"name"`
+	Module     string `json:"module"`
+	Link       string `json:"link"`
+	SourceLink string `json:"sourceLink"`
+}
+
+// DuplicatePair reports two functions of different files with similar
+// bodies. Kind is `exact` for identical lexemes, `renamed` when only
+// identifiers and literals differ and `near` otherwise.
+type DuplicatePair struct {
+	Kind       string            `json:"kind"`
+	Similarity float64           `json:"similarity"`
+	A          DuplicateFunction `json:"a"`
+	B          DuplicateFunction `json:"b"`
+}
+
+type cloneCandidate struct {
+	file       *WgslFile
+	fn         *Function
+	raw        string
+	normalized string
+	shingles   map[string]bool
+}
+
+// FindDuplicates compares the normalized bodies of every function pair
+// declared in different files. Candidates are found through shared shingles
+// so that unrelated functions are never compared.
+func (registry *ModuleRegistry) FindDuplicates() []DuplicatePair {
+	var candidates []cloneCandidate
+	owners := make(map[string][]int)
+
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			raw, normalized := normalizeCloneLexemes(fn.Body)
+			if len(normalized) < duplicateMinLexemes {
+				continue
+			}
+
+			candidate := cloneCandidate{
+				file:       file,
+				fn:         fn,
+				raw:        strings.Join(raw, " "),
+				normalized: strings.Join(normalized, " "),
+				shingles:   make(map[string]bool),
+			}
+			for j := 0; j+duplicateShingleSize <= len(normalized); j++ {
+				candidate.shingles[strings.Join(normalized[j:j+duplicateShingleSize], " ")] = true
+			}
+
+			for shingle := range candidate.shingles {
+				owners[shingle] = append(owners[shingle], len(candidates))
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	var pairs []DuplicatePair
+
+	for i, a := range candidates {
+		shared := make(map[int]int)
+		for shingle := range a.shingles {
+			for _, j := range owners[shingle] {
+				if j > i {
+					shared[j]++
+				}
+			}
+		}
+
+		for j, count := range shared {
+			b := candidates[j]
+			if a.file == b.file {
+				continue
+			}
+
+			similarity := float64(count) / float64(len(a.shingles)+len(b.shingles)-count)
+			if similarity < DuplicateSimilarityThreshold {
+				continue
+			}
+
+			kind := "near"
+			switch {
+			case a.raw == b.raw:
+				kind, similarity = "exact", 1
+			case a.normalized == b.normalized:
+				kind, similarity = "renamed", 1
+			}
+
+			pairs = append(pairs, DuplicatePair{
+				Kind:       kind,
+				Similarity: math.Round(similarity*100) / 100,
+				A:          duplicateFunction(a),
+				B:          duplicateFunction(b),
+			})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Similarity != pairs[j].Similarity {
+			return pairs[i].Similarity > pairs[j].Similarity
+		}
+		if pairs[i].Kind != pairs[j].Kind {
+			return slices.Index(duplicateKinds, pairs[i].Kind) < slices.Index(duplicateKinds, pairs[j].Kind)
+		}
+		if pairs[i].A.Link != pairs[j].A.Link {
+			return pairs[i].A.Link < pairs[j].A.Link
+		}
+		return pairs[i].B.Link < pairs[j].B.Link
+	})
+
+	return pairs
+}
+
+func duplicateFunction(candidate cloneCandidate) DuplicateFunction {
+	return DuplicateFunction{
+		Name:       candidate.fn.Name,
+		Module:     candidate.file.ModuleName(),
+		Link:       candidate.file.ItemLink(candidate.fn.Name),
+		SourceLink: fmt.Sprintf("%s#L%d", candidate.file.GithubLink, candidate.fn.LineNumber),
+	}
+}
+
+// returns the significant lexemes of a body as written and with every
+// identifier other than a keyword, builtin function or builtin type replaced
+// by `$id` and every literal by `$lit`. Comments, whitespace and naga_oil
+// directives are dropped.
+func normalizeCloneLexemes(body string) ([]string, []string) {
+	lexemes := withoutDirectives(SignificantLexemes(Lex(body)))
+	raw := make([]string, 0, len(lexemes))
+	normalized := make([]string, 0, len(lexemes))
+
+	for i, lexeme := range lexemes {
+		raw = append(raw, lexeme.Text)
+		isCall := i+1 < len(lexemes) && lexemes[i+1].Text == "("
+
+		switch {
+		case lexeme.Kind == LexNumber:
+			normalized = append(normalized, "$lit")
+		case lexeme.Kind == LexIdent && !isCloneKeyword(lexeme.Text, isCall):
+			normalized = append(normalized, "$id")
+		default:
+			normalized = append(normalized, lexeme.Text)
+		}
+	}
+
+	return raw, normalized
+}
+
+// builtin function names are only kept where they are called, since locals
+// such as `sign` or `step` often shadow them
+func isCloneKeyword(ident string, isCall bool) bool {
+	return slices.Contains(cloneKeywords, ident) ||
+		(isCall && utils.GetBuiltinFunctionLink(ident) != "") ||
+		utils.GetTypeComponentLink(ident) != ""
+}
@@ -0,0 +1,724 @@
+package wgsl
+
+import (
+	"encoding/base32"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	lo "github.com/samber/lo"
+)
+
+const nagaOilModTag = "X_naga_oil_mod_X"
+
+var nagaOilEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var shaderDefSubstitutionPattern = regexp.MustCompile(`#\{\s*(\w+)\s*\}`)
+var shaderDefComparisonPattern = regexp.MustCompile(`^(\w+)\s*(==|!=|<=|>=|<|>)\s*(\S+)$`)
+
+// ComposedShader is a root module with every item it needs from imported
+// modules inlined under naga_oil's mangled names.
+type ComposedShader struct {
+	Root       string            `json:"root"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+	ShaderDefs map[string]string `json:"shaderDefs"`
+	Source     string            `json:"-"`
+	// one entry per line of Source
+	SourceMap []SourceMapping `json:"sourceMap"`
+}
+
+// SourceMapping points a line of the composed shader back to its origin,
+// generated lines have no module.
+type SourceMapping struct {
+	Line       int    `json:"line"`
+	Module     string `json:"module,omitempty"`
+	File       string `json:"file,omitempty"`
+	SourceLine int    `json:"sourceLine,omitempty"`
+	Link       string `json:"link,omitempty"`
+}
+
+// MangleName applies naga_oil's scheme for items of imported modules:
+// `name` + `X_naga_oil_mod_X` + base32(module path) + `X`.
+func MangleName(module, name string) string {
+	return name + nagaOilModTag + nagaOilEncoding.EncodeToString([]byte(module)) + "X"
+}
+
+// ParseShaderDefs reads `A,B=3,C=false` into a def set, defs without a value
+// are `true`.
+func ParseShaderDefs(value string) map[string]string {
+	defs := make(map[string]string)
+
+	for _, def := range strings.Split(value, ",") {
+		name, defValue, hasValue := strings.Cut(strings.TrimSpace(def), "=")
+		if name == "" {
+			continue
+		}
+		if !hasValue {
+			defValue = "true"
+		}
+		defs[strings.TrimSpace(name)] = strings.TrimSpace(defValue)
+	}
+
+	return defs
+}
+
+type sourceLine struct {
+	text string
+	line int
+}
+
+type composerItem struct {
+	name string
+	// `override fn a::b::f` replaces f of module a::b
+	overrides string
+	start     int
+	end       int
+	lexemes   []Lexeme
+}
+
+type composerModule struct {
+	file    *WgslFile
+	name    string
+	root    bool
+	text    string
+	lines   []int
+	imports DeclaredImports
+	items   []*composerItem
+	loading bool
+}
+
+type composerRef struct {
+	module *composerModule
+	item   string
+}
+
+type composer struct {
+	registry  *ModuleRegistry
+	defs      map[string]string
+	modules   map[*WgslFile]*composerModule
+	order     []*composerModule
+	overrides map[composerRef]composerRef
+}
+
+// Compose emulates naga_oil's composer: the root file and every module it
+// imports are preprocessed with the given shader defs, imported items are
+// inlined under their mangled names and `override fn` declarations replace
+// the functions they target. With an entry point only the items it reaches
+// are emitted.
+func (registry *ModuleRegistry) Compose(root *WgslFile, entryPoint string, defs map[string]string) (*ComposedShader, error) {
+	c := &composer{
+		registry:  registry,
+		defs:      defs,
+		modules:   make(map[*WgslFile]*composerModule),
+		overrides: make(map[composerRef]composerRef),
+	}
+
+	rootModule, err := c.load(root, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, module := range c.order {
+		for _, item := range module.items {
+			if item.overrides == "" {
+				continue
+			}
+			target, ok := c.resolve(module, item.overrides)
+			if !ok {
+				return nil, fmt.Errorf("%s: override target `%s` not found", module.name, item.overrides)
+			}
+			c.overrides[target] = composerRef{module, item.name}
+		}
+	}
+
+	required := make(map[composerRef]bool)
+	rewritten := make(map[*composerItem]string)
+	var queue []composerRef
+
+	for _, item := range rootModule.items {
+		if entryPoint == "" || item.name == entryPoint || item.name == "" {
+			queue = append(queue, composerRef{rootModule, item.name})
+		}
+	}
+	if entryPoint != "" && !slices.ContainsFunc(rootModule.items, func(v *composerItem) bool { return v.name == entryPoint }) {
+		return nil, fmt.Errorf("%s: entry point `%s` not found", rootModule.name, entryPoint)
+	}
+
+	for len(queue) > 0 {
+		ref := queue[0]
+		queue = queue[1:]
+		if required[ref] {
+			continue
+		}
+		required[ref] = true
+
+		for _, item := range ref.module.items {
+			if item.name != ref.item {
+				continue
+			}
+
+			text, deps := c.rewrite(ref.module, item)
+			rewritten[item] = text
+			queue = append(queue, deps...)
+		}
+	}
+
+	composed := &ComposedShader{
+		Root:       rootModule.name,
+		EntryPoint: entryPoint,
+		ShaderDefs: defs,
+	}
+
+	var out strings.Builder
+	// module is nil for generated lines, firstLine indexes module.lines
+	emit := func(text string, module *composerModule, firstLine int) {
+		for i, line := range strings.Split(text, "\n") {
+			out.WriteString(line + "\n")
+
+			mapping := SourceMapping{Line: len(composed.SourceMap) + 1}
+			if module != nil {
+				mapping.Module = module.name
+				mapping.File = module.file.FilePath
+				mapping.SourceLine = module.lines[firstLine+i]
+				if module.file.GithubLink != "" {
+					mapping.Link = fmt.Sprintf("%s#L%d", module.file.GithubLink, mapping.SourceLine)
+				}
+			}
+			composed.SourceMap = append(composed.SourceMap, mapping)
+		}
+	}
+
+	for _, module := range c.order {
+		emitted := false
+
+		for _, item := range module.items {
+			ref := composerRef{module, item.name}
+			if !required[ref] {
+				continue
+			}
+			if !emitted {
+				emit(fmt.Sprintf("// module %s", module.name), nil, 0)
+				emitted = true
+			} else {
+				emit("", nil, 0)
+			}
+
+			emit(rewritten[item], module, strings.Count(module.text[:item.start], "\n"))
+		}
+
+		if emitted {
+			emit("", nil, 0)
+		}
+	}
+
+	composed.Source = strings.TrimRight(out.String(), "\n") + "\n"
+	composed.SourceMap = composed.SourceMap[:strings.Count(composed.Source, "\n")]
+
+	return composed, nil
+}
+
+// load preprocesses a module and, depth first, the modules it imports so
+// that dependencies come before their users in c.order
+func (c *composer) load(file *WgslFile, root bool) (*composerModule, error) {
+	if module, ok := c.modules[file]; ok {
+		if module.loading {
+			return nil, fmt.Errorf("%s: circular import", module.name)
+		}
+		return module, nil
+	}
+
+	if file.Language != LanguageWGSL && file.Language != "" {
+		return nil, fmt.Errorf("%s: only naga_oil WGSL modules can be composed, found %s", file.ModuleName(), file.Language)
+	}
+
+	module := &composerModule{file: file, name: file.ModuleName(), root: root, loading: true}
+	c.modules[file] = module
+
+	lines, err := preprocessShaderDefs(readSourceFile(file.FilePath), c.defs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", module.name, err)
+	}
+
+	var text strings.Builder
+	for i, line := range blankImportDirectives(lines) {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(line.text)
+		module.lines = append(module.lines, line.line)
+	}
+
+	module.imports, err = ExtractAllImports(joinSourceLines(lines))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", module.name, err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(module.imports)) {
+		for _, path := range module.imports[name] {
+			target := c.importedModule(path)
+			if target == nil {
+				return nil, fmt.Errorf("%s: unresolved import `%s`", module.name, path)
+			}
+			if _, err := c.load(target, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	module.text = text.String()
+	module.items = splitTopLevelItems(module.text)
+	module.loading = false
+	c.order = append(c.order, module)
+
+	return module, nil
+}
+
+// module an import path refers to, either the module itself or the module
+// declaring the imported item
+func (c *composer) importedModule(path string) *WgslFile {
+	if file, ok := c.registry.Modules[path]; ok {
+		return file
+	}
+
+	var longestMatch string
+	for module := range c.registry.Modules {
+		if strings.HasPrefix(path, module+"::") && len(module) > len(longestMatch) {
+			longestMatch = module
+		}
+	}
+
+	return c.registry.Modules[longestMatch]
+}
+
+// resolves an identifier used in module to the item it names, local items
+// first, then imports and finally absolute module paths
+func (c *composer) resolve(module *composerModule, ident string) (composerRef, bool) {
+	head, rest, qualified := strings.Cut(ident, "::")
+
+	if !qualified {
+		if module.declares(ident) {
+			return composerRef{module, ident}, true
+		}
+		if paths, ok := module.imports[ident]; ok && len(paths) > 0 {
+			return c.resolvePath(paths[0])
+		}
+		return composerRef{}, false
+	}
+
+	if paths, ok := module.imports[head]; ok && len(paths) > 0 {
+		return c.resolvePath(paths[0] + "::" + rest)
+	}
+
+	return c.resolvePath(ident)
+}
+
+func (c *composer) resolvePath(path string) (composerRef, bool) {
+	idx := strings.LastIndex(path, "::")
+	if idx == -1 {
+		return composerRef{}, false
+	}
+
+	file, ok := c.registry.Modules[path[:idx]]
+	if !ok {
+		return composerRef{}, false
+	}
+
+	module, ok := c.modules[file]
+	if !ok || !module.declares(path[idx+2:]) {
+		return composerRef{}, false
+	}
+
+	return composerRef{module, path[idx+2:]}, true
+}
+
+func (module *composerModule) declares(name string) bool {
+	return slices.ContainsFunc(module.items, func(v *composerItem) bool {
+		return v.name == name && v.overrides == ""
+	})
+}
+
+// name an item is emitted under
+func (c *composer) outputName(ref composerRef) string {
+	if ref.module.root {
+		return ref.item
+	}
+	return MangleName(ref.module.name, ref.item)
+}
+
+// rewrite renames every module-scope reference of an item to the name it
+// gets in the composed shader and returns the items it depends on. Struct
+// members, parameters, locals, member accesses and attribute arguments are
+// left alone.
+func (c *composer) rewrite(module *composerModule, item *composerItem) (string, []composerRef) {
+	var out strings.Builder
+	var deps []composerRef
+
+	significant := SignificantLexemes(item.lexemes)
+	locals := make(map[string]bool)
+	depth := 0
+	cursor := item.start
+	sigIdx := -1
+
+	for _, lexeme := range item.lexemes {
+		if lexeme.Kind != LexWhitespace && lexeme.Kind != LexComment {
+			sigIdx++
+		}
+
+		switch lexeme.Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+
+		if lexeme.Kind != LexIdent || sigIdx < 0 {
+			continue
+		}
+
+		prev := func(n int) string {
+			if sigIdx-n < 0 {
+				return ""
+			}
+			return significant[sigIdx-n].Text
+		}
+		next := ""
+		if sigIdx+1 < len(significant) {
+			next = significant[sigIdx+1].Text
+		}
+
+		if slices.Contains(declarationKeywords, prev(1)) && depth > 0 {
+			locals[lexeme.Text] = true
+			continue
+		}
+
+		switch {
+		case prev(1) == "." || prev(1) == "@" || locals[lexeme.Text]:
+			continue
+		case prev(1) == "(" && prev(3) == "@":
+			continue
+		case next == ":" && depth > 0:
+			if isParameterPosition(significant, sigIdx) {
+				locals[lexeme.Text] = true
+			}
+			continue
+		}
+
+		ref, ok := c.resolve(module, lexeme.Text)
+		if item.overrides != "" && lexeme.Text == item.overrides && prev(1) == "fn" {
+			ref, ok = composerRef{module, item.name}, true
+		}
+		if !ok {
+			continue
+		}
+		if override, ok := c.overrides[ref]; ok && override.module != module && !(prev(1) == "fn" && depth == 0) {
+			ref = override
+		}
+
+		deps = append(deps, ref)
+		out.WriteString(module.text[cursor:lexeme.Pos])
+		out.WriteString(c.outputName(ref))
+		cursor = lexeme.Pos + len(lexeme.Text)
+	}
+
+	out.WriteString(module.text[cursor:item.end])
+	text := out.String()
+
+	if item.overrides != "" {
+		text = strings.Replace(text, "override fn", "fn", 1)
+	}
+
+	return text, deps
+}
+
+// parameters shadow module-scope names inside the function body, struct
+// members never do
+func isParameterPosition(significant []Lexeme, i int) bool {
+	depth := 0
+	for j := i - 1; j >= 0; j-- {
+		switch significant[j].Text {
+		case ")", "]", "}":
+			depth++
+		case "[", "{":
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case "(":
+			if depth == 0 {
+				return true
+			}
+			depth--
+		}
+	}
+	return false
+}
+
+// splitTopLevelItems cuts preprocessed module source into module-scope
+// declarations, each starting with the comments and attributes above it
+func splitTopLevelItems(text string) []*composerItem {
+	var items []*composerItem
+	lexemes := Lex(text)
+
+	start := -1
+	depth := 0
+	sawBody := false
+
+	closeItem := func(endIdx int) {
+		end := lexemes[endIdx].Pos + len(lexemes[endIdx].Text)
+		first := start
+		for first < endIdx && lexemes[first].Kind == LexWhitespace {
+			first++
+		}
+
+		item := &composerItem{start: lexemes[first].Pos, end: end, lexemes: lexemes[first : endIdx+1]}
+		item.name, item.overrides = itemName(SignificantLexemes(item.lexemes))
+		items = append(items, item)
+
+		start = -1
+		sawBody = false
+	}
+
+	for i, lexeme := range lexemes {
+		if lexeme.Kind == LexDirective {
+			continue
+		}
+		if start == -1 {
+			if lexeme.Kind == LexWhitespace {
+				continue
+			}
+			start = i
+		}
+		if lexeme.Kind == LexComment || lexeme.Kind == LexWhitespace {
+			continue
+		}
+
+		switch lexeme.Text {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case "{":
+			depth++
+			sawBody = true
+		case "}":
+			depth--
+			if depth == 0 && sawBody {
+				closeItem(i)
+			}
+		case ";":
+			if depth == 0 {
+				closeItem(i)
+			}
+		}
+	}
+
+	// trailing `;` after a struct body
+	return slices.DeleteFunc(items, func(v *composerItem) bool {
+		return len(SignificantLexemes(v.lexemes)) == 1 && v.name == "" && SignificantLexemes(v.lexemes)[0].Text == ";"
+	})
+}
+
+// name declared by an item, skipping its attributes
+func itemName(lexemes []Lexeme) (string, string) {
+	i := 0
+	for i+1 < len(lexemes) && lexemes[i].Text == "@" {
+		i += 2
+		if i < len(lexemes) && lexemes[i].Text == "(" {
+			i = skipBalanced(lexemes, i, "(", ")")
+		}
+	}
+
+	if i+1 < len(lexemes) && lexemes[i].Text == "override" && lexemes[i+1].Text == "fn" && i+2 < len(lexemes) {
+		target := lexemes[i+2].Text
+		return target[strings.LastIndex(target, ":")+1:], target
+	}
+
+	for i < len(lexemes) {
+		switch lexemes[i].Text {
+		case "fn", "struct", "const", "override", "alias", "let":
+			if i+1 < len(lexemes) {
+				return lexemes[i+1].Text, ""
+			}
+		case "var":
+			j := i + 1
+			if j < len(lexemes) && lexemes[j].Text == "<" {
+				for j < len(lexemes) && lexemes[j].Text != ">" {
+					j++
+				}
+				j++
+			}
+			if j < len(lexemes) {
+				return lexemes[j].Text, ""
+			}
+		}
+		i++
+	}
+
+	return "", ""
+}
+
+// preprocessShaderDefs evaluates naga_oil's `#ifdef`, `#ifndef`, `#if`,
+// `#else [if...]`, `#endif` and `#define` directives and substitutes `#{DEF}`,
+// keeping the original line number of every active line
+func preprocessShaderDefs(code string, defs map[string]string) ([]sourceLine, error) {
+	type frame struct {
+		active bool
+		parent bool
+		taken  bool
+	}
+
+	localDefs := make(map[string]string, len(defs))
+	for name, value := range defs {
+		localDefs[name] = value
+	}
+
+	var result []sourceLine
+	var stack []frame
+	active := true
+
+	for i, line := range strings.Split(code, "\n") {
+		trimmed := strings.TrimSpace(line)
+		directive, args, _ := strings.Cut(trimmed, " ")
+		args = strings.TrimSpace(args)
+
+		switch directive {
+		case "#ifdef", "#ifndef", "#if":
+			cond := evalShaderDefCondition(directive, args, localDefs)
+			stack = append(stack, frame{active: active && cond, parent: active, taken: cond})
+			active = active && cond
+			continue
+
+		case "#else":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: #else without #ifdef", i+1)
+			}
+			top := &stack[len(stack)-1]
+			cond := true
+			if args != "" {
+				nested, nestedArgs, _ := strings.Cut(args, " ")
+				cond = evalShaderDefCondition("#"+nested, strings.TrimSpace(nestedArgs), localDefs)
+			}
+			top.active = top.parent && !top.taken && cond
+			top.taken = top.taken || cond
+			active = top.active
+			continue
+
+		case "#endif":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: #endif without #ifdef", i+1)
+			}
+			active = stack[len(stack)-1].parent
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		if !active {
+			continue
+		}
+
+		if directive == "#define" {
+			name, value, _ := strings.Cut(args, " ")
+			localDefs[name] = lo.CoalesceOrEmpty(strings.TrimSpace(value), "true")
+			continue
+		}
+
+		line = shaderDefSubstitutionPattern.ReplaceAllStringFunc(line, func(match string) string {
+			name := shaderDefSubstitutionPattern.FindStringSubmatch(match)[1]
+			if value, ok := localDefs[name]; ok {
+				return value
+			}
+			return match
+		})
+
+		result = append(result, sourceLine{text: line, line: i + 1})
+	}
+
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("missing #endif")
+	}
+
+	return result, nil
+}
+
+func evalShaderDefCondition(directive, args string, defs map[string]string) bool {
+	switch directive {
+	case "#ifdef":
+		_, ok := defs[args]
+		return ok
+	case "#ifndef":
+		_, ok := defs[args]
+		return !ok
+	}
+
+	match := shaderDefComparisonPattern.FindStringSubmatch(args)
+	if match == nil {
+		value, ok := defs[args]
+		return ok && value != "false"
+	}
+
+	value, ok := defs[match[1]]
+	if !ok {
+		return false
+	}
+
+	a, errA := strconv.Atoi(value)
+	b, errB := strconv.Atoi(match[3])
+	if errA == nil && errB == nil {
+		switch match[2] {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	}
+
+	switch match[2] {
+	case "==":
+		return value == match[3]
+	case "!=":
+		return value != match[3]
+	}
+
+	return false
+}
+
+// blanks `#import` blocks, including the lines of multi-line imports, and
+// `#define_import_path` so only WGSL remains
+func blankImportDirectives(lines []sourceLine) []sourceLine {
+	result := make([]sourceLine, len(lines))
+	depth := 0
+
+	for i, line := range lines {
+		result[i] = line
+		trimmed := strings.TrimSpace(line.text)
+
+		switch {
+		case strings.HasPrefix(trimmed, "#import") || depth > 0:
+			depth += strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+			result[i].text = ""
+		case strings.HasPrefix(trimmed, "#define_import_path"):
+			result[i].text = ""
+		}
+	}
+
+	return result
+}
+
+func joinSourceLines(lines []sourceLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,108 @@
+package wgsl
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Span locates a diagnostic in its source file, lines and columns are 1-based
+// and EndColumn is exclusive.
+type Span struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	// analysis that produced the diagnostic, e.g. `uniformity`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Module  string `json:"module"`
+	File    string `json:"file"`
+	Item    string `json:"item,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Span    Span   `json:"span"`
+	// shader def branches the diagnostic only applies to
+	ShaderDefs []DefResult `json:"shaderDefs,omitempty"`
+}
+
+// DiagnosticCollector gathers the diagnostics of every analysis. It is safe to
+// use from the goroutines generating pages.
+type DiagnosticCollector struct {
+	mu          sync.Mutex
+	diagnostics []Diagnostic
+}
+
+func (collector *DiagnosticCollector) Add(diagnostic Diagnostic) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.diagnostics = append(collector.diagnostics, diagnostic)
+}
+
+// All returns the diagnostics sorted by file and position.
+func (collector *DiagnosticCollector) All() []Diagnostic {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	diagnostics := append([]Diagnostic{}, collector.diagnostics...)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Span.Line != b.Span.Line {
+			return a.Span.Line < b.Span.Line
+		}
+		return a.Span.Column < b.Span.Column
+	})
+
+	return diagnostics
+}
+
+// newDiagnostic locates a diagnostic on the lexemes start..end of a function
+// body and records the shader def branches enclosing it.
+func newDiagnostic(file *WgslFile, fn *Function, lexemes []Lexeme, start, end int, code, message string) Diagnostic {
+	first, last := lexemes[start], lexemes[end]
+	line := fn.BodyStartLine + first.Line - 1
+
+	return Diagnostic{
+		Severity: SeverityWarning,
+		Code:     code,
+		Message:  message,
+		Module:   file.ModuleName(),
+		File:     file.FilePath,
+		Item:     fn.Name,
+		Link:     file.ItemLink(fn.Name),
+		Span: Span{
+			Line:      line,
+			Column:    bodyColumn(fn, first.Pos),
+			EndLine:   fn.BodyStartLine + last.Line - 1,
+			EndColumn: bodyColumn(fn, last.Pos+len(last.Text)),
+		},
+		ShaderDefs: getShaderDefsByLine(file.ShaderDefBlocks, line),
+	}
+}
+
+// column in the source file of a byte offset in the body of fn
+func bodyColumn(fn *Function, pos int) int {
+	lineStart := -1
+	for i := pos - 1; i >= 0; i-- {
+		if fn.Body[i] == '\n' {
+			lineStart = i
+			break
+		}
+	}
+
+	if lineStart == -1 {
+		return fn.BodyStartColumn + pos
+	}
+	return pos - lineStart
+}
@@ -0,0 +1,216 @@
+package wgsl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	utils "main/utils"
+)
+
+// [`item`], [`module::item`] or [item], an optional `()` is allowed after
+// function names
+var docLinkPattern = regexp.MustCompile("\\[(`?)([a-zA-Z_][a-zA-Z0-9_]*(?:::[a-zA-Z_][a-zA-Z0-9_]*)*)(\\(\\))?(`?)\\]")
+var issueReferencePattern = regexp.MustCompile(`(^|[\s(,;])#([0-9]+)\b`)
+var codeSpanPattern = regexp.MustCompile("`+[^`]*`+")
+
+// ResolveDocLinks rewrites the rustdoc style intra-doc links of every comment
+// into markdown links to the documented items, and issue references such as
+// `#1234` into links to the issues of repository. Links naming nothing are
+// left as they are and reported, except for the unquoted [name] form which is
+// common in prose. Formulas are left as they are.
+func (registry *ModuleRegistry) ResolveDocLinks(repository string) {
+	for _, file := range registry.Files {
+		forEachDocText(file, func(text *string, item string, line int) {
+			var builder strings.Builder
+			last := 0
+			for _, span := range utils.FindMath(*text) {
+				builder.WriteString(registry.rewriteDocLinks(file, (*text)[last:span.Start], repository, item, line))
+				builder.WriteString((*text)[span.Start:span.End])
+				last = span.End
+			}
+			builder.WriteString(registry.rewriteDocLinks(file, (*text)[last:], repository, item, line))
+			*text = builder.String()
+		})
+	}
+}
+
+// CheckMath reports the formulas of comments that are not valid TeX, they are
+// shown as code on the pages.
+func (registry *ModuleRegistry) CheckMath() {
+	for _, file := range registry.Files {
+		forEachDocText(file, func(text *string, item string, line int) {
+			for _, span := range utils.FindMath(*text) {
+				if _, err := utils.TexToMathML(span.Tex, span.Display); err != nil {
+					registry.Diagnostics.Add(Diagnostic{
+						Severity: SeverityWarning,
+						Code:     "malformed-math",
+						Message:  fmt.Sprintf("malformed TeX `%s`: %s", span.Tex, err),
+						Module:   file.ModuleName(),
+						File:     file.FilePath,
+						Item:     item,
+						Link:     file.ItemLink(item),
+						Span:     Span{Line: line, EndLine: line},
+					})
+				}
+			}
+		})
+	}
+}
+
+// CheckCommentMarkup reports the comments whose HTML was stripped by the
+// sanitizer when rendered, it runs after the comments are highlighted.
+func (registry *ModuleRegistry) CheckCommentMarkup() {
+	for _, file := range registry.Files {
+		forEachDocText(file, func(text *string, item string, line int) {
+			if _, stripped := utils.RenderMarkdown(*text); len(stripped) > 0 {
+				registry.Diagnostics.Add(Diagnostic{
+					Severity: SeverityWarning,
+					Code:     "stripped-markup",
+					Message:  fmt.Sprintf("stripped %s from the documentation", strings.Join(stripped, ", ")),
+					Module:   file.ModuleName(),
+					File:     file.FilePath,
+					Item:     item,
+					Link:     file.ItemLink(item),
+					Span:     Span{Line: line, EndLine: line},
+				})
+			}
+		})
+	}
+}
+
+// calls visit with every markdown text documenting file or one of its items,
+// the name and line of the item. The module documentation has no item name.
+func forEachDocText(file *WgslFile, visit func(text *string, item string, line int)) {
+	if file.ModuleDoc != "" {
+		visit(&file.ModuleDoc, "", file.ModuleDocLine)
+	}
+	for i := range file.Functions {
+		fn := &file.Functions[i]
+		visit(&fn.Comment, fn.Name, fn.LineNumber)
+		for j := range fn.Params {
+			visit(&fn.Params[j].Doc, fn.Name, fn.LineNumber)
+		}
+		visit(&fn.ReturnTypeInfo.Doc, fn.Name, fn.LineNumber)
+	}
+	for i := range file.Structures {
+		structure := &file.Structures[i]
+		visit(&structure.Comment, structure.Name, structure.LineNumber)
+	}
+	for i := range file.Consts {
+		constant := &file.Consts[i]
+		visit(&constant.Comment, constant.Name, constant.LineNumber)
+	}
+	for i := range file.Bindings {
+		binding := &file.Bindings[i]
+		visit(&binding.Comment, binding.Name, binding.LineNumber)
+	}
+}
+
+// rewrites the links of the markdown text documenting item, fenced code
+// blocks and code spans are kept as they are
+func (registry *ModuleRegistry) rewriteDocLinks(file *WgslFile, text, repository, item string, line int) string {
+	if text == "" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	fenced := false
+
+	for i, textLine := range lines {
+		if strings.HasPrefix(strings.TrimSpace(textLine), "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+
+		textLine = registry.rewriteIntraDocLinks(file, textLine, item, line)
+		if repository != "" {
+			textLine = rewriteOutsideCodeSpans(textLine, func(segment string) string {
+				return issueReferencePattern.ReplaceAllString(segment, "${1}[#${2}]("+repository+"/issues/${2})")
+			})
+		}
+		lines[i] = textLine
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (registry *ModuleRegistry) rewriteIntraDocLinks(file *WgslFile, text, item string, line int) string {
+	var builder strings.Builder
+	last := 0
+
+	for _, match := range docLinkPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[0], match[1]
+		openTick, path, closeTick := text[match[2]:match[3]], text[match[4]:match[5]], text[match[8]:match[9]]
+
+		// markdown links, reference definitions and unbalanced backticks
+		if openTick != closeTick || (end < len(text) && strings.ContainsRune("([:", rune(text[end]))) {
+			continue
+		}
+
+		link, ok := registry.resolveDocLink(file, path)
+		if !ok {
+			if openTick != "" {
+				registry.Diagnostics.Add(Diagnostic{
+					Severity: SeverityWarning,
+					Code:     "unresolved-doc-link",
+					Message:  fmt.Sprintf("doc link [`%s`] does not name an item", path),
+					Module:   file.ModuleName(),
+					File:     file.FilePath,
+					Item:     item,
+					Link:     file.ItemLink(item),
+					Span:     Span{Line: line, EndLine: line},
+				})
+			}
+			continue
+		}
+
+		builder.WriteString(text[last:start])
+		builder.WriteString(text[start:end] + "(" + link + ")")
+		last = end
+	}
+	builder.WriteString(text[last:])
+
+	return builder.String()
+}
+
+// resolveDocLink returns the link of the item, module or WGSL builtin named
+// by path, as seen from file
+func (registry *ModuleRegistry) resolveDocLink(file *WgslFile, path string) (string, bool) {
+	if target, item, ok := registry.ResolveItem(file, path); ok {
+		return target.ItemLink(item), true
+	}
+	if module, ok := registry.Modules[path]; ok {
+		return utils.NormalizeLink(module.Link), true
+	}
+	if paths, ok := file.DeclaredImports[path]; ok && len(paths) > 0 {
+		if module, ok := registry.Modules[paths[0]]; ok {
+			return utils.NormalizeLink(module.Link), true
+		}
+	}
+	if link := utils.GetBuiltinFunctionLink(path); link != "" {
+		return link, true
+	}
+	if link := utils.GetTypeComponentLink(path); link != "" {
+		return link, true
+	}
+	return "", false
+}
+
+// applies rewrite to the parts of text outside of inline code spans
+func rewriteOutsideCodeSpans(text string, rewrite func(string) string) string {
+	var builder strings.Builder
+	last := 0
+
+	for _, span := range codeSpanPattern.FindAllStringIndex(text, -1) {
+		builder.WriteString(rewrite(text[last:span[0]]))
+		builder.WriteString(text[span[0]:span[1]])
+		last = span[1]
+	}
+	builder.WriteString(rewrite(text[last:]))
+
+	return builder.String()
+}
@@ -0,0 +1,220 @@
+package wgsl
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var docTagPattern = regexp.MustCompile(`^@(deprecated|internal|since|unstable)\b\s*(.*)$`)
+var paramTagPattern = regexp.MustCompile(`^@(?:param\s+([a-zA-Z0-9_]+)|returns?\b)\s*(.*)$`)
+
+// DocTags are the `@deprecated <reason>`, `@internal`, `@since <version>` and
+// `@unstable` lines of a doc comment.
+type DocTags struct {
+	Deprecated        bool   `json:"deprecated,omitempty"`
+	DeprecationReason string `json:"deprecationReason,omitempty"`
+	Internal          bool   `json:"internal,omitempty"`
+	Since             string `json:"since,omitempty"`
+	Unstable          bool   `json:"unstable,omitempty"`
+}
+
+// parseDocTags reads the tags of a comment, they must start a line. The
+// comment is returned without the tag lines.
+func parseDocTags(comment string) (DocTags, string) {
+	var tags DocTags
+	var lines []string
+
+	for _, line := range strings.Split(comment, "\n") {
+		match := docTagPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		switch match[1] {
+		case "deprecated":
+			tags.Deprecated = true
+			tags.DeprecationReason = match[2]
+		case "internal":
+			tags.Internal = true
+		case "since":
+			tags.Since = match[2]
+		case "unstable":
+			tags.Unstable = true
+		}
+	}
+
+	return tags, strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// paramDoc is the description of a `@param name` tag, an empty name is used
+// for `@returns`.
+type paramDoc struct {
+	name string
+	doc  string
+}
+
+// parseParamDocs reads the `@param name description` and `@returns
+// description` tags of a comment. A description continues on the following
+// lines up to a blank line or the next tag. The comment is returned without
+// the tags.
+func parseParamDocs(comment string) ([]paramDoc, string) {
+	var docs []paramDoc
+	var lines []string
+	continued := false
+
+	for _, line := range strings.Split(comment, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if match := paramTagPattern.FindStringSubmatch(trimmed); match != nil {
+			docs = append(docs, paramDoc{name: match[1], doc: match[2]})
+			continued = true
+			continue
+		}
+
+		if continued && trimmed != "" && !strings.HasPrefix(trimmed, "@") {
+			last := &docs[len(docs)-1]
+			last.doc = strings.TrimSpace(last.doc + " " + trimmed)
+			continue
+		}
+
+		continued = false
+		lines = append(lines, line)
+	}
+
+	return docs, strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// attaches the `@param` and `@returns` descriptions of the comment to the
+// params and return type, tags naming an unknown param are kept in
+// UnknownParamDocs
+func (fn *Function) extractParamDocs() {
+	docs, comment := parseParamDocs(fn.Comment)
+	fn.Comment = comment
+
+	for _, doc := range docs {
+		if doc.name == "" {
+			fn.ReturnTypeInfo.Doc = doc.doc
+			fn.HasParamDocs = true
+			continue
+		}
+
+		i := slices.IndexFunc(fn.Params, func(v NamedType) bool { return v.Name == doc.name })
+		if i == -1 {
+			fn.UnknownParamDocs = append(fn.UnknownParamDocs, doc.name)
+			continue
+		}
+		fn.Params[i].Doc = doc.doc
+		fn.HasParamDocs = true
+	}
+}
+
+// moves the tags of every item comment into its Tags
+func (items *sourceItems) extractDocTags() {
+	for i := range items.functions {
+		items.functions[i].Tags, items.functions[i].Comment = parseDocTags(items.functions[i].Comment)
+		items.functions[i].extractParamDocs()
+	}
+	for i := range items.structures {
+		items.structures[i].Tags, items.structures[i].Comment = parseDocTags(items.structures[i].Comment)
+	}
+	for i := range items.consts {
+		items.consts[i].Tags, items.consts[i].Comment = parseDocTags(items.consts[i].Comment)
+	}
+	for i := range items.bindings {
+		items.bindings[i].Tags, items.bindings[i].Comment = parseDocTags(items.bindings[i].Comment)
+	}
+}
+
+// ItemTags returns the tags of the function, structure, constant or binding
+// named name.
+func (wgslFile *WgslFile) ItemTags(name string) DocTags {
+	if i := slices.IndexFunc(wgslFile.Functions, func(v Function) bool { return v.Name == name }); i != -1 {
+		return wgslFile.Functions[i].Tags
+	}
+	if i := slices.IndexFunc(wgslFile.Structures, func(v Structure) bool { return v.Name == name }); i != -1 {
+		return wgslFile.Structures[i].Tags
+	}
+	if i := slices.IndexFunc(wgslFile.Consts, func(v Const) bool { return v.Name == name }); i != -1 {
+		return wgslFile.Consts[i].Tags
+	}
+	if i := slices.IndexFunc(wgslFile.Bindings, func(v Binding) bool { return v.Name == name }); i != -1 {
+		return wgslFile.Bindings[i].Tags
+	}
+	return DocTags{}
+}
+
+// CheckDeprecatedImports reports every import of a deprecated item, at the
+// first line of the importing module using it or else at the import.
+func (registry *ModuleRegistry) CheckDeprecatedImports() {
+	for _, file := range registry.Files {
+		firstUse := make(map[string]int)
+		for i := range file.Functions {
+			for _, ref := range scanBodyReferences(&file.Functions[i]) {
+				if line, ok := firstUse[ref.name]; !ok || ref.line < line {
+					firstUse[ref.name] = ref.line
+				}
+			}
+		}
+
+		idents := make([]string, 0, len(file.DeclaredImports))
+		for ident := range file.DeclaredImports {
+			idents = append(idents, ident)
+		}
+		slices.Sort(idents)
+
+		for _, ident := range idents {
+			target, item, ok := registry.ResolveItem(file, ident)
+			if !ok || target == file {
+				continue
+			}
+
+			tags := target.ItemTags(item)
+			if !tags.Deprecated {
+				continue
+			}
+
+			message := fmt.Sprintf("imports deprecated `%s::%s`", target.ModuleName(), item)
+			if tags.DeprecationReason != "" {
+				message += ": " + tags.DeprecationReason
+			}
+
+			line, ok := firstUse[ident]
+			if !ok {
+				line = file.ImportLines[ident]
+			}
+			registry.Diagnostics.Add(Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "deprecated-import",
+				Message:  message,
+				Module:   file.ModuleName(),
+				File:     file.FilePath,
+				Item:     ident,
+				Link:     target.ItemLink(item),
+				Span:     Span{Line: line, EndLine: line},
+			})
+		}
+	}
+}
+
+// CheckParamDocs reports every `@param` tag naming a parameter its function
+// does not have.
+func (registry *ModuleRegistry) CheckParamDocs() {
+	for _, file := range registry.Files {
+		for _, fn := range file.Functions {
+			for _, name := range fn.UnknownParamDocs {
+				registry.Diagnostics.Add(Diagnostic{
+					Severity: SeverityWarning,
+					Code:     "unknown-param-doc",
+					Message:  fmt.Sprintf("`@param %s` does not name a parameter of `%s`", name, fn.Name),
+					Module:   file.ModuleName(),
+					File:     file.FilePath,
+					Item:     fn.Name,
+					Link:     file.ItemLink(fn.Name),
+					Span:     Span{Line: fn.LineNumber, EndLine: fn.LineNumber},
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package wgsl
+
+import (
+	"fmt"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// the prefix of a family of flag constants, such as `MESH_FLAGS_`
+var flagFamilyPattern = regexp.MustCompile(`^(?:[A-Z0-9]+_)*?FLAGS?_`)
+
+// FlagGroup is a family of bitflag constants sharing a prefix, such as the
+// `MESH_FLAGS_*` ones, evaluated into masks.
+type FlagGroup struct {
+	// the prefix without its trailing `_`, e.g. MESH_FLAGS
+	Name   string      `json:"name"`
+	Anchor string      `json:"anchor"`
+	Flags  []FlagEntry `json:"flags"`
+	// every bit used by the group
+	Mask string `json:"mask"`
+	// unused bit ranges between the lowest and the highest used bit
+	Gaps        []string `json:"gaps,omitempty"`
+	HasOverlaps bool     `json:"hasOverlaps"`
+}
+
+// FlagEntry is one constant of a flag group.
+type FlagEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Mask  string `json:"mask"`
+	// bit positions, e.g. `29` or `29–31`, empty for zero values
+	Bits string `json:"bits"`
+	// the flags of the group sharing bits with this one
+	Overlaps []string `json:"overlaps,omitempty"`
+}
+
+// a constant of a flag group with its evaluated value
+type flagCandidate struct {
+	constant Const
+	value    uint64
+}
+
+// extractFlagGroups detects the families of bitflag constants of a module by
+// their shared prefix. Constants are candidates when they evaluate to an
+// integer and are written as a shift or hex literal, end with `_BIT` or
+// `_BITS`, or are named like `*_FLAGS_*`.
+func extractFlagGroups(consts []Const) []FlagGroup {
+	known := make(map[string]uint64)
+	var candidates []flagCandidate
+
+	for _, constant := range consts {
+		value, ok := evaluateFlagValue(constant.Value, known)
+		if !ok {
+			continue
+		}
+		known[constant.Name] = value
+
+		// shift amounts are not flags
+		if strings.Contains(constant.Name, "SHIFT") {
+			continue
+		}
+		written := strings.Contains(constant.Value, "<<") || strings.Contains(strings.ToLower(constant.Value), "0x")
+		named := strings.HasSuffix(constant.Name, "_BIT") || strings.HasSuffix(constant.Name, "_BITS") || flagFamilyPattern.MatchString(constant.Name)
+		if written || named {
+			candidates = append(candidates, flagCandidate{constant, value})
+		}
+	}
+
+	prefixes := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		var neighbours []string
+		if i > 0 {
+			neighbours = append(neighbours, candidates[i-1].constant.Name)
+		}
+		if i+1 < len(candidates) {
+			neighbours = append(neighbours, candidates[i+1].constant.Name)
+		}
+		prefixes[i] = flagGroupPrefix(candidate.constant.Name, neighbours)
+	}
+
+	var groups []FlagGroup
+	seen := make(map[string]bool)
+	for i, prefix := range prefixes {
+		if prefix == "" || seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+
+		var members []flagCandidate
+		for j := i; j < len(candidates); j++ {
+			if prefixes[j] == prefix {
+				members = append(members, candidates[j])
+			}
+		}
+		if len(members) > 1 {
+			groups = append(groups, newFlagGroup(strings.TrimSuffix(prefix, "_"), members))
+		}
+	}
+
+	return groups
+}
+
+// flagGroupPrefix returns the prefix of the family of name: up to `FLAGS_`
+// when the name has it, or else the longest word prefix shared with one of
+// the neighbouring candidates
+func flagGroupPrefix(name string, neighbours []string) string {
+	if prefix := flagFamilyPattern.FindString(name); prefix != "" {
+		return prefix
+	}
+
+	words := strings.SplitAfter(name, "_")
+	longest := ""
+	for _, neighbour := range neighbours {
+		prefix := ""
+		// the last word names the flag itself
+		for _, word := range words[:len(words)-1] {
+			if !strings.HasPrefix(neighbour[len(prefix):], word) {
+				break
+			}
+			prefix += word
+		}
+		if len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	return longest
+}
+
+func newFlagGroup(name string, members []flagCandidate) FlagGroup {
+	group := FlagGroup{Name: name, Anchor: "flags-" + name}
+
+	var used uint64
+	for i, member := range members {
+		entry := FlagEntry{
+			Name:  member.constant.Name,
+			Value: member.constant.Value,
+			Mask:  fmt.Sprintf("0x%08X", member.value),
+			Bits:  bitRanges(member.value),
+		}
+		for j, other := range members {
+			if i != j && member.value&other.value != 0 {
+				entry.Overlaps = append(entry.Overlaps, other.constant.Name)
+			}
+		}
+		group.HasOverlaps = group.HasOverlaps || len(entry.Overlaps) > 0
+		group.Flags = append(group.Flags, entry)
+		used |= member.value
+	}
+
+	group.Mask = fmt.Sprintf("0x%08X", used)
+	if used != 0 {
+		low, high := bits.TrailingZeros64(used), 63-bits.LeadingZeros64(used)
+		span := (uint64(1)<<(high-low+1) - 1) << low
+		if gaps := bitRanges(span &^ used); gaps != "" {
+			group.Gaps = strings.Split(gaps, ", ")
+		}
+	}
+
+	return group
+}
+
+// bitRanges describes the set bits of value, e.g. `0, 3–5`
+func bitRanges(value uint64) string {
+	var ranges []string
+	for bit := 0; bit < 64; bit++ {
+		if value&(1<<bit) == 0 {
+			continue
+		}
+		end := bit
+		for end+1 < 64 && value&(1<<(end+1)) != 0 {
+			end++
+		}
+		if end == bit {
+			ranges = append(ranges, strconv.Itoa(bit))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d–%d", bit, end))
+		}
+		bit = end
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// evaluateFlagValue evaluates an integer constant expression made of
+// literals, the constants in known, `|`, `&`, `^`, shifts, `+`, `-`, `~`
+// and conversions such as `u32(…)`. Results are truncated to 32 bits.
+func evaluateFlagValue(value string, known map[string]uint64) (uint64, bool) {
+	evaluator := flagEvaluator{lexemes: SignificantLexemes(Lex(value)), known: known}
+	result := evaluator.or()
+	if evaluator.failed || evaluator.pos != len(evaluator.lexemes) {
+		return 0, false
+	}
+	return result & 0xFFFFFFFF, true
+}
+
+type flagEvaluator struct {
+	lexemes []Lexeme
+	pos     int
+	known   map[string]uint64
+	failed  bool
+}
+
+func (e *flagEvaluator) peek(offset int) string {
+	if e.pos+offset < len(e.lexemes) {
+		return e.lexemes[e.pos+offset].Text
+	}
+	return ""
+}
+
+func (e *flagEvaluator) or() uint64 {
+	result := e.xor()
+	for e.peek(0) == "|" {
+		e.pos++
+		result |= e.xor()
+	}
+	return result
+}
+
+func (e *flagEvaluator) xor() uint64 {
+	result := e.and()
+	for e.peek(0) == "^" {
+		e.pos++
+		result ^= e.and()
+	}
+	return result
+}
+
+func (e *flagEvaluator) and() uint64 {
+	result := e.shift()
+	for e.peek(0) == "&" {
+		e.pos++
+		result &= e.shift()
+	}
+	return result
+}
+
+// `<<` and `>>` are lexed as two `<` or `>` because of template lists
+func (e *flagEvaluator) shift() uint64 {
+	result := e.sum()
+	for {
+		switch op := e.peek(0); {
+		case (op == "<" || op == ">") && e.peek(1) == op:
+			e.pos += 2
+			amount := e.sum()
+			if amount >= 64 {
+				e.failed = true
+				return 0
+			}
+			if op == "<" {
+				result <<= amount
+			} else {
+				result >>= amount
+			}
+		default:
+			return result
+		}
+	}
+}
+
+func (e *flagEvaluator) sum() uint64 {
+	result := e.unary()
+	for {
+		switch e.peek(0) {
+		case "+":
+			e.pos++
+			result += e.unary()
+		case "-":
+			e.pos++
+			result -= e.unary()
+		default:
+			return result
+		}
+	}
+}
+
+func (e *flagEvaluator) unary() uint64 {
+	if e.peek(0) == "~" {
+		e.pos++
+		return ^e.unary()
+	}
+	return e.primary()
+}
+
+func (e *flagEvaluator) primary() uint64 {
+	if e.pos >= len(e.lexemes) {
+		e.failed = true
+		return 0
+	}
+	lexeme := e.lexemes[e.pos]
+	e.pos++
+
+	switch {
+	case lexeme.Kind == LexNumber:
+		text := strings.TrimRight(lexeme.Text, "ui")
+		value, err := strconv.ParseUint(text, 0, 64)
+		if err != nil {
+			e.failed = true
+		}
+		return value
+	case lexeme.Text == "(":
+		result := e.or()
+		e.expect(")")
+		return result
+	case lexeme.Kind == LexIdent && (lexeme.Text == "u32" || lexeme.Text == "i32") && e.peek(0) == "(":
+		e.pos++
+		result := e.or()
+		e.expect(")")
+		return result
+	case lexeme.Kind == LexIdent:
+		if value, ok := e.known[lexeme.Text]; ok {
+			return value
+		}
+	}
+
+	e.failed = true
+	return 0
+}
+
+func (e *flagEvaluator) expect(text string) {
+	if e.peek(0) != text {
+		e.failed = true
+		return
+	}
+	e.pos++
+}
+
+// LinkFlagGroups links the struct fields named `flags` or `*_flags` to the
+// flag group they hold: `mesh_flags` to MESH_FLAGS, `flags` of `Mesh` to
+// MESH_FLAGS, or else the only group of the module.
+func (registry *ModuleRegistry) LinkFlagGroups() {
+	for _, file := range registry.Files {
+		for i := range file.Structures {
+			structure := &file.Structures[i]
+			for j := range structure.Fields {
+				field := &structure.Fields[j]
+				if field.Name != "flags" && !strings.HasSuffix(field.Name, "_flags") {
+					continue
+				}
+
+				names := []string{screamingCase(structure.Name) + "_FLAGS"}
+				if field.Name != "flags" {
+					names = append([]string{strings.ToUpper(field.Name)}, names...)
+				}
+				if len(file.FlagGroups) == 1 {
+					names = append(names, file.FlagGroups[0].Name)
+				}
+
+				if target, group, ok := registry.findFlagGroup(file, names); ok {
+					field.FlagGroupName = group.Name
+					field.FlagGroupLink = target.ItemLink(group.Anchor)
+				}
+			}
+		}
+	}
+}
+
+// returns the first group named in names, looked up in file before the
+// other modules
+func (registry *ModuleRegistry) findFlagGroup(file *WgslFile, names []string) (*WgslFile, FlagGroup, bool) {
+	for _, name := range names {
+		for _, group := range file.FlagGroups {
+			if group.Name == name {
+				return file, group, true
+			}
+		}
+		for _, other := range registry.Files {
+			for _, group := range other.FlagGroups {
+				if group.Name == name {
+					return other, group, true
+				}
+			}
+		}
+	}
+	return nil, FlagGroup{}, false
+}
+
+// StandardMaterial becomes STANDARD_MATERIAL
+func screamingCase(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			builder.WriteRune('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return builder.String()
+}
@@ -0,0 +1,551 @@
+package wgsl
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	config "main/config"
+
+	lo "github.com/samber/lo"
+)
+
+const (
+	LanguageWGSL = "wgsl"
+	LanguageGLSL = "glsl"
+)
+
+// extensions naga_oil and shaderc accept for GLSL modules, the stage ones
+// also decide the stage of `main`
+var glslExtensions = map[string]string{
+	".glsl": "",
+	".vert": "vertex",
+	".frag": "fragment",
+	".comp": "compute",
+}
+
+var glslStructPattern = regexp.MustCompile(`(?m)^[ \t]*struct\s+(\w+)\s*\{([^}]*)\}\s*;`)
+var glslConstPattern = regexp.MustCompile(`(?m)^[ \t]*const\s+(?:(?:highp|mediump|lowp)\s+)?(\w+)\s+(\w+)\s*(\[[^\]]*\])?\s*=\s*([^;]+);`)
+var glslFunctionPattern = regexp.MustCompile(`(?m)^[ \t]*(?:(?:highp|mediump|lowp)\s+)?(\w+)\s+(\w+)\s*\(([^)]*)\)\s*\{`)
+var glslBlockPattern = regexp.MustCompile(`(?m)^[ \t]*layout\s*\(([^)]*)\)\s*((?:\w+\s+)*?)(uniform|buffer)\s+(\w+)\s*\{([^}]*)\}\s*(\w+)?\s*(\[[^\]]*\])?\s*;`)
+var glslOpaquePattern = regexp.MustCompile(`(?m)^[ \t]*layout\s*\(([^)]*)\)\s*((?:\w+\s+)*?)uniform\s+((?:(?:readonly|writeonly|coherent|volatile|restrict|highp|mediump|lowp)\s+)*)(\w+)\s+(\w+)\s*(\[[^\]]*\])?\s*;`)
+var glslTexturePattern = regexp.MustCompile(`^([iu]?)texture(1D|2D|3D|Cube|2DArray|CubeArray|2DMS)$`)
+var glslImagePattern = regexp.MustCompile(`^([iu]?)image(1D|2D|3D|2DArray)$`)
+var glslTexelFormatPattern = regexp.MustCompile(`^(r|rg|rgba)(8|16|32)(f|i|ui|_snorm)?$`)
+var glslInterfacePattern = regexp.MustCompile(`(?m)^[ \t]*(?:layout\s*\(([^)]*)\)\s*)?((?:(?:flat|smooth|noperspective|centroid)\s+)*)(in|out|shared)\s+(\w+)\s+(\w+)\s*(\[[^\]]*\])?\s*;`)
+var glslLocalSizePattern = regexp.MustCompile(`layout\s*\(([^)]*local_size_[^)]*)\)\s*in\s*;`)
+var glslStagePragmaPattern = regexp.MustCompile(`#pragma\s+shader_stage\(\s*(vertex|fragment|compute)\s*\)`)
+
+// qualifiers that carry no meaning for the docs
+var glslIgnoredQualifiers = []string{"in", "const", "highp", "mediump", "lowp", "precise"}
+
+var glslKeywords = []string{"if", "else", "for", "while", "switch", "return", "do"}
+
+func IsGLSLFile(filePath string) bool {
+	_, ok := glslExtensions[filepath.Ext(filePath)]
+	return ok
+}
+
+// ParseGLSLFile maps a GLSL module onto the WGSL file model: interface blocks
+// and opaque uniforms declared with `layout(set =, binding =)` become bindings,
+// the members of a block become a structure named after the block
+func ParseGLSLFile(config *config.Config, glslFilePath string) WgslFile {
+	normalizedCode := readSourceFile(glslFilePath)
+
+	lineComments := extractComments(strings.Split(normalizedCode, "\n"))
+	shaderDefs := extractShaderDefsBlocks(normalizedCode)
+
+	bindings, blockStructures := extractGlslBindings(normalizedCode, lineComments, shaderDefs)
+	structures := append(extractGlslStructures(normalizedCode, lineComments, shaderDefs), blockStructures...)
+	slices.SortStableFunc(structures, func(a, b Structure) int {
+		return a.LineNumber - b.LineNumber
+	})
+
+	return newWgslFile(config, glslFilePath, normalizedCode, LanguageGLSL, sourceItems{
+		consts:     extractGlslConsts(normalizedCode, lineComments, shaderDefs),
+		structures: structures,
+		functions:  extractGlslFunctions(normalizedCode, glslFileStage(glslFilePath, normalizedCode), lineComments, shaderDefs),
+		bindings:   bindings,
+		moduleVars: extractGlslModuleVars(normalizedCode, shaderDefs),
+		shaderDefs: shaderDefs,
+	})
+}
+
+func glslFileStage(filePath, code string) string {
+	if match := glslStagePragmaPattern.FindStringSubmatch(code); match != nil {
+		return match[1]
+	}
+
+	return glslExtensions[filepath.Ext(filePath)]
+}
+
+func extractGlslConsts(code string, lineComments map[int]string, shaderDefs []ShaderDefBlock) []Const {
+	var consts []Const
+
+	for _, match := range glslConstPattern.FindAllStringSubmatchIndex(code, -1) {
+		lineNumber := getLineNumber(code, match[0])
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		typ := code[match[2]:match[3]]
+		if match[6] != -1 {
+			typ += code[match[6]:match[7]]
+		}
+
+		consts = append(consts, Const{
+			LineNumber:    lineNumber,
+			Name:          code[match[4]:match[5]],
+			Value:         strings.TrimSpace(code[match[8]:match[9]]),
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			Comment:       strings.Join(getItemComments(lineNumber, lineComments), "\n"),
+			TypeInfo: TypeInfo{
+				Type: typ,
+			},
+		})
+	}
+
+	return consts
+}
+
+func extractGlslStructures(code string, lineComments map[int]string, shaderDefs []ShaderDefBlock) []Structure {
+	var structures []Structure
+
+	for _, match := range glslStructPattern.FindAllStringSubmatchIndex(code, -1) {
+		lineNumber := getLineNumber(code, match[0])
+		structures = append(structures, newGlslStructure(
+			code[match[2]:match[3]], code[match[4]:match[5]], match[4], code, lineNumber, lineComments, shaderDefs,
+		))
+	}
+
+	return structures
+}
+
+func newGlslStructure(
+	name, members string, membersIdx int, code string, lineNumber int,
+	lineComments map[int]string, shaderDefs []ShaderDefBlock,
+) Structure {
+	fields := parseGlslMembers(members, membersIdx, code, shaderDefs)
+	shaderDefsThis := getShaderDefsByLine(shaderDefs, lineNumber)
+
+	return Structure{
+		Name:          name,
+		Fields:        fields,
+		LineNumber:    lineNumber,
+		Comment:       strings.Join(getItemComments(lineNumber, lineComments), "\n"),
+		HasShaderDefs: len(shaderDefsThis) > 0,
+		HasFields:     len(fields) != 0,
+		ShaderDefs:    shaderDefsThis,
+		FieldsShaderDefs: lo.SomeBy(fields, func(field NamedType) bool {
+			return field.HasShaderDefs
+		}),
+	}
+}
+
+// parses `type name;` members, one declaration may list several names
+func parseGlslMembers(members string, membersIdx int, code string, shaderDefs []ShaderDefBlock) []NamedType {
+	var fields []NamedType
+
+	offset := 0
+	for _, declaration := range strings.Split(members, ";") {
+		declarationIdx := membersIdx + offset
+		offset += len(declaration) + 1
+
+		declaration = regexp.MustCompile(`//.*|#.*`).ReplaceAllString(declaration, "")
+		leading := declaration[:len(declaration)-len(strings.TrimLeft(declaration, " \t\n"))]
+		declaration = strings.TrimSpace(declaration)
+		if declaration == "" {
+			continue
+		}
+
+		declaration = regexp.MustCompile(`^layout\s*\([^)]*\)\s*`).ReplaceAllString(declaration, "")
+		_, typ, names := splitGlslDeclaration(declaration)
+		if typ == "" {
+			continue
+		}
+
+		lineNumber := getLineNumber(code, declarationIdx) + strings.Count(leading, "\n")
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		for _, name := range strings.Split(names, ",") {
+			name, arraySuffix := splitGlslArray(strings.TrimSpace(name))
+
+			fields = append(fields, NamedType{
+				Name:          name,
+				HasShaderDefs: len(thisShaderDefs) > 0,
+				ShaderDefs:    thisShaderDefs,
+				TypeInfo: TypeInfo{
+					Type:         typ + arraySuffix,
+					FullTypePath: typ + arraySuffix,
+				},
+			})
+		}
+	}
+
+	return fields
+}
+
+// splits `out highp vec4 color[2]` into its qualifiers, the type and what
+// follows the type
+func splitGlslDeclaration(declaration string) (string, string, string) {
+	words := strings.Fields(declaration)
+	if len(words) < 2 {
+		return "", "", ""
+	}
+
+	typeIdx := len(words) - 2
+	for i, word := range words {
+		if strings.ContainsAny(word, "[,") || i == len(words)-1 {
+			typeIdx = max(i-1, 0)
+			break
+		}
+	}
+
+	qualifiers := lo.Filter(words[:typeIdx], func(word string, _ int) bool {
+		return !slices.Contains(glslIgnoredQualifiers, word)
+	})
+
+	return strings.Join(qualifiers, " "), words[typeIdx], strings.Join(words[typeIdx+1:], " ")
+}
+
+func splitGlslArray(name string) (string, string) {
+	if idx := strings.Index(name, "["); idx != -1 {
+		return strings.TrimSpace(name[:idx]), strings.ReplaceAll(name[idx:], " ", "")
+	}
+	return name, ""
+}
+
+func extractGlslFunctions(code, stage string, lineComments map[int]string, shaderDefs []ShaderDefBlock) []Function {
+	var functions []Function
+
+	var workgroupSize []string
+	if match := glslLocalSizePattern.FindStringSubmatch(code); match != nil {
+		layout := parseGlslLayout(match[1])
+		workgroupSize = []string{
+			lo.CoalesceOrEmpty(layout["local_size_x"], "1"),
+			lo.CoalesceOrEmpty(layout["local_size_y"], "1"),
+			lo.CoalesceOrEmpty(layout["local_size_z"], "1"),
+		}
+	}
+
+	for _, match := range glslFunctionPattern.FindAllStringSubmatchIndex(code, -1) {
+		returnType := code[match[2]:match[3]]
+		name := code[match[4]:match[5]]
+		if slices.Contains(glslKeywords, returnType) || slices.Contains(glslKeywords, name) {
+			continue
+		}
+
+		lineNumber := getLineNumber(code, match[0])
+		params := parseGlslParams(code[match[6]:match[7]], lineNumber, shaderDefs)
+
+		var stageAttr string
+		var fnWorkgroupSize []string
+		if name == "main" {
+			stageAttr = stage
+			if stageAttr == "" && workgroupSize != nil {
+				stageAttr = "compute"
+			}
+			if stageAttr == "compute" {
+				fnWorkgroupSize = workgroupSize
+			}
+		}
+
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+		bodyStartIdx := match[1] - 1
+		bodyEndIdx := findMatchingBrace(code, bodyStartIdx)
+
+		functions = append(functions, Function{
+			StageAttribute:   stageAttr,
+			WorkgroupSize:    fnWorkgroupSize,
+			HasWorkgroupSize: len(fnWorkgroupSize) > 0,
+			Name:             name,
+			LineNumber:       lineNumber,
+			Params:           params,
+			HasParams:        len(params) != 0,
+			HasShaderDefs:    len(thisShaderDefs) > 0,
+			ShaderDefs:       thisShaderDefs,
+			Comment:          strings.Join(getItemComments(lineNumber, lineComments), "\n"),
+			ReturnTypeInfo: TypeInfo{
+				Type:         returnType,
+				FullTypePath: returnType,
+			},
+			Body:            code[bodyStartIdx:bodyEndIdx],
+			BodyStartLine:   getLineNumber(code, bodyStartIdx),
+			BodyStartColumn: getColumnNumber(code, bodyStartIdx),
+			BodyEndLine:     getLineNumber(code, bodyEndIdx-1),
+		})
+	}
+
+	return functions
+}
+
+func parseGlslParams(rawParams string, lineNumber int, shaderDefs []ShaderDefBlock) []NamedType {
+	var params []NamedType
+
+	rawParams = strings.TrimSpace(rawParams)
+	if rawParams == "" || rawParams == "void" {
+		return params
+	}
+
+	for _, param := range strings.Split(rawParams, ",") {
+		qualifiers, typ, name := splitGlslDeclaration(strings.TrimSpace(param))
+		if typ == "" {
+			continue
+		}
+		name, arraySuffix := splitGlslArray(name)
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		params = append(params, NamedType{
+			Name:          name,
+			Qualifier:     qualifiers,
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			TypeInfo: TypeInfo{
+				Type:         typ + arraySuffix,
+				FullTypePath: typ + arraySuffix,
+			},
+		})
+	}
+
+	return params
+}
+
+// parses `set = 1, binding = 2, std140` into a map, bare qualifiers map to
+// an empty value
+func parseGlslLayout(layout string) map[string]string {
+	result := make(map[string]string)
+
+	for _, part := range strings.Split(layout, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key != "" {
+			result[key] = strings.TrimSpace(value)
+		}
+	}
+
+	return result
+}
+
+// maps uniform and buffer blocks as well as opaque uniforms to bindings, the
+// address space follows WGSL so reflection treats both languages alike
+func extractGlslBindings(code string, lineComments map[int]string, shaderDefs []ShaderDefBlock) ([]Binding, []Structure) {
+	var bindings []Binding
+	var structures []Structure
+
+	newBinding := func(matchIdx int, layout, qualifier, name, typ, bindingType string) {
+		layoutArgs := parseGlslLayout(layout)
+		lineNumber := getLineNumber(code, matchIdx)
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		bindings = append(bindings, Binding{
+			LineNumber:  lineNumber,
+			Name:        name,
+			BindingType: bindingType,
+			Layout:      strings.Join(strings.Fields(layout), " "),
+			Qualifier:   qualifier,
+			Annotations: []Annotation{
+				singleArgAnnotation("group", lo.CoalesceOrEmpty(layoutArgs["set"], "0")),
+				singleArgAnnotation("binding", lo.CoalesceOrEmpty(layoutArgs["binding"], "0")),
+			},
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			TypeInfo: TypeInfo{
+				Type:         typ,
+				FullTypePath: typ,
+			},
+		})
+	}
+
+	for _, match := range glslBlockPattern.FindAllStringSubmatchIndex(code, -1) {
+		qualifiers := strings.Fields(code[match[4]:match[5]])
+		storage := code[match[6]:match[7]]
+		blockName := code[match[8]:match[9]]
+
+		name := blockName
+		if match[12] != -1 {
+			name = code[match[12]:match[13]]
+		}
+
+		typ := blockName
+		if match[14] != -1 {
+			typ += strings.ReplaceAll(code[match[14]:match[15]], " ", "")
+		}
+
+		bindingType := "uniform"
+		if storage == "buffer" {
+			bindingType = "storage, read_write"
+			if slices.Contains(qualifiers, "readonly") {
+				bindingType = "storage, read"
+			}
+		}
+
+		newBinding(match[0], code[match[2]:match[3]], strings.Join(append(qualifiers, storage), " "), name, typ, bindingType)
+		if match[12] == -1 {
+			// the block structure already uses the name as its anchor
+			bindings[len(bindings)-1].Anchor = blockName + "-binding"
+		}
+
+		lineNumber := getLineNumber(code, match[0])
+		structures = append(structures, newGlslStructure(
+			blockName, code[match[10]:match[11]], match[10], code, lineNumber, lineComments, shaderDefs,
+		))
+	}
+
+	for _, match := range glslOpaquePattern.FindAllStringSubmatchIndex(code, -1) {
+		qualifiers := append(strings.Fields(code[match[4]:match[5]]), "uniform")
+		qualifiers = append(qualifiers, strings.Fields(code[match[6]:match[7]])...)
+
+		typ := code[match[8]:match[9]]
+		if match[12] != -1 {
+			typ += strings.ReplaceAll(code[match[12]:match[13]], " ", "")
+		}
+
+		newBinding(match[0], code[match[2]:match[3]], strings.Join(qualifiers, " "), code[match[10]:match[11]], typ, "")
+	}
+
+	slices.SortStableFunc(bindings, func(a, b Binding) int {
+		return a.LineNumber - b.LineNumber
+	})
+
+	return bindings, structures
+}
+
+// stage inputs and outputs and `shared` variables, the latter mapped to the
+// workgroup address space
+func extractGlslModuleVars(code string, shaderDefs []ShaderDefBlock) []ModuleVar {
+	var moduleVars []ModuleVar
+
+	for _, match := range glslInterfacePattern.FindAllStringSubmatchIndex(code, -1) {
+		lineNumber := getLineNumber(code, match[0])
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		var layout string
+		if match[2] != -1 {
+			layout = strings.Join(strings.Fields(code[match[2]:match[3]]), " ")
+		}
+
+		storage := code[match[6]:match[7]]
+		addressSpace := storage
+		if storage == "shared" {
+			addressSpace = "workgroup"
+		}
+
+		typ := code[match[8]:match[9]]
+		if match[12] != -1 {
+			typ += strings.ReplaceAll(code[match[12]:match[13]], " ", "")
+		}
+
+		moduleVars = append(moduleVars, ModuleVar{
+			LineNumber:    lineNumber,
+			Name:          code[match[10]:match[11]],
+			AddressSpace:  addressSpace,
+			Layout:        layout,
+			Qualifier:     strings.Join(append(strings.Fields(code[match[4]:match[5]]), storage), " "),
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			TypeInfo: TypeInfo{
+				Type:         typ,
+				FullTypePath: typ,
+			},
+		})
+	}
+
+	return moduleVars
+}
+
+var glslViewDimensions = map[string]string{
+	"1D":        "D1",
+	"2D":        "D2",
+	"2DArray":   "D2Array",
+	"3D":        "D3",
+	"Cube":      "Cube",
+	"CubeArray": "CubeArray",
+}
+
+var glslSampleTypes = map[string]string{"": "Float", "i": "Sint", "u": "Uint"}
+
+var glslTexelFormatSuffixes = map[string]string{"": "Unorm", "_snorm": "Snorm", "f": "Float", "i": "Sint", "ui": "Uint"}
+
+// texel formats not following the `rgba8ui` naming
+var glslTexelFormats = map[string]string{
+	"r11f_g11f_b10f": "Rg11b10Ufloat",
+	"rgb10_a2":       "Rgb10a2Unorm",
+	"rgb10_a2ui":     "Rgb10a2Uint",
+}
+
+// glslBindingType maps an opaque uniform such as `texture2D`, `samplerShadow`
+// or `image2D` to its binding type, arrays become counts. Combined image
+// samplers, and images without a format qualifier, have no WebGPU equivalent
+// and are `Unknown`.
+func (registry *ModuleRegistry) glslBindingType(file *WgslFile, binding Binding) (BindingType, *uint32) {
+	typ := binding.TypeInfo.FullTypePath
+	var count *uint32
+	if open := strings.Index(typ, "["); open != -1 {
+		if n, ok := registry.constInt(file, strings.TrimSuffix(typ[open+1:], "]")); ok {
+			n32 := uint32(n)
+			count = &n32
+		}
+		typ = typ[:open]
+	}
+
+	switch typ {
+	case "sampler":
+		return BindingType{Type: "Sampler", SamplerType: "Filtering"}, count
+	case "samplerShadow":
+		return BindingType{Type: "Sampler", SamplerType: "Comparison"}, count
+	}
+
+	if match := glslTexturePattern.FindStringSubmatch(typ); match != nil {
+		multisampled := match[2] == "2DMS"
+		ty := BindingType{
+			Type:          "Texture",
+			SampleType:    glslSampleTypes[match[1]],
+			ViewDimension: glslViewDimensions[strings.TrimSuffix(match[2], "MS")],
+			Multisampled:  &multisampled,
+		}
+		if ty.SampleType == "Float" {
+			filterable := !multisampled
+			ty.Filterable = &filterable
+		}
+		return ty, count
+	}
+
+	if match := glslImagePattern.FindStringSubmatch(typ); match != nil {
+		for arg := range parseGlslLayout(binding.Layout) {
+			format, ok := glslTexelFormat(arg)
+			if !ok {
+				continue
+			}
+
+			access := "ReadWrite"
+			qualifiers := strings.Fields(binding.Qualifier)
+			if slices.Contains(qualifiers, "readonly") {
+				access = "ReadOnly"
+			} else if slices.Contains(qualifiers, "writeonly") {
+				access = "WriteOnly"
+			}
+
+			return BindingType{
+				Type:          "StorageTexture",
+				ViewDimension: glslViewDimensions[match[2]],
+				Format:        format,
+				Access:        access,
+			}, count
+		}
+	}
+
+	return BindingType{Type: "Unknown"}, count
+}
+
+// rgba8 -> Rgba8Unorm, r32ui -> R32Uint, rgba16f -> Rgba16Float
+func glslTexelFormat(format string) (string, bool) {
+	if name, ok := glslTexelFormats[format]; ok {
+		return name, true
+	}
+
+	match := glslTexelFormatPattern.FindStringSubmatch(format)
+	if match == nil {
+		return "", false
+	}
+	return strings.ToUpper(match[1][:1]) + match[1][1:] + match[2] + glslTexelFormatSuffixes[match[3]], true
+}
@@ -0,0 +1,241 @@
+package wgsl
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+
+	utils "main/utils"
+)
+
+var highlightKeywords = []string{
+	"alias", "break", "case", "const", "const_assert", "continue", "continuing", "default", "diagnostic",
+	"discard", "else", "enable", "false", "fn", "for", "if", "let", "loop", "override", "requires",
+	"return", "struct", "switch", "true", "var", "while",
+	// GLSL
+	"in", "out", "inout", "uniform", "layout", "do", "void",
+}
+
+// ```wgsl fenced code blocks of comments, WESL and GLSL blocks are highlighted too
+var docCodeBlockPattern = regexp.MustCompile("(?m)^[ \\t]*```[ \\t]*(wgsl|wesl|glsl)[ \\t]*\\n([\\s\\S]*?)^[ \\t]*```[ \\t]*$")
+
+// SourceLine is one syntax highlighted line of source, Html is escaped.
+type SourceLine struct {
+	Number int    `json:"number"`
+	Html   string `json:"html"`
+	// `#ifdef`, `#else` or `#endif` line
+	IsDirective bool `json:"isDirective"`
+	// shader def blocks opened inside the highlighted source enclosing the line
+	ShaderDefs    []DefResult `json:"shaderDefs"`
+	HasShaderDefs bool        `json:"hasShaderDefs"`
+}
+
+// identLinker returns the link of an identifier of highlighted code, or ""
+// when it names nothing known. isCall is set for identifiers followed by `(`.
+type identLinker func(ident string, isCall bool) string
+
+// specIdentLink links the builtin functions and types of the WGSL spec.
+func specIdentLink(ident string, isCall bool) string {
+	if isCall {
+		if link := utils.GetBuiltinFunctionLink(ident); link != "" {
+			return link
+		}
+	}
+	return utils.GetTypeComponentLink(ident)
+}
+
+// HighlightSource splits code starting on line firstLine into highlighted
+// lines, linking the builtins of the spec.
+func HighlightSource(code string, firstLine int) []SourceLine {
+	return highlightLines(code, firstLine, nil, specIdentLink)
+}
+
+// highlightLines splits code starting on line firstLine into highlighted
+// lines. Only the shader def blocks opened inside code are reported, those
+// enclosing the whole code are already shown on its item.
+func highlightLines(code string, firstLine int, shaderDefs []ShaderDefBlock, link identLinker) []SourceLine {
+	lines := []SourceLine{{Number: firstLine}}
+	var builder strings.Builder
+
+	flush := func() {
+		lines[len(lines)-1].Html = builder.String()
+		builder.Reset()
+	}
+
+	lexemes := Lex(code)
+	for i, lexeme := range lexemes {
+		class := highlightClass(lexemes, i)
+		href := highlightLink(lexemes, i, link)
+		for j, part := range strings.Split(lexeme.Text, "\n") {
+			if j > 0 {
+				flush()
+				lines = append(lines, SourceLine{Number: firstLine + len(lines)})
+			}
+			if part == "" {
+				continue
+			}
+			builder.WriteString(highlightSpan(part, class, href))
+		}
+		if lexeme.Kind == LexDirective && !strings.HasPrefix(lexeme.Text, "#{") {
+			lines[len(lines)-1].IsDirective = true
+		}
+	}
+	flush()
+
+	for i := range lines {
+		for _, def := range getShaderDefsByLine(shaderDefs, lines[i].Number) {
+			if def.LineNumber >= firstLine {
+				lines[i].ShaderDefs = append(lines[i].ShaderDefs, def)
+			}
+		}
+		lines[i].HasShaderDefs = len(lines[i].ShaderDefs) != 0
+	}
+
+	return lines
+}
+
+// highlightCode returns code as highlighted HTML, newlines are kept.
+func highlightCode(code string, link identLinker) string {
+	lines := highlightLines(code, 1, nil, link)
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = line.Html
+	}
+	return strings.Join(rendered, "\n")
+}
+
+func highlightSpan(text, class, href string) string {
+	escaped := html.EscapeString(text)
+
+	classAttr := ""
+	if class != "" {
+		classAttr = ` class="` + class + `"`
+	}
+
+	switch {
+	case href != "" && strings.HasPrefix(href, "http"):
+		return `<a` + classAttr + ` href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer">` + escaped + `</a>`
+	case href != "":
+		return `<a` + classAttr + ` href="` + html.EscapeString(href) + `">` + escaped + `</a>`
+	case class != "":
+		return `<span` + classAttr + `>` + escaped + `</span>`
+	}
+	return escaped
+}
+
+func highlightClass(lexemes []Lexeme, i int) string {
+	lexeme := lexemes[i]
+
+	switch lexeme.Kind {
+	case LexComment:
+		return "hl-comment"
+	case LexDirective:
+		return "hl-directive"
+	case LexNumber:
+		return "hl-number"
+	case LexPunct:
+		if lexeme.Text == "@" {
+			return "hl-attribute"
+		}
+		return ""
+	case LexIdent:
+	default:
+		return ""
+	}
+
+	switch {
+	case i > 0 && lexemes[i-1].Text == "@":
+		return "hl-attribute"
+	case slices.Contains(highlightKeywords, lexeme.Text):
+		return "hl-keyword"
+	case utils.GetTypeComponentLink(lexeme.Text) != "" || glslTypeName(lexeme.Text) != lexeme.Text:
+		return "hl-type"
+	case nextSignificant(lexemes, i) == "(":
+		return "hl-function"
+	}
+
+	return ""
+}
+
+// highlightLink returns the link of the identifier at i, attributes link to
+// the spec. Member accesses and declared names, such as parameters and
+// fields followed by `:`, are never linked.
+func highlightLink(lexemes []Lexeme, i int, link identLinker) string {
+	if link == nil || lexemes[i].Kind != LexIdent || slices.Contains(highlightKeywords, lexemes[i].Text) {
+		return ""
+	}
+	if nextSignificant(lexemes, i) == ":" {
+		return ""
+	}
+
+	switch prev := previousSignificant(lexemes, i); prev {
+	case "@":
+		return utils.GetAttributeLink(lexemes[i].Text)
+	case ".":
+		return ""
+	}
+
+	return link(lexemes[i].Text, nextSignificant(lexemes, i) == "(")
+}
+
+func nextSignificant(lexemes []Lexeme, i int) string {
+	for j := i + 1; j < len(lexemes); j++ {
+		if lexemes[j].Kind != LexWhitespace && lexemes[j].Kind != LexComment {
+			return lexemes[j].Text
+		}
+	}
+	return ""
+}
+
+func previousSignificant(lexemes []Lexeme, i int) string {
+	for j := i - 1; j >= 0; j-- {
+		if lexemes[j].Kind != LexWhitespace && lexemes[j].Kind != LexComment {
+			return lexemes[j].Text
+		}
+	}
+	return ""
+}
+
+// HighlightSources highlights the body of every function and the WGSL code
+// blocks of comments, identifiers naming items of the project
+// link to their documentation.
+func (registry *ModuleRegistry) HighlightSources() {
+	for _, file := range registry.Files {
+		link := registry.codeLinker(file)
+
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			referenced := make(map[string]bool)
+			for _, ref := range scanBodyReferences(fn) {
+				referenced[ref.name] = true
+			}
+			fn.BodyLines = highlightLines(fn.Body, fn.BodyStartLine, file.ShaderDefBlocks, func(ident string, isCall bool) string {
+				// locals and parameters shadowing module items
+				if !referenced[ident] {
+					return specIdentLink(ident, isCall)
+				}
+				return link(ident, isCall)
+			})
+		}
+
+		forEachDocText(file, func(text *string, item string, line int) {
+			*text = docCodeBlockPattern.ReplaceAllStringFunc(*text, func(block string) string {
+				code := docCodeBlockPattern.FindStringSubmatch(block)[2]
+				// blank lines make it an HTML block which markdown leaves alone
+				return "\n<pre class=\"highlighted-code code-background\"><code>" + highlightCode(strings.TrimSuffix(code, "\n"), link) + "</code></pre>\n"
+			})
+		})
+	}
+}
+
+// codeLinker links the identifiers of code from file to the items they name
+// in the project, or to the spec
+func (registry *ModuleRegistry) codeLinker(file *WgslFile) identLinker {
+	return func(ident string, isCall bool) string {
+		if target, item, ok := registry.ResolveItem(file, ident); ok {
+			return target.ItemLink(item)
+		}
+		return specIdentLink(ident, isCall)
+	}
+}
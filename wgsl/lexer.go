@@ -0,0 +1,214 @@
+package wgsl
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LexemeKind represents the class of a WGSL lexeme.
+type LexemeKind int
+
+const (
+	LexIdent LexemeKind = iota
+	LexNumber
+	LexPunct
+	LexComment
+	LexDirective
+	LexWhitespace
+)
+
+// Lexeme is a single WGSL token with its byte offset and 1-based line.
+type Lexeme struct {
+	Kind LexemeKind
+	Text string
+	Pos  int
+	Line int
+}
+
+// operators longer than one character, longest first
+var multiCharPunct = []string{
+	"<<=", ">>=",
+	"->", "==", "!=", "<=", ">=", "&&", "||", "++", "--",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+}
+
+// Lex splits WGSL source into lexemes. Unlike Tokenizer it understands
+// comments, numeric literals, multi-character operators and naga_oil
+// directives (`#ifdef`, `#import`, `#{DEF}` ...). Qualified paths such as
+// `bevy_pbr::mesh_functions::get_world_from_local` are kept as one identifier.
+// Whitespace and comments are always emitted so that the source can be
+// reconstructed by concatenating the lexemes.
+func Lex(src string) []Lexeme {
+	var lexemes []Lexeme
+	line := 1
+
+	emit := func(kind LexemeKind, start, end int) {
+		text := src[start:end]
+		lexemes = append(lexemes, Lexeme{Kind: kind, Text: text, Pos: start, Line: line})
+		line += strings.Count(text, "\n")
+	}
+
+	for i := 0; i < len(src); {
+		r, width := utf8.DecodeRuneInString(src[i:])
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			for i < len(src) {
+				r, width := utf8.DecodeRuneInString(src[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += width
+			}
+			emit(LexWhitespace, start, i)
+
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end
+			}
+			emit(LexComment, start, i)
+
+		case strings.HasPrefix(src[i:], "/*"):
+			i = skipBlockComment(src, i)
+			emit(LexComment, start, i)
+
+		case r == '#' && strings.HasPrefix(src[i:], "#{"):
+			end := strings.IndexByte(src[i:], '}')
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end + 1
+			}
+			emit(LexDirective, start, i)
+
+		case r == '#' && isLineStart(src, i):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end
+			}
+			emit(LexDirective, start, i)
+
+		case isIdentStart(r):
+			i += width
+			for i < len(src) {
+				r, width := utf8.DecodeRuneInString(src[i:])
+				if isIdentContinue(r) {
+					i += width
+					continue
+				}
+				if strings.HasPrefix(src[i:], "::") && i+2 < len(src) {
+					next, _ := utf8.DecodeRuneInString(src[i+2:])
+					if isIdentStart(next) {
+						i += 2
+						continue
+					}
+				}
+				break
+			}
+			emit(LexIdent, start, i)
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			i = scanNumber(src, i)
+			emit(LexNumber, start, i)
+
+		default:
+			i += width
+			for _, op := range multiCharPunct {
+				if strings.HasPrefix(src[start:], op) {
+					i = start + len(op)
+					break
+				}
+			}
+			emit(LexPunct, start, i)
+		}
+	}
+
+	return lexemes
+}
+
+// SignificantLexemes drops whitespace and comments.
+func SignificantLexemes(lexemes []Lexeme) []Lexeme {
+	result := make([]Lexeme, 0, len(lexemes))
+	for _, lexeme := range lexemes {
+		if lexeme.Kind != LexWhitespace && lexeme.Kind != LexComment {
+			result = append(result, lexeme)
+		}
+	}
+	return result
+}
+
+func skipBlockComment(src string, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch {
+		case strings.HasPrefix(src[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(src[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+func scanNumber(src string, i int) int {
+	if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+		i += 2
+		for i < len(src) && (isHexDigit(src[i]) || src[i] == '.' || src[i] == 'p' || src[i] == 'P') {
+			i++
+		}
+	} else {
+		for i < len(src) {
+			c := src[i]
+			if (c >= '0' && c <= '9') || c == '.' {
+				i++
+			} else if (c == 'e' || c == 'E') && i+1 < len(src) {
+				i++
+				if src[i] == '+' || src[i] == '-' {
+					i++
+				}
+			} else {
+				break
+			}
+		}
+	}
+
+	// type suffix: 1u, 1i, 1.0f, 1.0h
+	if i < len(src) && strings.IndexByte("uifh", src[i]) != -1 {
+		i++
+	}
+
+	return i
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// directives are only recognized as the first non-blank text on a line
+func isLineStart(src string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch src[j] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
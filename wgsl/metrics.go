@@ -0,0 +1,132 @@
+package wgsl
+
+import (
+	"slices"
+	"strings"
+)
+
+// FunctionMetrics are static cost indicators computed from a function body.
+// Builtin calls are counted where they appear, not through callees.
+type FunctionMetrics struct {
+	Lines          int `json:"lines"`
+	Cyclomatic     int `json:"cyclomatic"`
+	Loops          int `json:"loops"`
+	NestingDepth   int `json:"nestingDepth"`
+	TextureSamples int `json:"textureSamples"`
+	Atomics        int `json:"atomics"`
+	Barriers       int `json:"barriers"`
+	Derivatives    int `json:"derivatives"`
+	// longest chain of calls to functions of the project, 0 for leaves
+	CallDepth int `json:"callDepth"`
+}
+
+// WGSL builtins, with their GLSL counterparts
+var textureSampleBuiltins = []string{"texture", "textureLod", "textureGrad", "textureOffset", "textureProj"}
+var barrierBuiltins = []string{
+	"workgroupBarrier", "storageBarrier", "textureBarrier", "workgroupUniformLoad",
+	"barrier", "memoryBarrier", "memoryBarrierShared", "memoryBarrierBuffer", "memoryBarrierImage", "groupMemoryBarrier",
+}
+var derivativeBuiltins = []string{
+	"dpdx", "dpdxCoarse", "dpdxFine", "dpdy", "dpdyCoarse", "dpdyFine", "fwidth", "fwidthCoarse", "fwidthFine",
+	"dFdx", "dFdy", "dFdxCoarse", "dFdxFine", "dFdyCoarse", "dFdyFine",
+}
+
+// AnalyzeComplexity computes the metrics of every function. The call depth
+// follows calls through imported modules; recursive calls are not followed.
+func (registry *ModuleRegistry) AnalyzeComplexity() {
+	depths := make(map[itemKey]int)
+
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			fn.Metrics = bodyMetrics(fn)
+			fn.Metrics.CallDepth = registry.callDepth(file, fn.Name, depths, map[itemKey]bool{})
+		}
+	}
+}
+
+func bodyMetrics(fn *Function) FunctionMetrics {
+	metrics := FunctionMetrics{Cyclomatic: 1}
+	lexemes := withoutDirectives(SignificantLexemes(Lex(fn.Body)))
+	lines := make(map[int]bool)
+	depth := 0
+
+	for i, lexeme := range lexemes {
+		// the braces of the body itself
+		if i != 0 && i != len(lexemes)-1 {
+			lines[lexeme.Line] = true
+		}
+
+		switch lexeme.Text {
+		case "{":
+			depth++
+			metrics.NestingDepth = max(metrics.NestingDepth, depth-1)
+		case "}":
+			depth--
+		case "if", "case", "&&", "||", "?":
+			metrics.Cyclomatic++
+		case "for", "while":
+			metrics.Cyclomatic++
+			metrics.Loops++
+		case "loop":
+			// exits through `break if`, counted with the other ifs
+			metrics.Loops++
+		}
+
+		if lexeme.Kind != LexIdent || i+1 >= len(lexemes) || lexemes[i+1].Text != "(" {
+			continue
+		}
+
+		switch name := lexeme.Text; {
+		case strings.HasPrefix(name, "textureSample"), strings.HasPrefix(name, "textureGather"), slices.Contains(textureSampleBuiltins, name):
+			metrics.TextureSamples++
+		case strings.HasPrefix(name, "atomic"):
+			metrics.Atomics++
+		case slices.Contains(barrierBuiltins, name):
+			metrics.Barriers++
+		case slices.Contains(derivativeBuiltins, name):
+			metrics.Derivatives++
+		}
+	}
+
+	metrics.Lines = len(lines)
+
+	return metrics
+}
+
+func (registry *ModuleRegistry) callDepth(file *WgslFile, name string, depths map[itemKey]int, visiting map[itemKey]bool) int {
+	key := itemKey{file, name}
+	if depth, ok := depths[key]; ok {
+		return depth
+	}
+	if visiting[key] {
+		return 0
+	}
+	visiting[key] = true
+
+	depth := 0
+	for i := range file.Functions {
+		fn := &file.Functions[i]
+		if fn.Name != name {
+			continue
+		}
+
+		for _, ref := range scanBodyReferences(fn) {
+			if !ref.isCall {
+				continue
+			}
+			if target, item, ok := registry.ResolveItem(file, ref.name); ok && target.declaresFunction(item) {
+				depth = max(depth, 1+registry.callDepth(target, item, depths, visiting))
+			}
+		}
+	}
+
+	delete(visiting, key)
+	depths[key] = depth
+
+	return depth
+}
+
+func (wgslFile *WgslFile) declaresFunction(name string) bool {
+	return slices.ContainsFunc(wgslFile.Functions, func(v Function) bool { return v.Name == name })
+}
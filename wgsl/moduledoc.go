@@ -0,0 +1,112 @@
+package wgsl
+
+import (
+	"regexp"
+	"strings"
+)
+
+var licenseHeaderPattern = regexp.MustCompile(`(?i)spdx-license-identifier|copyright\s+(\(c\)|©|\d{4})|licensed under|all rights reserved|permission is hereby granted`)
+
+// extractModuleDoc returns the documentation of the whole module and the line
+// it starts on: its `//!` lines, or else the comment blocks at the top of the
+// file which are not attached to an item. License headers are left out.
+func extractModuleDoc(code string) (string, int) {
+	lexemes := Lex(code)
+
+	var inner []string
+	innerLine := 0
+	for _, lexeme := range lexemes {
+		if lexeme.Kind == LexComment && strings.HasPrefix(lexeme.Text, "//!") {
+			inner = append(inner, strings.TrimPrefix(strings.TrimPrefix(lexeme.Text, "//!"), " "))
+			if innerLine == 0 {
+				innerLine = lexeme.Line
+			}
+		}
+	}
+	if len(inner) > 0 {
+		return strings.TrimSpace(strings.Join(inner, "\n")), innerLine
+	}
+
+	var blocks []string
+	var block []string
+	line, blockLine := 0, 0
+	importDepth := 0
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(block, "\n"))
+		if text != "" && !licenseHeaderPattern.MatchString(text) {
+			blocks = append(blocks, text)
+			if line == 0 {
+				line = blockLine
+			}
+		}
+		block = nil
+	}
+
+scan:
+	for _, lexeme := range lexemes {
+		switch {
+		case lexeme.Kind == LexComment:
+			if len(block) == 0 {
+				blockLine = lexeme.Line
+			}
+			for _, text := range commentLines(lexeme.Text) {
+				// notes are listed on their own page, see extractNotes
+				if !strings.HasPrefix(strings.TrimSpace(text), "TODO:") {
+					block = append(block, text)
+				}
+			}
+		case lexeme.Kind == LexWhitespace:
+			// a blank line ends the block
+			if strings.Count(lexeme.Text, "\n") > 1 {
+				flush()
+			}
+		case lexeme.Kind == LexDirective:
+			flush()
+			if strings.HasPrefix(lexeme.Text, "#import") && strings.HasSuffix(strings.TrimSpace(lexeme.Text), "{") {
+				importDepth = 1
+			}
+		case importDepth > 0:
+			// the rest of a multi line #import
+			switch lexeme.Text {
+			case "{":
+				importDepth++
+			case "}":
+				importDepth--
+			}
+		default:
+			// the block right before the first item documents that item
+			break scan
+		}
+	}
+
+	return strings.Join(blocks, "\n\n"), line
+}
+
+// returns the text lines of a line or block comment
+func commentLines(comment string) []string {
+	if !strings.HasPrefix(comment, "/*") {
+		text := strings.TrimPrefix(strings.TrimPrefix(comment, "///"), "//")
+		return []string{strings.TrimPrefix(text, " ")}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(comment, "/*"), "*/"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(strings.TrimPrefix(line, "*"), " ")
+		lines[i] = line
+	}
+	return lines
+}
+
+// ModuleSummary returns the first paragraph of the module documentation,
+// headings aside, as shown in the home index and in search.
+func (wgslFile *WgslFile) ModuleSummary() string {
+	for _, paragraph := range strings.Split(wgslFile.ModuleDoc, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph != "" && !strings.HasPrefix(paragraph, "#") {
+			return strings.Join(strings.Fields(paragraph), " ")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package wgsl
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TODO, FIXME, HACK or NOTE, optionally followed by an owner such as
+// `TODO(alice):`. Only uppercase tags count, "note that" is prose.
+var notePattern = regexp.MustCompile(`^(TODO|FIXME|HACK|NOTE)\b(?:\([^)]*\))?:?\s*(.*)$`)
+
+// ShaderNote is a TODO, FIXME, HACK or NOTE comment of the sources, with the
+// item enclosing it or documented by it.
+type ShaderNote struct {
+	Kind       string `json:"kind"`
+	Text       string `json:"text"`
+	Module     string `json:"module"`
+	Filename   string `json:"filename"`
+	Line       int    `json:"line"`
+	Item       string `json:"item,omitempty"`
+	Link       string `json:"link"`
+	SourceLink string `json:"sourceLink"`
+}
+
+// NotesDiff compares the notes of two versions, notes are matched by kind,
+// module, item and text since their lines move.
+type NotesDiff struct {
+	Resolved []ShaderNote `json:"resolved"`
+	Added    []ShaderNote `json:"added"`
+}
+
+// a range of lines defining an item of a file
+type noteItem struct {
+	name, anchor       string
+	startLine, endLine int
+}
+
+// extractNotes collects the notes of the comments of code, a note goes on
+// over the following comment lines until a blank comment line or another
+// note.
+func extractNotes(code string, file *WgslFile) []ShaderNote {
+	var notes []ShaderNote
+	lastLine := 0
+
+	lexemes := Lex(code)
+	for i, lexeme := range lexemes {
+		if lexeme.Kind != LexComment {
+			continue
+		}
+		// notes written after code end with their line
+		ownLine := i == 0 || (lexemes[i-1].Kind == LexWhitespace && strings.Contains(lexemes[i-1].Text, "\n"))
+
+		for k, text := range commentLines(lexeme.Text) {
+			line := lexeme.Line + k
+			text = strings.TrimSpace(strings.TrimPrefix(text, "!"))
+
+			if match := notePattern.FindStringSubmatch(text); match != nil {
+				notes = append(notes, ShaderNote{Kind: match[1], Text: match[2], Line: line})
+				lastLine = 0
+				if ownLine || k > 0 {
+					lastLine = line
+				}
+				continue
+			}
+
+			if len(notes) > 0 && text != "" && lastLine != 0 && line == lastLine+1 {
+				last := &notes[len(notes)-1]
+				last.Text = strings.TrimSpace(last.Text + " " + text)
+				lastLine = line
+			} else {
+				lastLine = 0
+			}
+		}
+	}
+
+	items := noteItems(code, file)
+	codeLines := strings.Split(code, "\n")
+	for i := range notes {
+		note := &notes[i]
+		note.Module = file.ModuleName()
+		note.Filename = file.Filename
+		note.SourceLink = fmt.Sprintf("%s#L%d", file.GithubLink, note.Line)
+		note.Link = file.ItemLink("")
+
+		if item, ok := noteItemAt(items, codeLines, note.Line); ok {
+			note.Item = item.name
+			note.Link = file.ItemLink(item.anchor)
+		}
+	}
+
+	return notes
+}
+
+func noteItems(code string, file *WgslFile) []noteItem {
+	codeLines := strings.Split(code, "\n")
+	var items []noteItem
+
+	for _, fn := range file.Functions {
+		items = append(items, noteItem{fn.Name, cmp.Or(fn.Anchor, fn.Name), fn.LineNumber, fn.BodyEndLine})
+	}
+	for _, structure := range file.Structures {
+		items = append(items, noteItem{structure.Name, cmp.Or(structure.Anchor, structure.Name), structure.LineNumber, closingLine(code, codeLines, structure.LineNumber)})
+	}
+	for _, constant := range file.Consts {
+		items = append(items, noteItem{constant.Name, constant.Name, constant.LineNumber, constant.LineNumber})
+	}
+	for _, binding := range file.Bindings {
+		items = append(items, noteItem{binding.Name, cmp.Or(binding.Anchor, binding.Name), binding.LineNumber, binding.LineNumber})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].startLine < items[j].startLine })
+	return items
+}
+
+// noteItemAt returns the item defined around line, or else the item right
+// after the comment block holding line
+func noteItemAt(items []noteItem, codeLines []string, line int) (noteItem, bool) {
+	for _, item := range items {
+		if item.startLine <= line && line <= item.endLine {
+			return item, true
+		}
+	}
+
+	for _, item := range items {
+		if item.startLine <= line {
+			continue
+		}
+		for between := line + 1; between < item.startLine; between++ {
+			trimmed := strings.TrimSpace(codeLines[between-1])
+			if !strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "/*") &&
+				!strings.HasPrefix(trimmed, "*") && !strings.HasPrefix(trimmed, "@") {
+				return noteItem{}, false
+			}
+		}
+		return item, true
+	}
+
+	return noteItem{}, false
+}
+
+// Notes returns the notes of every file, by module and line.
+func (registry *ModuleRegistry) Notes() []ShaderNote {
+	notes := []ShaderNote{}
+	for _, file := range registry.Files {
+		notes = append(notes, file.Notes...)
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Module != notes[j].Module {
+			return notes[i].Module < notes[j].Module
+		}
+		return notes[i].Line < notes[j].Line
+	})
+	return notes
+}
+
+// DiffNotes returns the notes of previous missing from current, and the
+// other way around.
+func DiffNotes(previous, current []ShaderNote) NotesDiff {
+	key := func(note ShaderNote) string {
+		return strings.Join([]string{note.Kind, note.Module, note.Item, note.Text}, "\x00")
+	}
+
+	// the same note may be written several times in a module
+	remaining := func(notes []ShaderNote) map[string]int {
+		counts := make(map[string]int)
+		for _, note := range notes {
+			counts[key(note)]++
+		}
+		return counts
+	}
+
+	diff := NotesDiff{Resolved: []ShaderNote{}, Added: []ShaderNote{}}
+
+	currentCounts := remaining(current)
+	for _, note := range previous {
+		if currentCounts[key(note)] > 0 {
+			currentCounts[key(note)]--
+		} else {
+			diff.Resolved = append(diff.Resolved, note)
+		}
+	}
+
+	previousCounts := remaining(previous)
+	for _, note := range current {
+		if previousCounts[key(note)] > 0 {
+			previousCounts[key(note)]--
+		} else {
+			diff.Added = append(diff.Added, note)
+		}
+	}
+
+	return diff
+}
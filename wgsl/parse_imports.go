@@ -88,6 +88,42 @@ func extractImportBlocks(src string) []string {
 	return blocks
 }
 
+// importLines maps every identifier of declaredImports to the line of the
+// `#import` directive or WESL `import` statement declaring it
+func importLines(code string, declaredImports DeclaredImports) map[string]int {
+	type statement struct {
+		text string
+		line int
+	}
+
+	var statements []statement
+	depth := 0
+	for i, line := range strings.Split(code, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if depth > 0 {
+			statements[len(statements)-1].text += " " + trimmed
+		} else if strings.HasPrefix(trimmed, "#import ") || strings.HasPrefix(trimmed, "import ") {
+			statements = append(statements, statement{trimmed, i + 1})
+		} else {
+			continue
+		}
+		depth += strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+	}
+
+	lines := make(map[string]int, len(declaredImports))
+	for ident := range declaredImports {
+		word := regexp.MustCompile(`\b` + regexp.QuoteMeta(ident) + `\b`)
+		for _, statement := range statements {
+			if word.MatchString(statement.text) {
+				lines[ident] = statement.line
+				break
+			}
+		}
+	}
+
+	return lines
+}
+
 func parseImports(importString string) (DeclaredImports, error) {
 	declaredImports := make(map[string][]string)
 	tokens := NewPeekableTokenizer(NewTokenizer(importString, false).Tokens)
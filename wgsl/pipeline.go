@@ -0,0 +1,662 @@
+package wgsl
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	utils "main/utils"
+)
+
+const PipelineReflectionSchema = "/public/pipeline-reflection.schema.json"
+
+// PipelineReflection describes everything a pipeline needs to know about one
+// entry point. Bind group entries follow the shape of `wgpu::BindGroupLayoutEntry`.
+type PipelineReflection struct {
+	Schema     string `json:"$schema"`
+	Module     string `json:"module"`
+	EntryPoint string `json:"entryPoint"`
+	Stage      string `json:"stage"`
+
+	// nil when a dimension is not an integer literal, e.g. `#{WORKGROUP_SIZE}`
+	WorkgroupSize       *[3]uint32 `json:"workgroupSize,omitempty"`
+	WorkgroupSizeSource []string   `json:"workgroupSizeSource,omitempty"`
+
+	VertexAttributes []VertexAttribute `json:"vertexAttributes,omitempty"`
+	BindGroups       []BindGroupLayout `json:"bindGroups"`
+
+	// shader defs that can change the entry point, see AnalyzeShaderDefReachability
+	RelevantShaderDefs []RelevantShaderDef `json:"relevantShaderDefs,omitempty"`
+	ShaderVariants     uint64              `json:"shaderVariants,omitempty"`
+}
+
+type VertexAttribute struct {
+	Name           string      `json:"name"`
+	ShaderLocation uint32      `json:"shaderLocation"`
+	Format         string      `json:"format"`
+	ShaderDefs     []DefResult `json:"shaderDefs,omitempty"`
+}
+
+type BindGroupLayout struct {
+	Group   uint32                 `json:"group"`
+	Entries []BindGroupLayoutEntry `json:"entries"`
+}
+
+type BindGroupLayoutEntry struct {
+	Group      uint32      `json:"-"`
+	Binding    uint32      `json:"binding"`
+	Name       string      `json:"name"`
+	Module     string      `json:"module"`
+	WgslType   string      `json:"wgslType"`
+	Visibility []string    `json:"visibility"`
+	Ty         BindingType `json:"ty"`
+	Count      *uint32     `json:"count,omitempty"`
+	ShaderDefs []DefResult `json:"shaderDefs,omitempty"`
+}
+
+// BindingType mirrors `wgpu::BindingType`; only the fields relevant to Type are set.
+type BindingType struct {
+	Type string `json:"type"`
+
+	BufferType       string  `json:"bufferType,omitempty"`
+	ReadOnly         *bool   `json:"readOnly,omitempty"`
+	HasDynamicOffset *bool   `json:"hasDynamicOffset,omitempty"`
+	MinBindingSize   *uint64 `json:"minBindingSize,omitempty"`
+
+	SamplerType string `json:"samplerType,omitempty"`
+
+	SampleType    string `json:"sampleType,omitempty"`
+	Filterable    *bool  `json:"filterable,omitempty"`
+	ViewDimension string `json:"viewDimension,omitempty"`
+	Multisampled  *bool  `json:"multisampled,omitempty"`
+
+	Access string `json:"access,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+var viewDimensions = map[string]string{
+	"1d":         "D1",
+	"2d":         "D2",
+	"2d_array":   "D2Array",
+	"3d":         "D3",
+	"cube":       "Cube",
+	"cube_array": "CubeArray",
+}
+
+var sampleTypes = map[string]string{
+	"f32": "Float",
+	"i32": "Sint",
+	"u32": "Uint",
+}
+
+var storageTextureAccess = map[string]string{
+	"read":       "ReadOnly",
+	"write":      "WriteOnly",
+	"read_write": "ReadWrite",
+}
+
+var vertexFormats = map[string]string{
+	"f32": "Float32",
+	"i32": "Sint32",
+	"u32": "Uint32",
+	"f16": "Float16",
+}
+
+// PipelineReflection builds the reflection document of an entry point from
+// the resources found by AnalyzeResourceUsage.
+func (registry *ModuleRegistry) PipelineReflection(file *WgslFile, fn *Function) PipelineReflection {
+	reflection := PipelineReflection{
+		Schema:     PipelineReflectionSchema,
+		Module:     file.ModuleName(),
+		EntryPoint: fn.Name,
+		Stage:      fn.StageAttribute,
+		BindGroups: []BindGroupLayout{},
+	}
+
+	if fn.HasWorkgroupSize {
+		reflection.WorkgroupSizeSource = fn.WorkgroupSize
+		reflection.WorkgroupSize = literalWorkgroupSize(fn.WorkgroupSize)
+	}
+
+	if fn.StageAttribute == "vertex" {
+		reflection.VertexAttributes = registry.vertexAttributes(file, fn)
+	}
+
+	visibility := []string{strings.ToUpper(fn.StageAttribute)}
+	var entries []BindGroupLayoutEntry
+
+	for _, resource := range fn.Resources {
+		if resource.Kind != "binding" {
+			continue
+		}
+
+		target := resource.File
+		if target == nil {
+			continue
+		}
+
+		idx := slices.IndexFunc(target.Bindings, func(v Binding) bool { return v.Name == resource.Name })
+		if idx == -1 {
+			continue
+		}
+		entries = append(entries, registry.bindGroupLayoutEntry(target, target.Bindings[idx], visibility))
+	}
+
+	reflection.BindGroups = groupLayoutEntries(entries)
+
+	if fn.HasRelevantShaderDefs {
+		reflection.RelevantShaderDefs = fn.RelevantShaderDefs
+		reflection.ShaderVariants = fn.ShaderVariants
+	}
+
+	return reflection
+}
+
+// FileBindGroupLayouts lists every binding declared in file. When shader def
+// branches declare the same slot twice, only the first declaration is kept.
+func (registry *ModuleRegistry) FileBindGroupLayouts(file *WgslFile, visibility []string) []BindGroupLayout {
+	var entries []BindGroupLayoutEntry
+
+	for _, binding := range file.Bindings {
+		entry := registry.bindGroupLayoutEntry(file, binding, visibility)
+		duplicate := slices.ContainsFunc(entries, func(v BindGroupLayoutEntry) bool {
+			return v.Group == entry.Group && v.Binding == entry.Binding
+		})
+		if !duplicate {
+			entries = append(entries, entry)
+		}
+	}
+
+	return groupLayoutEntries(entries)
+}
+
+func (registry *ModuleRegistry) bindGroupLayoutEntry(file *WgslFile, binding Binding, visibility []string) BindGroupLayoutEntry {
+	group, _ := annotationValue(binding.Annotations, "group")
+	bindingIndex, _ := annotationValue(binding.Annotations, "binding")
+	group64, _ := strconv.ParseUint(group, 10, 32)
+	binding64, _ := strconv.ParseUint(bindingIndex, 10, 32)
+
+	entry := BindGroupLayoutEntry{
+		Group:      uint32(group64),
+		Binding:    uint32(binding64),
+		Name:       binding.Name,
+		Module:     file.ModuleName(),
+		WgslType:   binding.TypeInfo.FullTypePath,
+		Visibility: visibility,
+		ShaderDefs: binding.ShaderDefs,
+	}
+	entry.Ty, entry.Count = registry.bindingType(file, binding)
+
+	return entry
+}
+
+func groupLayoutEntries(entries []BindGroupLayoutEntry) []BindGroupLayout {
+	groups := []BindGroupLayout{}
+
+	for _, entry := range entries {
+		idx := slices.IndexFunc(groups, func(v BindGroupLayout) bool { return v.Group == entry.Group })
+		if idx == -1 {
+			groups = append(groups, BindGroupLayout{Group: entry.Group})
+			idx = len(groups) - 1
+		}
+		groups[idx].Entries = append(groups[idx].Entries, entry)
+	}
+
+	slices.SortFunc(groups, func(a, b BindGroupLayout) int { return int(a.Group) - int(b.Group) })
+	for _, group := range groups {
+		slices.SortFunc(group.Entries, func(a, b BindGroupLayoutEntry) int { return int(a.Binding) - int(b.Binding) })
+	}
+
+	return groups
+}
+
+func literalWorkgroupSize(dimensions []string) *[3]uint32 {
+	size := [3]uint32{1, 1, 1}
+	for i, dimension := range dimensions {
+		if i >= 3 {
+			break
+		}
+		value, err := strconv.ParseUint(strings.TrimRight(dimension, "ui"), 0, 32)
+		if err != nil {
+			return nil
+		}
+		size[i] = uint32(value)
+	}
+	return &size
+}
+
+func (registry *ModuleRegistry) bindingType(file *WgslFile, binding Binding) (BindingType, *uint32) {
+	typ := NormalizeTypeAlias(binding.TypeInfo.FullTypePath)
+	var count *uint32
+
+	if name, args := splitTemplateType(typ); name == "binding_array" && len(args) > 0 {
+		typ = args[0]
+		if len(args) > 1 {
+			if n, ok := registry.constInt(file, args[1]); ok {
+				n32 := uint32(n)
+				count = &n32
+			}
+		}
+	}
+
+	addressSpace := bindingAddressSpace(binding)
+	if addressSpace == "uniform" || addressSpace == "storage" {
+		readOnly := true
+		hasDynamicOffset := false
+		ty := BindingType{
+			Type:             "Buffer",
+			BufferType:       "Uniform",
+			HasDynamicOffset: &hasDynamicOffset,
+		}
+
+		if addressSpace == "storage" {
+			ty.BufferType = "Storage"
+			readOnly = !strings.Contains(binding.BindingType, "write")
+			ty.ReadOnly = &readOnly
+		}
+
+		if layout, ok := registry.typeLayout(file, typ, addressSpace == "uniform", map[itemKey]bool{}); ok {
+			size := layout.size
+			ty.MinBindingSize = &size
+		}
+
+		return ty, count
+	}
+
+	if file.IsGLSL {
+		return registry.glslBindingType(file, binding)
+	}
+
+	name, args := splitTemplateType(typ)
+	yes, no := true, false
+
+	switch {
+	case name == "sampler":
+		return BindingType{Type: "Sampler", SamplerType: "Filtering"}, count
+	case name == "sampler_comparison":
+		return BindingType{Type: "Sampler", SamplerType: "Comparison"}, count
+	case name == "texture_external":
+		return BindingType{Type: "ExternalTexture"}, count
+	case strings.HasPrefix(name, "texture_storage_"):
+		ty := BindingType{
+			Type:          "StorageTexture",
+			ViewDimension: viewDimensions[strings.TrimPrefix(name, "texture_storage_")],
+		}
+		if len(args) > 0 {
+			ty.Format = texelFormatName(args[0])
+		}
+		if len(args) > 1 {
+			ty.Access = storageTextureAccess[args[1]]
+		}
+		return ty, count
+	case strings.HasPrefix(name, "texture_depth_multisampled_"):
+		return BindingType{Type: "Texture", SampleType: "Depth", ViewDimension: "D2", Multisampled: &yes}, count
+	case strings.HasPrefix(name, "texture_depth_"):
+		return BindingType{
+			Type:          "Texture",
+			SampleType:    "Depth",
+			ViewDimension: viewDimensions[strings.TrimPrefix(name, "texture_depth_")],
+			Multisampled:  &no,
+		}, count
+	case strings.HasPrefix(name, "texture_multisampled_"):
+		ty := BindingType{Type: "Texture", ViewDimension: "D2", Multisampled: &yes}
+		if len(args) > 0 {
+			ty.SampleType = sampleTypes[args[0]]
+		}
+		if ty.SampleType == "Float" {
+			ty.Filterable = &no
+		}
+		return ty, count
+	case strings.HasPrefix(name, "texture_"):
+		ty := BindingType{
+			Type:          "Texture",
+			ViewDimension: viewDimensions[strings.TrimPrefix(name, "texture_")],
+			Multisampled:  &no,
+		}
+		if len(args) > 0 {
+			ty.SampleType = sampleTypes[args[0]]
+		}
+		if ty.SampleType == "Float" {
+			ty.Filterable = &yes
+		}
+		return ty, count
+	}
+
+	return BindingType{Type: "Unknown"}, count
+}
+
+// rgba8unorm -> Rgba8Unorm, rg11b10ufloat -> Rg11b10Ufloat
+func texelFormatName(format string) string {
+	for _, suffix := range []string{"unorm", "snorm", "uint", "sint", "ufloat", "float"} {
+		if strings.HasSuffix(format, suffix) {
+			base := strings.TrimSuffix(format, suffix)
+			return strings.ToUpper(base[:1]) + base[1:] + strings.ToUpper(suffix[:1]) + suffix[1:]
+		}
+	}
+	return format
+}
+
+func (registry *ModuleRegistry) vertexAttributes(file *WgslFile, fn *Function) []VertexAttribute {
+	var attributes []VertexAttribute
+
+	addAttribute := func(field NamedType) {
+		location, ok := annotationValue(field.Annotations, "location")
+		if !ok {
+			return
+		}
+		shaderLocation, err := strconv.ParseUint(location, 10, 32)
+		if err != nil {
+			return
+		}
+
+		attributes = append(attributes, VertexAttribute{
+			Name:           field.Name,
+			ShaderLocation: uint32(shaderLocation),
+			Format:         vertexFormat(field.TypeInfo.Type),
+			ShaderDefs:     field.ShaderDefs,
+		})
+	}
+
+	for _, param := range fn.Params {
+		if _, ok := annotationValue(param.Annotations, "location"); ok {
+			addAttribute(param)
+			continue
+		}
+
+		if structure, _ := registry.findStructure(file, param.TypeInfo.FullTypePath); structure != nil {
+			for _, field := range structure.Fields {
+				addAttribute(field)
+			}
+		}
+	}
+
+	return attributes
+}
+
+func vertexFormat(typ string) string {
+	name, args := splitTemplateType(NormalizeTypeAlias(typ))
+
+	if format, ok := vertexFormats[name]; ok {
+		return format
+	}
+
+	if strings.HasPrefix(name, "vec") && len(args) == 1 {
+		if format, ok := vertexFormats[args[0]]; ok {
+			return format + "x" + strings.TrimPrefix(name, "vec")
+		}
+	}
+
+	return ""
+}
+
+// findStructure resolves a possibly imported structure name used in file.
+func (registry *ModuleRegistry) findStructure(file *WgslFile, typ string) (*Structure, *WgslFile) {
+	target, name, ok := registry.ResolveItem(file, typ)
+	if !ok {
+		return nil, nil
+	}
+
+	for i := range target.Structures {
+		if target.Structures[i].Name == name {
+			return &target.Structures[i], target
+		}
+	}
+
+	return nil, nil
+}
+
+func (registry *ModuleRegistry) constInt(file *WgslFile, expr string) (uint64, bool) {
+	expr = strings.TrimSpace(expr)
+	if value, err := strconv.ParseUint(strings.TrimRight(expr, "ui"), 0, 64); err == nil {
+		return value, true
+	}
+
+	target, name, ok := registry.ResolveItem(file, expr)
+	if !ok {
+		return 0, false
+	}
+
+	for _, c := range target.Consts {
+		if c.Name == name {
+			return registry.constInt(target, c.Value)
+		}
+	}
+
+	return 0, false
+}
+
+type typeLayout struct {
+	size  uint64
+	align uint64
+}
+
+func roundUp(align, value uint64) uint64 {
+	if align == 0 {
+		return value
+	}
+	return (value + align - 1) / align * align
+}
+
+var scalarSizes = map[string]uint64{
+	"f32": 4,
+	"i32": 4,
+	"u32": 4,
+	"f16": 2,
+}
+
+// typeLayout computes size and alignment following the WGSL memory layout
+// rules, applying the extra uniform address space constraints when uniform
+// is set. Runtime-sized arrays count as a single element, which is what
+// wgpu expects as minimum binding size. Recursive structures have no layout.
+func (registry *ModuleRegistry) typeLayout(file *WgslFile, typ string, uniform bool, visiting map[itemKey]bool) (typeLayout, bool) {
+	typ = NormalizeTypeAlias(strings.TrimSpace(typ))
+	name, args := splitTemplateType(typ)
+
+	if size, ok := scalarSizes[name]; ok {
+		return typeLayout{size, size}, true
+	}
+
+	switch {
+	case name == "atomic":
+		return typeLayout{4, 4}, true
+
+	case strings.HasPrefix(name, "vec") && len(args) == 1:
+		n, _ := strconv.ParseUint(strings.TrimPrefix(name, "vec"), 10, 64)
+		scalar, ok := scalarSizes[args[0]]
+		if !ok || n == 0 {
+			return typeLayout{}, false
+		}
+		align := scalar * n
+		if n == 3 {
+			align = scalar * 4
+		}
+		return typeLayout{scalar * n, align}, true
+
+	case strings.HasPrefix(name, "mat") && len(args) == 1:
+		var columns, rows uint64
+		dims := strings.Split(strings.TrimPrefix(name, "mat"), "x")
+		if len(dims) != 2 {
+			return typeLayout{}, false
+		}
+		columns, _ = strconv.ParseUint(dims[0], 10, 64)
+		rows, _ = strconv.ParseUint(dims[1], 10, 64)
+		column, ok := registry.typeLayout(file, "vec"+dims[1]+"<"+args[0]+">", uniform, visiting)
+		if !ok || columns == 0 || rows == 0 {
+			return typeLayout{}, false
+		}
+		return typeLayout{columns * roundUp(column.align, column.size), column.align}, true
+
+	case name == "array" && len(args) > 0:
+		element, ok := registry.typeLayout(file, args[0], uniform, visiting)
+		if !ok {
+			return typeLayout{}, false
+		}
+		align := element.align
+		stride := roundUp(element.align, element.size)
+		if uniform {
+			align = roundUp(16, align)
+			stride = roundUp(16, stride)
+		}
+		count := uint64(1)
+		if len(args) > 1 {
+			count, ok = registry.constInt(file, args[1])
+			if !ok {
+				return typeLayout{}, false
+			}
+		}
+		return typeLayout{count * stride, align}, true
+	}
+
+	structure, target := registry.findStructure(file, typ)
+	if structure == nil {
+		return typeLayout{}, false
+	}
+
+	key := itemKey{target, structure.Name}
+	if visiting[key] {
+		return typeLayout{}, false
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	var offset, align uint64 = 0, 1
+	for _, field := range structure.Fields {
+		fieldLayout, ok := registry.typeLayout(target, field.TypeInfo.FullTypePath, uniform, visiting)
+		if !ok {
+			return typeLayout{}, false
+		}
+		if value, ok := annotationValue(field.Annotations, "align"); ok {
+			fieldLayout.align, _ = strconv.ParseUint(value, 10, 64)
+		}
+		if value, ok := annotationValue(field.Annotations, "size"); ok {
+			fieldLayout.size, _ = strconv.ParseUint(value, 10, 64)
+		}
+
+		offset = roundUp(fieldLayout.align, offset) + fieldLayout.size
+		align = max(align, fieldLayout.align)
+	}
+
+	if uniform {
+		align = roundUp(16, align)
+	}
+
+	return typeLayout{roundUp(align, offset), align}, true
+}
+
+// CheckRecursiveStructures reports every structure containing itself, directly
+// or through other structures and arrays. WGSL forbids recursive types, they
+// have no memory layout.
+func (registry *ModuleRegistry) CheckRecursiveStructures() {
+	for _, file := range registry.Files {
+		for _, structure := range file.Structures {
+			key := itemKey{file, structure.Name}
+			visiting := map[itemKey]bool{key: true}
+
+			for _, field := range structure.Fields {
+				if !registry.containsStructure(file, field.TypeInfo.FullTypePath, key, visiting) {
+					continue
+				}
+
+				registry.Diagnostics.Add(Diagnostic{
+					Severity: SeverityError,
+					Code:     "recursive-struct",
+					Message:  fmt.Sprintf("`%s` contains itself through field `%s`", structure.Name, field.Name),
+					Module:   file.ModuleName(),
+					File:     file.FilePath,
+					Item:     structure.Name,
+					Link:     file.ItemLink(structure.Name),
+					Span:     Span{Line: structure.LineNumber, EndLine: structure.LineNumber},
+				})
+				break
+			}
+		}
+	}
+}
+
+// whether typ is or contains the structure key, structures in visiting are
+// not searched again
+func (registry *ModuleRegistry) containsStructure(file *WgslFile, typ string, key itemKey, visiting map[itemKey]bool) bool {
+	name, args := splitTemplateType(NormalizeTypeAlias(strings.TrimSpace(typ)))
+	if len(args) > 0 {
+		return registry.containsStructure(file, args[0], key, visiting)
+	}
+
+	structure, target := registry.findStructure(file, name)
+	if structure == nil {
+		return false
+	}
+
+	current := itemKey{target, structure.Name}
+	if current == key {
+		return true
+	}
+	if visiting[current] {
+		return false
+	}
+	visiting[current] = true
+
+	for _, field := range structure.Fields {
+		if registry.containsStructure(target, field.TypeInfo.FullTypePath, key, visiting) {
+			return true
+		}
+	}
+	return false
+}
+
+var predeclaredAliases = map[string]string{}
+
+func init() {
+	suffixes := map[string]string{"f": "f32", "h": "f16", "i": "i32", "u": "u32"}
+
+	for suffix, scalar := range suffixes {
+		for n := 2; n <= 4; n++ {
+			vec := "vec" + strconv.Itoa(n)
+			predeclaredAliases[vec+suffix] = vec + "<" + scalar + ">"
+		}
+
+		if suffix != "f" && suffix != "h" {
+			continue
+		}
+
+		for c := 2; c <= 4; c++ {
+			for r := 2; r <= 4; r++ {
+				mat := "mat" + strconv.Itoa(c) + "x" + strconv.Itoa(r)
+				predeclaredAliases[mat+suffix] = mat + "<" + scalar + ">"
+			}
+		}
+	}
+}
+
+// NormalizeTypeAlias expands WGSL predeclared aliases such as `vec3f` or
+// `mat4x4h`, recursively through template arguments, and normalizes spacing.
+func NormalizeTypeAlias(typ string) string {
+	typ = strings.TrimSpace(typ)
+	if alias, ok := predeclaredAliases[typ]; ok {
+		return alias
+	}
+
+	name, args := splitTemplateType(typ)
+	if len(args) == 0 {
+		return typ
+	}
+
+	for i := range args {
+		args[i] = NormalizeTypeAlias(args[i])
+	}
+
+	return name + "<" + strings.Join(args, ", ") + ">"
+}
+
+// splitTemplateType splits `array<vec4<f32>, 4>` into `array` and its
+// top level arguments `vec4<f32>` and `4`. Module paths are dropped from the
+// name but kept in arguments.
+func splitTemplateType(typ string) (string, []string) {
+	typ = strings.TrimSpace(typ)
+	open := strings.Index(typ, "<")
+	if open == -1 || !strings.HasSuffix(typ, ">") {
+		return utils.RemovePath(typ), nil
+	}
+
+	return utils.RemovePath(typ[:open]), utils.SplitParams(typ[open+1 : len(typ)-1])
+}
@@ -0,0 +1,409 @@
+package wgsl
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+
+	utils "main/utils"
+)
+
+// ModuleRegistry indexes every parsed file together with the modules exported
+// through `#define_import_path`, so that identifiers can be resolved across files.
+type ModuleRegistry struct {
+	Files   []*WgslFile
+	Modules map[string]*WgslFile
+
+	Diagnostics DiagnosticCollector
+}
+
+func NewModuleRegistry(files []WgslFile) *ModuleRegistry {
+	registry := &ModuleRegistry{
+		Files:   make([]*WgslFile, 0, len(files)),
+		Modules: make(map[string]*WgslFile),
+	}
+
+	for i := range files {
+		file := &files[i]
+		registry.Files = append(registry.Files, file)
+
+		if file.ImportPath != nil {
+			registry.Modules[*file.ImportPath] = file
+		}
+	}
+
+	return registry
+}
+
+// ResolveItem finds the file declaring the item an identifier used inside
+// file refers to. Local declarations win over imports; qualified identifiers
+// like `view_transformations::position_world_to_clip` are resolved through
+// the imported module alias first and then as an absolute path.
+func (registry *ModuleRegistry) ResolveItem(file *WgslFile, ident string) (*WgslFile, string, bool) {
+	head, rest, qualified := strings.Cut(ident, "::")
+
+	if !qualified {
+		if file.declares(ident) {
+			return file, ident, true
+		}
+		if paths, ok := file.DeclaredImports[ident]; ok && len(paths) > 0 {
+			return registry.resolvePath(paths[0])
+		}
+		return nil, "", false
+	}
+
+	if paths, ok := file.DeclaredImports[head]; ok && len(paths) > 0 {
+		return registry.resolvePath(paths[0] + "::" + rest)
+	}
+
+	return registry.resolvePath(ident)
+}
+
+func (registry *ModuleRegistry) resolvePath(path string) (*WgslFile, string, bool) {
+	file, item, ok := registry.splitModulePath(path)
+	if !ok || !file.declares(item) {
+		return nil, "", false
+	}
+
+	return file, item, true
+}
+
+// splitModulePath returns the module of the longest import path prefixing
+// path and the item named by the rest of it
+func (registry *ModuleRegistry) splitModulePath(path string) (*WgslFile, string, bool) {
+	var longestMatch string
+	for module := range registry.Modules {
+		if strings.HasPrefix(path, module+"::") && len(module) > len(longestMatch) {
+			longestMatch = module
+		}
+	}
+
+	if longestMatch == "" {
+		return nil, "", false
+	}
+
+	return registry.Modules[longestMatch], utils.RemovePath(path[len(longestMatch)+2:]), true
+}
+
+// resolveAlias finds the type an identifier used inside file stands for when
+// it names a project `alias`, declared locally or imported.
+func (registry *ModuleRegistry) resolveAlias(file *WgslFile, ident string) (*WgslFile, string, bool) {
+	if typ, ok := file.Aliases[ident]; ok {
+		return file, typ, true
+	}
+
+	head, rest, qualified := strings.Cut(ident, "::")
+	path := ident
+	if paths, ok := file.DeclaredImports[head]; ok && len(paths) > 0 {
+		path = paths[0]
+		if qualified {
+			path += "::" + rest
+		}
+	} else if !qualified {
+		return nil, "", false
+	}
+
+	target, item, ok := registry.splitModulePath(path)
+	if !ok {
+		return nil, "", false
+	}
+	typ, ok := target.Aliases[item]
+	return target, typ, ok
+}
+
+func (wgslFile *WgslFile) declares(name string) bool {
+	return slices.ContainsFunc(wgslFile.Functions, func(v Function) bool { return v.Name == name }) ||
+		slices.ContainsFunc(wgslFile.Bindings, func(v Binding) bool { return v.Name == name }) ||
+		slices.ContainsFunc(wgslFile.ModuleVars, func(v ModuleVar) bool { return v.Name == name }) ||
+		slices.ContainsFunc(wgslFile.Structures, func(v Structure) bool { return v.Name == name }) ||
+		slices.ContainsFunc(wgslFile.Consts, func(v Const) bool { return v.Name == name })
+}
+
+// ModuleName is the import path of the file, or its filename for root shaders.
+func (wgslFile *WgslFile) ModuleName() string {
+	return utils.ValueOrDefault(wgslFile.ImportPath, wgslFile.Filename)
+}
+
+// ItemLink is the absolute link to an item anchor on the file's page, or to
+// the page itself for an empty name.
+func (wgslFile *WgslFile) ItemLink(name string) string {
+	if name == "" {
+		return utils.NormalizeLink(wgslFile.Link)
+	}
+	return utils.NormalizeLink(wgslFile.Link) + "#" + name
+}
+
+type itemKey struct {
+	file *WgslFile
+	name string
+}
+
+type bodyReference struct {
+	name   string
+	access string
+	isCall bool
+	line   int
+}
+
+// AnalyzeResourceUsage walks the call graph of every entry point, through
+// imported modules, and records which module-scope bindings and variables
+// it reads or writes. Shader def branches are not evaluated, so the result
+// is the union over all variants.
+func (registry *ModuleRegistry) AnalyzeResourceUsage() {
+	memo := make(map[itemKey]map[itemKey]string)
+
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			if fn.StageAttribute == "" {
+				continue
+			}
+
+			usage := registry.functionUsage(file, fn.Name, memo, map[itemKey]bool{})
+			fn.Resources = registry.resourceList(usage)
+			fn.HasResources = len(fn.Resources) != 0
+		}
+	}
+}
+
+func (registry *ModuleRegistry) functionUsage(
+	file *WgslFile, name string, memo map[itemKey]map[itemKey]string, visiting map[itemKey]bool,
+) map[itemKey]string {
+	key := itemKey{file, name}
+	if usage, ok := memo[key]; ok {
+		return usage
+	}
+	if visiting[key] {
+		return nil
+	}
+	visiting[key] = true
+
+	usage := make(map[itemKey]string)
+
+	for i := range file.Functions {
+		fn := &file.Functions[i]
+		if fn.Name != name {
+			continue
+		}
+
+		for _, ref := range scanBodyReferences(fn) {
+			target, item, ok := registry.ResolveItem(file, ref.name)
+			if !ok {
+				continue
+			}
+
+			if ref.isCall {
+				for callee, access := range registry.functionUsage(target, item, memo, visiting) {
+					usage[callee] = mergeAccess(usage[callee], access)
+				}
+				continue
+			}
+
+			if target.isResource(item) {
+				resource := itemKey{target, item}
+				usage[resource] = mergeAccess(usage[resource], ref.access)
+			}
+		}
+	}
+
+	delete(visiting, key)
+	memo[key] = usage
+
+	return usage
+}
+
+func (wgslFile *WgslFile) isResource(name string) bool {
+	return slices.ContainsFunc(wgslFile.Bindings, func(v Binding) bool { return v.Name == name }) ||
+		slices.ContainsFunc(wgslFile.ModuleVars, func(v ModuleVar) bool { return v.Name == name })
+}
+
+func (registry *ModuleRegistry) resourceList(usage map[itemKey]string) []ResourceUsage {
+	resources := make([]ResourceUsage, 0, len(usage))
+
+	for key, access := range usage {
+		resource := ResourceUsage{
+			Name:   key.name,
+			Module: key.file.ModuleName(),
+			Link:   key.file.ItemLink(key.name),
+			Access: access,
+			File:   key.file,
+		}
+
+		if idx := slices.IndexFunc(key.file.Bindings, func(v Binding) bool { return v.Name == key.name }); idx != -1 {
+			binding := key.file.Bindings[idx]
+			resource.Kind = "binding"
+			resource.Link = key.file.ItemLink(cmp.Or(binding.Anchor, binding.Name))
+			resource.AddressSpace = bindingAddressSpace(binding)
+			for _, annotation := range binding.Annotations {
+				switch annotation.Name {
+				case "group":
+					resource.Group = annotation.Value
+				case "binding":
+					resource.Binding = annotation.Value
+				}
+			}
+		} else if idx := slices.IndexFunc(key.file.ModuleVars, func(v ModuleVar) bool { return v.Name == key.name }); idx != -1 {
+			resource.Kind = "var"
+			resource.AddressSpace = key.file.ModuleVars[idx].AddressSpace
+		}
+
+		resources = append(resources, resource)
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		// numeric strings, shorter ones are smaller
+		if len(a.Group) != len(b.Group) {
+			return len(a.Group) < len(b.Group)
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if len(a.Binding) != len(b.Binding) {
+			return len(a.Binding) < len(b.Binding)
+		}
+		if a.Binding != b.Binding {
+			return a.Binding < b.Binding
+		}
+		return a.Name < b.Name
+	})
+
+	return resources
+}
+
+// address space of a binding, textures and samplers live in `handle`
+func bindingAddressSpace(binding Binding) string {
+	if binding.BindingType == "" {
+		return "handle"
+	}
+	return strings.TrimSpace(strings.Split(binding.BindingType, ",")[0])
+}
+
+func mergeAccess(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	default:
+		return "read_write"
+	}
+}
+
+var declarationKeywords = []string{"let", "var", "const"}
+
+// scanBodyReferences lists the identifiers a function body calls or
+// references, skipping locals, parameters and member accesses.
+func scanBodyReferences(fn *Function) []bodyReference {
+	lexemes := withoutDirectives(SignificantLexemes(Lex(fn.Body)))
+	locals := make(map[string]bool)
+	for _, param := range fn.Params {
+		locals[param.Name] = true
+	}
+
+	var refs []bodyReference
+
+	for i, lexeme := range lexemes {
+		if lexeme.Kind != LexIdent {
+			continue
+		}
+
+		if slices.Contains(declarationKeywords, lexeme.Text) {
+			if name := declaredLocal(lexemes, i); name != "" {
+				locals[name] = true
+			}
+			continue
+		}
+
+		if locals[lexeme.Text] || (i > 0 && lexemes[i-1].Text == ".") {
+			continue
+		}
+
+		line := fn.BodyStartLine + lexeme.Line - 1
+
+		if i+1 < len(lexemes) && lexemes[i+1].Text == "(" {
+			refs = append(refs, bodyReference{name: lexeme.Text, isCall: true, line: line})
+			continue
+		}
+
+		refs = append(refs, bodyReference{
+			name:   lexeme.Text,
+			access: referenceAccess(lexemes, i),
+			line:   line,
+		})
+	}
+
+	return refs
+}
+
+func withoutDirectives(lexemes []Lexeme) []Lexeme {
+	return slices.DeleteFunc(lexemes, func(v Lexeme) bool { return v.Kind == LexDirective })
+}
+
+// name declared by `let x`, `var x` or `var<function> x`
+func declaredLocal(lexemes []Lexeme, i int) string {
+	j := i + 1
+	if j < len(lexemes) && lexemes[j].Text == "<" {
+		for j < len(lexemes) && lexemes[j].Text != ">" {
+			j++
+		}
+		j++
+	}
+	if j < len(lexemes) && lexemes[j].Kind == LexIdent {
+		return lexemes[j].Text
+	}
+	return ""
+}
+
+// classifies the reference at i as a read, a write or both by looking at
+// the assignment following its member/index chain
+func referenceAccess(lexemes []Lexeme, i int) string {
+	if i > 0 && lexemes[i-1].Text == "&" {
+		return "read_write"
+	}
+
+	j := i + 1
+	for j < len(lexemes) {
+		if lexemes[j].Text == "." && j+1 < len(lexemes) && lexemes[j+1].Kind == LexIdent {
+			j += 2
+		} else if lexemes[j].Text == "[" {
+			j = skipBalanced(lexemes, j, "[", "]")
+		} else {
+			break
+		}
+	}
+
+	if j >= len(lexemes) {
+		return "read"
+	}
+
+	switch lexemes[j].Text {
+	case "=":
+		return "write"
+	case "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<=", ">>=", "++", "--":
+		return "read_write"
+	}
+
+	return "read"
+}
+
+// returns the index just past the closing lexeme matching the opening one at i
+func skipBalanced(lexemes []Lexeme, i int, open, close string) int {
+	depth := 0
+	for ; i < len(lexemes); i++ {
+		switch lexemes[i].Text {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,196 @@
+package wgsl
+
+import (
+	"fmt"
+	"strings"
+
+	utils "main/utils"
+)
+
+// glam has no f16 vectors or matrices
+var rustScalarPrefixes = map[string]string{
+	"f32": "",
+	"i32": "I",
+	"u32": "U",
+}
+
+var rustViewDimensions = map[string]string{
+	"D1":        "1d",
+	"D2":        "2d",
+	"D2Array":   "2d_array",
+	"D3":        "3d",
+	"Cube":      "cube",
+	"CubeArray": "cube_array",
+}
+
+// GenerateRustBindGroupLayouts renders Rust source with one
+// `BindGroupLayoutEntries` call per bind group, built from Bevy's
+// `binding_types` helpers. Groups with contiguous bindings starting at zero use
+// `sequential`, the others `with_indices`. Bindings without a Rust helper,
+// such as external textures or combined GLSL samplers, are an error.
+func GenerateRustBindGroupLayouts(source string, groups []BindGroupLayout, visibility []string) (string, error) {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "// Bind group layouts generated from `%s`\n", source)
+	out.WriteString("use bevy::render::render_resource::{binding_types::*, *};\n")
+	out.WriteString("use core::num::NonZero;\n")
+
+	stages := make([]string, 0, len(visibility))
+	for _, stage := range visibility {
+		stages = append(stages, "ShaderStages::"+strings.ToUpper(strings.TrimSpace(stage)))
+	}
+
+	for _, group := range groups {
+		sequential := true
+		for i, entry := range group.Entries {
+			if entry.Binding != uint32(i) {
+				sequential = false
+			}
+		}
+
+		constructor := "sequential"
+		if !sequential {
+			constructor = "with_indices"
+		}
+
+		fmt.Fprintf(&out, "\n// @group(%d)\n", group.Group)
+		fmt.Fprintf(&out, "let group_%d_layout_entries = BindGroupLayoutEntries::%s(\n", group.Group, constructor)
+		fmt.Fprintf(&out, "    %s,\n", strings.Join(stages, " | "))
+		out.WriteString("    (\n")
+
+		for _, entry := range group.Entries {
+			fmt.Fprintf(&out, "        // @binding(%d) %s: %s", entry.Binding, entry.Name, entry.WgslType)
+			for _, def := range entry.ShaderDefs {
+				fmt.Fprintf(&out, " [%s %s]", def.Branch, def.DefName)
+			}
+			out.WriteString("\n")
+
+			builder, err := rustBindingBuilder(entry)
+			if err != nil {
+				return "", err
+			}
+			if sequential {
+				fmt.Fprintf(&out, "        %s,\n", builder)
+			} else {
+				fmt.Fprintf(&out, "        (%d, %s),\n", entry.Binding, builder)
+			}
+		}
+
+		out.WriteString("    ),\n")
+		out.WriteString(");\n")
+	}
+
+	return out.String(), nil
+}
+
+func rustBindingBuilder(entry BindGroupLayoutEntry) (string, error) {
+	builder, ok := rustBindingType(entry)
+	if !ok {
+		return "", fmt.Errorf("binding `%s` has unsupported type `%s`", entry.Name, entry.WgslType)
+	}
+	if entry.Count != nil {
+		builder += fmt.Sprintf(".count(NonZero::<u32>::new(%d).unwrap())", *entry.Count)
+	}
+	return builder, nil
+}
+
+func rustBindingType(entry BindGroupLayoutEntry) (string, bool) {
+	ty := entry.Ty
+	innerType := entry.WgslType
+	if name, args := splitTemplateType(NormalizeTypeAlias(innerType)); name == "binding_array" && len(args) > 0 {
+		innerType = args[0]
+	}
+
+	switch ty.Type {
+	case "Buffer":
+		helper := "uniform_buffer"
+		if ty.BufferType == "Storage" {
+			helper = "storage_buffer"
+			if ty.ReadOnly != nil && *ty.ReadOnly {
+				helper = "storage_buffer_read_only"
+			}
+		}
+
+		rustType, ok := rustShaderType(innerType)
+		if !ok {
+			return helper + "_sized(false, None)", true
+		}
+		return fmt.Sprintf("%s::<%s>(false)", helper, rustType), true
+
+	case "Sampler":
+		return fmt.Sprintf("sampler(SamplerBindingType::%s)", ty.SamplerType), true
+
+	case "Texture":
+		dimension := rustViewDimensions[ty.ViewDimension]
+		multisampled := ty.Multisampled != nil && *ty.Multisampled
+
+		if ty.SampleType == "Depth" {
+			if multisampled {
+				return "texture_depth_2d_multisampled()", true
+			}
+			return fmt.Sprintf("texture_depth_%s()", dimension), true
+		}
+
+		sampleType := "TextureSampleType::" + ty.SampleType
+		if ty.SampleType == "Float" {
+			sampleType = fmt.Sprintf("TextureSampleType::Float { filterable: %t }", ty.Filterable != nil && *ty.Filterable)
+		}
+
+		if multisampled {
+			return fmt.Sprintf("texture_2d_multisampled(%s)", sampleType), true
+		}
+		return fmt.Sprintf("texture_%s(%s)", dimension, sampleType), true
+
+	case "StorageTexture":
+		return fmt.Sprintf(
+			"texture_storage_%s(TextureFormat::%s, StorageTextureAccess::%s)",
+			rustViewDimensions[ty.ViewDimension], ty.Format, ty.Access,
+		), true
+	}
+
+	return "", false
+}
+
+// rustShaderType maps a host-shareable WGSL type to the matching glam or
+// user type. Runtime sized arrays have no fixed size `ShaderType` equivalent.
+func rustShaderType(typ string) (string, bool) {
+	name, args := splitTemplateType(NormalizeTypeAlias(typ))
+
+	if _, ok := rustScalarPrefixes[name]; ok || name == "f16" {
+		return name, true
+	}
+
+	switch {
+	case strings.HasPrefix(name, "vec") && len(args) == 1:
+		prefix, ok := rustScalarPrefixes[args[0]]
+		if !ok {
+			return "", false
+		}
+		return prefix + "Vec" + strings.TrimPrefix(name, "vec"), true
+
+	case strings.HasPrefix(name, "mat") && len(args) == 1:
+		dims := strings.Split(strings.TrimPrefix(name, "mat"), "x")
+		if len(dims) != 2 || dims[0] != dims[1] || args[0] != "f32" {
+			return "", false
+		}
+		return "Mat" + dims[0], true
+
+	case name == "array":
+		if len(args) < 2 {
+			return "", false
+		}
+		element, ok := rustShaderType(args[0])
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("[%s; %s]", element, strings.TrimRight(args[1], "ui")), true
+
+	case name == "atomic":
+		if len(args) == 0 {
+			return "", false
+		}
+		return rustShaderType(args[0])
+	}
+
+	return utils.RemovePath(typ), true
+}
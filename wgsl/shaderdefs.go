@@ -0,0 +1,206 @@
+package wgsl
+
+import (
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+
+	lo "github.com/samber/lo"
+)
+
+var shaderDefTestPattern = regexp.MustCompile(`(\w+)\s*(==|!=|<=|>=|<|>)\s*(\w+)`)
+var shaderDefNamePattern = regexp.MustCompile(`[A-Za-z_]\w*`)
+var typeReferencePattern = regexp.MustCompile(`[A-Za-z_]\w*(?:::[A-Za-z_]\w*)*`)
+
+// RelevantShaderDef is a shader def tested by code reachable from an entry
+// point, with the values `#if` comparisons check it against.
+type RelevantShaderDef struct {
+	Name    string   `json:"name"`
+	Values  []string `json:"values,omitempty"`
+	Modules []string `json:"modules"`
+}
+
+// AnalyzeShaderDefReachability walks the call graph of every entry point and
+// the types, constants and resources it references, through imported
+// modules, and collects the shader defs guarding any reachable declaration
+// or body line.
+func (registry *ModuleRegistry) AnalyzeShaderDefReachability() {
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			if fn.StageAttribute == "" {
+				continue
+			}
+
+			fn.RelevantShaderDefs = registry.relevantShaderDefs(file, fn.Name)
+			fn.HasRelevantShaderDefs = len(fn.RelevantShaderDefs) != 0
+			fn.ShaderVariants = countShaderVariants(fn.RelevantShaderDefs)
+		}
+	}
+}
+
+func (registry *ModuleRegistry) relevantShaderDefs(file *WgslFile, entryPoint string) []RelevantShaderDef {
+	values := make(map[string]map[string]bool)
+	modules := make(map[string]map[string]bool)
+
+	visited := make(map[itemKey]bool)
+	queue := []itemKey{{file, entryPoint}}
+
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		conditions, refs := key.file.itemDependencies(key.name)
+
+		for _, condition := range conditions {
+			for name, compared := range shaderDefTests(condition) {
+				if values[name] == nil {
+					values[name] = make(map[string]bool)
+					modules[name] = make(map[string]bool)
+				}
+				for _, value := range compared {
+					values[name][value] = true
+				}
+				modules[name][key.file.ModuleName()] = true
+			}
+		}
+
+		for _, ref := range refs {
+			if target, item, ok := registry.ResolveItem(key.file, ref); ok {
+				queue = append(queue, itemKey{target, item})
+			}
+		}
+	}
+
+	defs := make([]RelevantShaderDef, 0, len(values))
+	for name := range values {
+		defs = append(defs, RelevantShaderDef{
+			Name:    name,
+			Values:  slices.Sorted(maps.Keys(values[name])),
+			Modules: slices.Sorted(maps.Keys(modules[name])),
+		})
+	}
+
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+
+	return defs
+}
+
+// itemDependencies returns the shader def conditions guarding the item named
+// name, and the identifiers its declaration and body refer to. Items declared
+// in several shader def branches are merged.
+func (wgslFile *WgslFile) itemDependencies(name string) ([]string, []string) {
+	var conditions, refs []string
+
+	addDefs := func(defs []DefResult) {
+		for _, def := range defs {
+			conditions = append(conditions, def.DefName)
+		}
+	}
+	addType := func(typeInfo TypeInfo) {
+		refs = append(refs, typeReferencePattern.FindAllString(typeInfo.Type, -1)...)
+	}
+
+	for _, fn := range wgslFile.Functions {
+		if fn.Name != name {
+			continue
+		}
+
+		// blocks around the function and inside its body
+		for _, block := range wgslFile.ShaderDefBlocks {
+			if block.IfdefLine <= fn.BodyEndLine && block.EndifLine >= fn.LineNumber {
+				conditions = append(conditions, block.DefName)
+			}
+		}
+
+		for _, param := range fn.Params {
+			addType(param.TypeInfo)
+		}
+		addType(fn.ReturnTypeInfo)
+
+		for _, ref := range scanBodyReferences(&fn) {
+			refs = append(refs, ref.name)
+		}
+	}
+
+	for _, structure := range wgslFile.Structures {
+		if structure.Name != name {
+			continue
+		}
+
+		addDefs(structure.ShaderDefs)
+		for _, field := range structure.Fields {
+			addDefs(field.ShaderDefs)
+			addType(field.TypeInfo)
+		}
+	}
+
+	for _, binding := range wgslFile.Bindings {
+		if binding.Name == name {
+			addDefs(binding.ShaderDefs)
+			addType(binding.TypeInfo)
+		}
+	}
+
+	for _, moduleVar := range wgslFile.ModuleVars {
+		if moduleVar.Name == name {
+			addDefs(moduleVar.ShaderDefs)
+			addType(moduleVar.TypeInfo)
+		}
+	}
+
+	for _, constant := range wgslFile.Consts {
+		if constant.Name == name {
+			addDefs(constant.ShaderDefs)
+			addType(constant.TypeInfo)
+		}
+	}
+
+	return conditions, refs
+}
+
+// shaderDefTests maps every def a condition such as `!A`, `A && B` or
+// `MAX_LIGHTS > 4` tests to the values it is compared against.
+func shaderDefTests(condition string) map[string][]string {
+	tests := make(map[string][]string)
+
+	for _, match := range shaderDefTestPattern.FindAllStringSubmatch(condition, -1) {
+		tests[match[1]] = append(tests[match[1]], match[3])
+	}
+
+	for _, name := range shaderDefNamePattern.FindAllString(shaderDefTestPattern.ReplaceAllString(condition, ""), -1) {
+		if slices.Contains([]string{"true", "false", "defined"}, name) {
+			continue
+		}
+		if _, ok := tests[name]; !ok {
+			tests[name] = nil
+		}
+	}
+
+	return tests
+}
+
+// countShaderVariants is the theoretical number of variants: a flag is either
+// set or not, a compared def takes each compared value or any other one.
+// Saturates instead of overflowing.
+func countShaderVariants(defs []RelevantShaderDef) uint64 {
+	count := uint64(1)
+
+	for _, def := range defs {
+		choices := uint64(lo.Ternary(len(def.Values) == 0, 2, len(def.Values)+1))
+		if count > math.MaxUint64/choices {
+			return math.MaxUint64
+		}
+		count *= choices
+	}
+
+	return count
+}
@@ -0,0 +1,275 @@
+package wgsl
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	utils "main/utils"
+
+	lo "github.com/samber/lo"
+)
+
+// ranks deprecated functions after matches with a few extra parameters, the
+// search page reads it from the RankPenalty of the index entries
+const deprecatedPenalty = 10
+
+var typeVariablePattern = regexp.MustCompile(`^(?:[A-Z]|_)$`)
+var glslVectorPattern = regexp.MustCompile(`^([iub]?)vec([234])$`)
+var glslMatrixPattern = regexp.MustCompile(`^mat([234])(?:x([234]))?$`)
+
+var glslScalarTypes = map[string]string{"float": "f32", "int": "i32", "uint": "u32", "bool": "bool"}
+var glslVectorScalars = map[string]string{"": "f32", "i": "i32", "u": "u32", "b": "bool"}
+
+// SignatureEntry is a function of the signature index, with its parameter and
+// return types normalized so that they can be compared across modules.
+type SignatureEntry struct {
+	Link       string   `json:"link"`
+	Filename   string   `json:"filename"`
+	Exportable bool     `json:"exportable"`
+	Name       string   `json:"name"`
+	Anchor     string   `json:"anchor,omitempty"`
+	Type       string   `json:"type"`
+	Module     string   `json:"module"`
+	Signature  string   `json:"signature"`
+	Params     []string `json:"params"`
+	ReturnType string   `json:"returnType"`
+	Deprecated bool     `json:"deprecated,omitempty"`
+	// added to the penalty of every match of the entry
+	RankPenalty int `json:"rankPenalty,omitempty"`
+}
+
+// SignatureQuery is a parsed `vec3<f32>, vec3<f32> -> f32` query. An empty
+// ReturnType matches any return type.
+type SignatureQuery struct {
+	Params     []string
+	ReturnType string
+}
+
+type SignatureMatch struct {
+	SignatureEntry
+	// 0 for an exact match, grows with extra and reordered parameters and
+	// for deprecated functions
+	Penalty int `json:"penalty"`
+}
+
+// SignatureIndex lists every function that can be called, entry points are
+// left out.
+func (registry *ModuleRegistry) SignatureIndex() []SignatureEntry {
+	var index []SignatureEntry
+
+	for _, file := range registry.Files {
+		for _, fn := range file.Functions {
+			if fn.StageAttribute != "" {
+				continue
+			}
+
+			entry := SignatureEntry{
+				Link:       utils.NormalizeLink(file.Link),
+				Filename:   file.Filename,
+				Exportable: file.ImportPath != nil,
+				Name:       fn.Name,
+				Anchor:     fn.Anchor,
+				Type:       "function",
+				Module:     file.ModuleName(),
+				Params:     make([]string, 0, len(fn.Params)),
+				ReturnType: NormalizeSignatureType(registry.expandAliases(file, fn.ReturnTypeInfo.Type, 0), file.IsGLSL),
+				Deprecated: fn.Tags.Deprecated,
+			}
+			if entry.Deprecated {
+				entry.RankPenalty = deprecatedPenalty
+			}
+
+			var params []string
+			for _, param := range fn.Params {
+				typ := NormalizeSignatureType(registry.expandAliases(file, param.TypeInfo.Type, 0), file.IsGLSL)
+				entry.Params = append(entry.Params, typ)
+				params = append(params, param.Name+": "+typ)
+			}
+
+			entry.Signature = fmt.Sprintf("fn %s(%s) -> %s", fn.Name, strings.Join(params, ", "), entry.ReturnType)
+
+			// declared again in another shader def branch, the entry then links
+			// to the group of variants
+			if i := slices.IndexFunc(index, func(v SignatureEntry) bool { return v.Link == entry.Link && v.Signature == entry.Signature }); i != -1 {
+				index[i].Anchor = fn.Name
+				continue
+			}
+			index = append(index, entry)
+		}
+	}
+
+	return index
+}
+
+// expandAliases replaces the project aliases typ refers to inside file with
+// the type they stand for, through aliases of aliases
+func (registry *ModuleRegistry) expandAliases(file *WgslFile, typ string, depth int) string {
+	// aliases cannot be recursive, the limit only guards against bad input
+	if depth > 8 {
+		return typ
+	}
+
+	return typeReferencePattern.ReplaceAllStringFunc(typ, func(ident string) string {
+		if target, aliased, ok := registry.resolveAlias(file, ident); ok {
+			return registry.expandAliases(target, aliased, depth+1)
+		}
+		return ident
+	})
+}
+
+// NormalizeSignatureType drops module paths, maps GLSL types onto their WGSL
+// equivalent and expands predeclared aliases, e.g. `vec3f`, `vec3` in GLSL
+// and `vec3< f32 >` all become `vec3<f32>`.
+func NormalizeSignatureType(typ string, glsl bool) string {
+	typ = typeReferencePattern.ReplaceAllStringFunc(typ, func(ident string) string {
+		ident = utils.RemovePath(ident)
+		if glsl {
+			return glslTypeName(ident)
+		}
+		return ident
+	})
+
+	return NormalizeTypeAlias(typ)
+}
+
+func glslTypeName(name string) string {
+	if scalar, ok := glslScalarTypes[name]; ok {
+		return scalar
+	}
+	if match := glslVectorPattern.FindStringSubmatch(name); match != nil {
+		return "vec" + match[2] + "<" + glslVectorScalars[match[1]] + ">"
+	}
+	if match := glslMatrixPattern.FindStringSubmatch(name); match != nil {
+		return "mat" + match[1] + "x" + lo.CoalesceOrEmpty(match[2], match[1]) + "<f32>"
+	}
+	return name
+}
+
+// ParseSignatureQuery parses `params -> return`. Both sides are optional,
+// `_` and single uppercase letters are type variables.
+func ParseSignatureQuery(query string) SignatureQuery {
+	params, returnType, _ := strings.Cut(query, "->")
+
+	parsed := SignatureQuery{ReturnType: NormalizeSignatureType(returnType, false)}
+	for _, param := range utils.SplitParams(params) {
+		parsed.Params = append(parsed.Params, NormalizeSignatureType(param, false))
+	}
+
+	return parsed
+}
+
+// SearchSignatures finds the functions taking at least the query parameters,
+// in any order, and returning its return type. Exact matches come first.
+func SearchSignatures(index []SignatureEntry, query SignatureQuery) []SignatureMatch {
+	var matches []SignatureMatch
+
+	for _, entry := range index {
+		if penalty, ok := matchSignature(entry, query); ok {
+			matches = append(matches, SignatureMatch{entry, penalty})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Penalty != matches[j].Penalty {
+			return matches[i].Penalty < matches[j].Penalty
+		}
+		return matches[i].Name < matches[j].Name
+	})
+
+	return matches
+}
+
+func matchSignature(entry SignatureEntry, query SignatureQuery) (int, bool) {
+	if len(query.Params) > len(entry.Params) {
+		return 0, false
+	}
+
+	vars := make(map[string]string)
+	if query.ReturnType != "" && !matchType(query.ReturnType, entry.ReturnType, vars) {
+		return 0, false
+	}
+
+	assignment, ok := assignParams(query.Params, entry.Params, make([]bool, len(entry.Params)), vars)
+	if !ok {
+		return 0, false
+	}
+
+	penalty := 2 * (len(entry.Params) - len(query.Params))
+	if !sort.IntsAreSorted(assignment) {
+		penalty++
+	}
+	penalty += entry.RankPenalty
+
+	return penalty, true
+}
+
+// assignParams matches every query parameter to a distinct parameter of the
+// function, trying them in declaration order first
+func assignParams(patterns, params []string, used []bool, vars map[string]string) ([]int, bool) {
+	if len(patterns) == 0 {
+		return []int{}, true
+	}
+
+	for i, param := range params {
+		if used[i] {
+			continue
+		}
+
+		attempt := maps.Clone(vars)
+		if !matchType(patterns[0], param, attempt) {
+			continue
+		}
+
+		used[i] = true
+		rest, ok := assignParams(patterns[1:], params, used, attempt)
+		used[i] = false
+
+		if ok {
+			maps.Copy(vars, attempt)
+			return append([]int{i}, rest...), true
+		}
+	}
+
+	return nil, false
+}
+
+// matchType compares a query type with a normalized type. Type variables bind
+// to the first type they match, a template name without arguments such as
+// `vec3` matches any `vec3<T>`.
+func matchType(pattern, typ string, vars map[string]string) bool {
+	if typeVariablePattern.MatchString(pattern) {
+		if pattern == "_" {
+			return true
+		}
+		if bound, ok := vars[pattern]; ok {
+			return bound == typ
+		}
+		vars[pattern] = typ
+		return true
+	}
+
+	patternName, patternArgs := splitTemplateType(pattern)
+	name, args := splitTemplateType(typ)
+
+	if patternName != name {
+		return false
+	}
+	if len(patternArgs) == 0 {
+		return true
+	}
+	if len(patternArgs) != len(args) {
+		return false
+	}
+
+	for i := range patternArgs {
+		if !matchType(patternArgs[i], args[i], vars) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -10,6 +10,13 @@ type WgslFile struct {
 	Version    string  `json:"version"`
 	ImportPath *string `json:"importPath"`
 	WgslPath   string  `json:"wgslFile"`
+	Language   string  `json:"language"`
+	IsGLSL     bool    `json:"isGLSL"`
+	IsWESL     bool    `json:"isWESL"`
+
+	// `//!` lines or leading comment blocks documenting the whole module
+	ModuleDoc     string `json:"moduleDoc"`
+	ModuleDocLine int    `json:"-"`
 
 	Consts           []Const `json:"consts"`
 	ConstsShaderDefs bool    `json:"constsShaderDefs"`
@@ -22,14 +29,31 @@ type WgslFile struct {
 	Functions         []Function `json:"functions"`
 	NotEmptyFunctions bool       `json:"notEmptyFunctions"`
 
+	ModuleVars         []ModuleVar `json:"moduleVars"`
+	NotEmptyModuleVars bool        `json:"notEmptyModuleVars"`
+
 	Structures           []Structure     `json:"structures"`
 	StructuresShaderDefs bool            `json:"structuresShaderDefs"`
 	NotEmptyStructures   bool            `json:"notEmptyStructures"`
 	DeclaredImports      DeclaredImports `json:"declaredImports"`
+	// line of the import declaring each identifier of DeclaredImports
+	ImportLines map[string]int `json:"-"`
+	// type of every `alias` declaration
+	Aliases map[string]string `json:"-"`
 
 	Filename   string `json:"filename"`
+	FilePath   string `json:"-"`
 	GithubLink string `json:"githubLink"`
 	Link       string `json:"link"`
+
+	// every shader def block of the module, including those inside bodies
+	ShaderDefBlocks []ShaderDefBlock `json:"-"`
+
+	// TODO, FIXME, HACK and NOTE comments
+	Notes []ShaderNote `json:"-"`
+
+	// families of bitflag constants, such as MESH_FLAGS_*
+	FlagGroups []FlagGroup `json:"flagGroups,omitempty"`
 }
 
 type ShaderDefBlock struct {
@@ -46,6 +70,25 @@ type Const struct {
 	Value         string      `json:"value"`
 	HasShaderDefs bool        `json:"hasShaderDefs"`
 	ShaderDefs    []DefResult `json:"shaderDefs"`
+	Comment       string      `json:"comment"`
+	Tags          DocTags     `json:"tags"`
+
+	// pipeline-overridable constant, `override` instead of `const`
+	IsOverride  bool         `json:"isOverride,omitempty"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// variantInfo locates the definitions of a structure or function written
+// once per shader def branch, see groupVariants.
+type variantInfo struct {
+	// id of the item on its page, the name unless the item has variants
+	Anchor string `json:"anchor"`
+	// set on every definition of an item defined in several shader def branches
+	IsVariant        bool   `json:"isVariant,omitempty"`
+	VariantCondition string `json:"variantCondition,omitempty"`
+	// set on the first definition only, it holds the anchor of the whole item
+	Variants     []ItemVariant `json:"variants,omitempty"`
+	VariantDiffs []VariantDiff `json:"-"`
 }
 
 type Structure struct {
@@ -53,10 +96,18 @@ type Structure struct {
 	Fields           []NamedType `json:"fields"`
 	LineNumber       int         `json:"lineNumber"`
 	Comment          string      `json:"comment"`
+	Tags             DocTags     `json:"tags"`
 	HasShaderDefs    bool        `json:"hasShaderDefs"`
 	ShaderDefs       []DefResult `json:"shaderDefs"`
 	HasFields        bool        `json:"hasFields"`
 	FieldsShaderDefs bool        `json:"fieldsShaderDefs"`
+
+	variantInfo
+
+	// filled by IndexTypeUsage
+	UsedIn    []TypeUsage    `json:"usedIn,omitempty"`
+	HasUsages bool           `json:"hasUsages"`
+	Contains  []StructureRef `json:"contains,omitempty"`
 }
 
 // field or param
@@ -66,6 +117,14 @@ type NamedType struct {
 	TypeInfo      TypeInfo     `json:"typeInfo"`
 	HasShaderDefs bool         `json:"hasShaderDefs"`
 	ShaderDefs    []DefResult  `json:"shaderDefs"`
+
+	// GLSL parameter qualifiers such as `out` or `inout`
+	Qualifier string `json:"qualifier,omitempty"`
+	// description from the `@param` tag of the function comment
+	Doc string `json:"doc,omitempty"`
+	// flag group held by struct fields such as `flags`, see LinkFlagGroups
+	FlagGroupName string `json:"flagGroupName,omitempty"`
+	FlagGroupLink string `json:"flagGroupLink,omitempty"`
 }
 
 type Function struct {
@@ -79,17 +138,92 @@ type Function struct {
 	HasShaderDefs    bool        `json:"hasShaderDefs"`
 	ShaderDefs       []DefResult `json:"shaderDefs"`
 	Comment          string      `json:"comment"`
+	Tags             DocTags     `json:"tags"`
 	HasParams        bool        `json:"hasParams"`
+
+	variantInfo
+
+	// set when a param or the return type has a `@param` or `@returns` description
+	HasParamDocs bool `json:"hasParamDocs"`
+	// names of `@param` tags matching no param, reported by CheckParamDocs
+	UnknownParamDocs []string `json:"-"`
+
+	// every attribute of the function, including the stage and workgroup size
+	Annotations []Annotation `json:"annotations"`
+	// attributes other than the stage and workgroup size, which are shown as badges
+	OtherAnnotations []Annotation `json:"-"`
+
+	// source of the body including the enclosing braces
+	Body            string `json:"-"`
+	BodyStartLine   int    `json:"bodyStartLine"`
+	BodyStartColumn int    `json:"-"`
+	BodyEndLine     int    `json:"bodyEndLine"`
+	// highlighted body shown on the doc page
+	BodyLines []SourceLine `json:"-"`
+
+	Resources    []ResourceUsage `json:"resources"`
+	HasResources bool            `json:"hasResources"`
+
+	// page with the composed shader of an entry point, when generated
+	ComposedLink string `json:"composedLink,omitempty"`
+
+	// shader defs tested by code reachable from an entry point
+	RelevantShaderDefs    []RelevantShaderDef `json:"relevantShaderDefs,omitempty"`
+	HasRelevantShaderDefs bool                `json:"hasRelevantShaderDefs"`
+	ShaderVariants        uint64              `json:"shaderVariants,omitempty"`
+
+	Metrics FunctionMetrics `json:"metrics"`
+
+	Diagnostics    []Diagnostic `json:"diagnostics,omitempty"`
+	HasDiagnostics bool         `json:"hasDiagnostics"`
 }
 
 type Binding struct {
-	LineNumber    int          `json:"lineNumber"`
-	Name          string       `json:"name"`
-	BindingType   string       `json:"bindingType"`
-	Annotations   []Annotation `json:"annotations"`
-	TypeInfo      TypeInfo     `json:"typeInfo"`
-	HasShaderDefs bool         `json:"hasShaderDefs"`
-	ShaderDefs    []DefResult  `json:"shaderDefs"`
+	LineNumber            int             `json:"lineNumber"`
+	Name                  string          `json:"name"`
+	Anchor                string          `json:"anchor"`
+	BindingType           string          `json:"bindingType"`
+	BindingTypeComponents []TypeComponent `json:"bindingTypeComponents,omitempty"`
+	Annotations           []Annotation    `json:"annotations"`
+	TypeInfo              TypeInfo        `json:"typeInfo"`
+	HasShaderDefs         bool            `json:"hasShaderDefs"`
+	ShaderDefs            []DefResult     `json:"shaderDefs"`
+	Comment               string          `json:"comment"`
+	Tags                  DocTags         `json:"tags"`
+
+	// GLSL `layout(...)` arguments and storage qualifiers
+	Layout    string `json:"layout,omitempty"`
+	Qualifier string `json:"qualifier,omitempty"`
+}
+
+// module-scope `var<private>` or `var<workgroup>` declaration, or a GLSL
+// stage input, output or `shared` variable
+type ModuleVar struct {
+	LineNumber    int         `json:"lineNumber"`
+	Name          string      `json:"name"`
+	AddressSpace  string      `json:"addressSpace"`
+	TypeInfo      TypeInfo    `json:"typeInfo"`
+	HasShaderDefs bool        `json:"hasShaderDefs"`
+	ShaderDefs    []DefResult `json:"shaderDefs"`
+
+	Layout    string `json:"layout,omitempty"`
+	Qualifier string `json:"qualifier,omitempty"`
+}
+
+// a module-scope binding or variable reachable from an entry point
+type ResourceUsage struct {
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	Module       string `json:"module"`
+	Link         string `json:"link"`
+	Group        string `json:"group,omitempty"`
+	Binding      string `json:"binding,omitempty"`
+	AddressSpace string `json:"addressSpace"`
+	Access       string `json:"access"`
+
+	// file declaring the resource, root shaders of different directories
+	// may share a module name
+	File *WgslFile `json:"-"`
 }
 
 type TypeInfo struct {
@@ -98,9 +232,26 @@ type TypeInfo struct {
 	FullTypePath  string       `json:"fullTypePath"`
 	TypeLink      string       `json:"typeLink"`
 	TypeLinkBlank bool         `json:"typeLinkBlank"`
+	// set only for composite types such as `array<PointLight, 4>`
+	Components []TypeComponent `json:"components,omitempty"`
+	// description from the `@returns` tag of the function comment
+	Doc string `json:"doc,omitempty"`
+}
+
+// a piece of a type string, identifiers carry a link once resolved
+type TypeComponent struct {
+	Text      string `json:"text"`
+	Link      string `json:"link"`
+	LinkBlank bool   `json:"linkBlank"`
+	// highlight class, `hl-type` or `hl-number`
+	Class string `json:"class,omitempty"`
 }
 
+// Annotation is a WGSL attribute. Value is the source between the
+// parentheses and Args its comma separated arguments, both are empty for
+// attributes without arguments such as `@must_use`.
 type Annotation struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name  string   `json:"name"`
+	Value string   `json:"value"`
+	Args  []string `json:"args,omitempty"`
 }
@@ -0,0 +1,696 @@
+package wgsl
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	lo "github.com/samber/lo"
+)
+
+// builtins that must be called in uniform control flow
+var uniformBuiltins = []string{
+	"textureSample", "textureSampleBias", "textureSampleCompare",
+	"dpdx", "dpdxCoarse", "dpdxFine", "dpdy", "dpdyCoarse", "dpdyFine", "fwidth", "fwidthCoarse", "fwidthFine",
+	"workgroupBarrier", "storageBarrier", "textureBarrier", "workgroupUniformLoad",
+}
+
+// compute builtins with the same value across a workgroup
+var uniformComputeBuiltins = []string{"workgroup_id", "num_workgroups"}
+
+var assignmentOperators = []string{"=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<=", ">>="}
+
+// maximum number of passes over a body before giving up on a fixed point
+const uniformityPasses = 5
+
+// maximum number of shader def combinations walked for one body
+const uniformityVariants = 64
+
+// taint is the set of sources a value or the control flow depends on. Labels
+// `param:N` stand for the Nth parameter of the function being analyzed, the
+// others describe a non-uniform value.
+type taint map[string]bool
+
+func (t taint) with(others ...taint) taint {
+	result := maps.Clone(t)
+	if result == nil {
+		result = taint{}
+	}
+	for _, other := range others {
+		maps.Copy(result, other)
+	}
+	return result
+}
+
+// non-uniform sources of t, sorted
+func (t taint) sources() []string {
+	var sources []string
+	for label := range t {
+		if !strings.HasPrefix(label, "param:") {
+			sources = append(sources, label)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func (t taint) params() []int {
+	var params []int
+	for label := range t {
+		if n, ok := strings.CutPrefix(label, "param:"); ok {
+			index, _ := strconv.Atoi(n)
+			params = append(params, index)
+		}
+	}
+	sort.Ints(params)
+	return params
+}
+
+// uniformitySummary describes what callers of a function must guarantee and
+// what its return value depends on.
+type uniformitySummary struct {
+	// builtin or call that makes the function require uniform control flow
+	requirement string
+	// parameters that must be uniform, with the call requiring it
+	uniformParams map[int]string
+	returnTaint   taint
+}
+
+// AnalyzeUniformity flags calls to builtins requiring uniform control flow,
+// such as texture sampling and derivatives, that may run in non-uniform
+// control flow. Requirements follow calls across modules: a function that
+// samples a texture must itself be called in uniform control flow, and a
+// branch on a parameter makes that parameter required to be uniform. GLSL
+// files are not analyzed.
+func (registry *ModuleRegistry) AnalyzeUniformity() {
+	summaries := make(map[itemKey]*uniformitySummary)
+
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			registry.uniformitySummary(file, file.Functions[i].Name, summaries)
+		}
+	}
+
+	for _, file := range registry.Files {
+		for i := range file.Functions {
+			fn := &file.Functions[i]
+			fn.HasDiagnostics = len(fn.Diagnostics) != 0
+			for _, diagnostic := range fn.Diagnostics {
+				registry.Diagnostics.Add(diagnostic)
+			}
+		}
+	}
+}
+
+func (registry *ModuleRegistry) uniformitySummary(file *WgslFile, name string, summaries map[itemKey]*uniformitySummary) *uniformitySummary {
+	key := itemKey{file, name}
+	if summary, ok := summaries[key]; ok {
+		return summary
+	}
+
+	// recursive calls see an empty summary
+	summary := &uniformitySummary{uniformParams: make(map[int]string), returnTaint: taint{}}
+	summaries[key] = summary
+	if file.IsGLSL {
+		return summary
+	}
+
+	for i := range file.Functions {
+		fn := &file.Functions[i]
+		if fn.Name != name {
+			continue
+		}
+
+		// the summary is the union over the variants of the body
+		var findings []Diagnostic
+		for _, lexemes := range bodyVariants(fn) {
+			walker := &uniformityWalker{
+				registry:  registry,
+				summaries: summaries,
+				file:      file,
+				fn:        fn,
+				summary:   summary,
+				lexemes:   lexemes,
+			}
+			findings = append(findings, walker.analyze()...)
+		}
+		fn.Diagnostics = append(fn.Diagnostics, uniqueDiagnostics(findings)...)
+	}
+
+	return summary
+}
+
+// bodyVariants returns the significant lexemes of the body of fn for every
+// combination of its shader def branches, so that an exit in an `#ifdef` arm
+// does not taint the `#else` one. Inactive lines are blanked to keep the
+// positions of the body. Only the first uniformityVariants combinations are
+// walked, and a body whose directives do not balance is walked as one.
+func bodyVariants(fn *Function) [][]Lexeme {
+	lines := strings.Split(fn.Body, "\n")
+
+	tests := make(map[string][]string)
+	for _, line := range lines {
+		directive, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch directive {
+		case "#else":
+			// `#else ifdef A`
+			_, args, _ = strings.Cut(strings.TrimSpace(args), " ")
+			fallthrough
+		case "#ifdef", "#ifndef", "#if":
+			for name, values := range shaderDefTests(args) {
+				tests[name] = append(tests[name], values...)
+			}
+		}
+	}
+	if len(tests) == 0 {
+		return [][]Lexeme{withoutDirectives(SignificantLexemes(Lex(fn.Body)))}
+	}
+
+	names := slices.Sorted(maps.Keys(tests))
+	choices := make([][]string, len(names))
+	for i, name := range names {
+		choices[i] = shaderDefChoices(tests[name])
+	}
+
+	var variants [][]Lexeme
+	seen := make(map[string]bool)
+	counters := make([]int, len(names))
+	for range uniformityVariants {
+		defs := make(map[string]string)
+		for i, name := range names {
+			if value := choices[i][counters[i]]; value != "" {
+				defs[name] = value
+			}
+		}
+
+		active, err := preprocessShaderDefs(fn.Body, defs)
+		if err != nil {
+			return [][]Lexeme{withoutDirectives(SignificantLexemes(Lex(fn.Body)))}
+		}
+		variant := make([]string, len(lines))
+		for i, line := range lines {
+			variant[i] = strings.Repeat(" ", len(line))
+		}
+		for _, line := range active {
+			variant[line.line-1] = lines[line.line-1]
+		}
+
+		body := strings.Join(variant, "\n")
+		if !seen[body] {
+			seen[body] = true
+			variants = append(variants, SignificantLexemes(Lex(body)))
+		}
+
+		// next combination, the first def varying fastest
+		i := 0
+		for ; i < len(counters); i++ {
+			counters[i]++
+			if counters[i] < len(choices[i]) {
+				break
+			}
+			counters[i] = 0
+		}
+		if i == len(counters) {
+			break
+		}
+	}
+
+	return variants
+}
+
+// values worth giving a def compared against values: undefined, each value
+// and the integers around numeric ones, or defined for a plain flag
+func shaderDefChoices(values []string) []string {
+	choices := []string{""}
+	if len(values) == 0 {
+		return append(choices, "true")
+	}
+	for _, value := range values {
+		candidates := []string{value}
+		if n, err := strconv.Atoi(value); err == nil {
+			candidates = []string{strconv.Itoa(n - 1), value, strconv.Itoa(n + 1)}
+		}
+		for _, candidate := range candidates {
+			if !slices.Contains(choices, candidate) {
+				choices = append(choices, candidate)
+			}
+		}
+	}
+	return choices
+}
+
+// merges the findings of the variants of a body, sorted by position
+func uniqueDiagnostics(diagnostics []Diagnostic) []Diagnostic {
+	type key struct {
+		span    Span
+		message string
+	}
+
+	var unique []Diagnostic
+	seen := make(map[key]bool)
+	for _, diagnostic := range diagnostics {
+		k := key{diagnostic.Span, diagnostic.Message}
+		if !seen[k] {
+			seen[k] = true
+			unique = append(unique, diagnostic)
+		}
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		if unique[i].Span.Line != unique[j].Span.Line {
+			return unique[i].Span.Line < unique[j].Span.Line
+		}
+		return unique[i].Span.Column < unique[j].Span.Column
+	})
+	return unique
+}
+
+type uniformityWalker struct {
+	registry  *ModuleRegistry
+	summaries map[itemKey]*uniformitySummary
+	file      *WgslFile
+	fn        *Function
+	summary   *uniformitySummary
+	lexemes   []Lexeme
+
+	params map[string]taint
+	locals map[string]taint
+	// control flow taint of the break and continue statements of each
+	// enclosing loop, nil for switch statements
+	loopExits []taint
+	// control flow taint of the returns of the innermost loop
+	loopReturns taint
+	changed     bool
+	findings    map[int]Diagnostic
+}
+
+// analyze walks the body until the taint of every local is stable, locals
+// are tainted by every assignment so loops are handled by walking again, and
+// returns the findings by position
+func (walker *uniformityWalker) analyze() []Diagnostic {
+	walker.params = make(map[string]taint)
+	for i, param := range walker.fn.Params {
+		walker.params[param.Name] = walker.paramTaint(i, param)
+	}
+	walker.locals = make(map[string]taint)
+
+	for range uniformityPasses {
+		walker.changed = false
+		walker.findings = make(map[int]Diagnostic)
+		walker.walkBlock(0, taint{})
+		if !walker.changed {
+			break
+		}
+	}
+
+	var findings []Diagnostic
+	for _, i := range slices.Sorted(maps.Keys(walker.findings)) {
+		findings = append(findings, walker.findings[i])
+	}
+	return findings
+}
+
+// parameters of entry points are invocation inputs, non-uniform unless they
+// are the same across a workgroup
+func (walker *uniformityWalker) paramTaint(i int, param NamedType) taint {
+	stage := walker.fn.StageAttribute
+	if stage == "" {
+		return taint{"param:" + strconv.Itoa(i): true}
+	}
+
+	for _, annotation := range param.Annotations {
+		if annotation.Name == "builtin" && stage == "compute" && slices.Contains(uniformComputeBuiltins, annotation.Value) {
+			return taint{}
+		}
+	}
+
+	return taint{fmt.Sprintf("`%s` (%s input)", param.Name, stage): true}
+}
+
+func (walker *uniformityWalker) text(i int) string {
+	if i < len(walker.lexemes) {
+		return walker.lexemes[i].Text
+	}
+	return ""
+}
+
+// index of the first lexeme from i that is one of texts at nesting depth 0
+func (walker *uniformityWalker) find(i int, texts ...string) int {
+	depth := 0
+	for ; i < len(walker.lexemes); i++ {
+		text := walker.lexemes[i].Text
+		if depth == 0 && slices.Contains(texts, text) {
+			return i
+		}
+		switch text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth < 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// walkBlock walks the statements of the block opening at i and returns the
+// index past it, with the control flow taint of its early exits
+func (walker *uniformityWalker) walkBlock(i int, cf taint) (int, taint) {
+	if walker.text(i) != "{" {
+		return walker.walkStatement(i, cf)
+	}
+
+	exits := taint{}
+	i++
+	for i < len(walker.lexemes) && walker.text(i) != "}" {
+		var statementExits taint
+		// code following an exit taken in non-uniform control flow is itself
+		// non-uniform
+		i, statementExits = walker.walkStatement(i, cf.with(exits))
+		exits = exits.with(statementExits)
+	}
+
+	return i + 1, exits
+}
+
+func (walker *uniformityWalker) walkStatement(i int, cf taint) (int, taint) {
+	switch walker.text(i) {
+	case "{":
+		return walker.walkBlock(i, cf)
+
+	case ";":
+		return i + 1, taint{}
+
+	case "if":
+		open := walker.find(i+1, "{")
+		condition := cf.with(walker.expression(i+1, open, cf))
+		next, exits := walker.walkBlock(open, condition)
+		if walker.text(next) == "else" {
+			var elseExits taint
+			next, elseExits = walker.walkStatement(next+1, condition)
+			exits = exits.with(elseExits)
+		}
+		return next, exits
+
+	case "switch":
+		open := walker.find(i+1, "{")
+		selector := cf.with(walker.expression(i+1, open, cf))
+		walker.loopExits = append(walker.loopExits, nil)
+		defer func() { walker.loopExits = walker.loopExits[:len(walker.loopExits)-1] }()
+
+		exits := taint{}
+		j := open + 1
+		for j < len(walker.lexemes) && walker.text(j) != "}" {
+			if walker.text(j) != "{" {
+				j++
+				continue
+			}
+			next, caseExits := walker.walkBlock(j, selector)
+			exits, j = exits.with(caseExits), next
+		}
+		return j + 1, exits
+
+	case "for":
+		header := skipBalanced(walker.lexemes, i+1, "(", ")")
+		initEnd := walker.find(i+2, ";")
+		conditionEnd := walker.find(initEnd+1, ";")
+		walker.walkSimpleStatement(i+2, initEnd, cf)
+		return walker.walkLoop(header, cf, func(loopCf taint) taint {
+			return walker.expression(initEnd+1, conditionEnd, loopCf)
+		}, func(loopCf taint) {
+			walker.walkSimpleStatement(conditionEnd+1, header-1, loopCf)
+		})
+
+	case "while":
+		open := walker.find(i+1, "{")
+		return walker.walkLoop(open, cf, func(loopCf taint) taint {
+			return walker.expression(i+1, open, loopCf)
+		}, nil)
+
+	case "loop":
+		return walker.walkLoop(i+1, cf, nil, nil)
+
+	case "continuing":
+		return walker.walkBlock(i+1, cf)
+
+	case "break":
+		if walker.text(i+1) == "if" {
+			end := walker.find(i+2, ";")
+			walker.exitLoop(cf.with(walker.expression(i+2, end, cf)), false)
+			return end + 1, taint{}
+		}
+		// a break out of a switch ends the case, not the iteration
+		if !walker.exitLoop(cf, false) {
+			return walker.find(i, ";") + 1, taint{}
+		}
+		return walker.find(i, ";") + 1, cf
+
+	case "continue":
+		walker.exitLoop(cf, true)
+		return walker.find(i, ";") + 1, cf
+
+	case "return":
+		end := walker.find(i+1, ";")
+		walker.summary.returnTaint = walker.summary.returnTaint.with(cf, walker.expression(i+1, end, cf))
+		walker.loopReturns = walker.loopReturns.with(cf)
+		return end + 1, cf
+
+	case "discard":
+		// demotes the invocation to a helper, derivatives stay defined
+		return walker.find(i, ";") + 1, taint{}
+	}
+
+	end := walker.find(i, ";")
+	walker.walkSimpleStatement(i, end, cf)
+	return end + 1, taint{}
+}
+
+// walkLoop walks the loop body opening at open until the control flow taint
+// of its exits is stable. Every iteration depends on the condition and on the
+// breaks and continues of previous iterations; invocations reconverge after
+// the loop unless some of them returned from it.
+func (walker *uniformityWalker) walkLoop(open int, cf taint, condition func(taint) taint, update func(taint)) (int, taint) {
+	walker.loopExits = append(walker.loopExits, taint{})
+	outerReturns := walker.loopReturns
+	walker.loopReturns = taint{}
+	defer func() {
+		walker.loopExits = walker.loopExits[:len(walker.loopExits)-1]
+		walker.loopReturns = outerReturns.with(walker.loopReturns)
+	}()
+
+	var next int
+	loopCf := cf
+	for range uniformityPasses {
+		if condition != nil {
+			loopCf = loopCf.with(condition(loopCf))
+		}
+		var exits taint
+		next, exits = walker.walkBlock(open, loopCf)
+		if update != nil {
+			update(loopCf.with(exits))
+		}
+
+		extended := loopCf.with(exits, walker.loopExits[len(walker.loopExits)-1])
+		if len(extended) == len(loopCf) {
+			break
+		}
+		loopCf = extended
+	}
+
+	return next, walker.loopReturns.with()
+}
+
+// exitLoop records a break or continue in the innermost loop, a continue
+// skips enclosing switch statements. Returns false for a break out of a
+// switch.
+func (walker *uniformityWalker) exitLoop(cf taint, skipSwitch bool) bool {
+	for top := len(walker.loopExits) - 1; top >= 0; top-- {
+		if walker.loopExits[top] != nil {
+			walker.loopExits[top] = walker.loopExits[top].with(cf)
+			return true
+		}
+		if !skipSwitch {
+			return false
+		}
+	}
+	return false
+}
+
+// walkSimpleStatement handles declarations, assignments, increments and
+// calls between start and end
+func (walker *uniformityWalker) walkSimpleStatement(start, end int, cf taint) {
+	if start >= end {
+		return
+	}
+
+	if slices.Contains(declarationKeywords, walker.text(start)) {
+		name := declaredLocal(walker.lexemes, start)
+		value := cf
+		if assign := walker.find(start, "="); assign < end {
+			value = cf.with(walker.expression(assign+1, end, cf))
+		}
+		walker.taintLocal(name, value)
+		return
+	}
+
+	switch assign := walker.find(start, assignmentOperators...); {
+	case assign < end:
+		value := cf.with(walker.expression(assign+1, end, cf))
+		// indices on the left are evaluated too
+		walker.expression(start, assign, cf)
+		walker.taintLocal(walker.text(start), value)
+	case walker.text(end-1) == "++" || walker.text(end-1) == "--":
+		walker.taintLocal(walker.text(start), cf)
+	default:
+		walker.expression(start, end, cf)
+	}
+}
+
+// taints a local with value on top of what it already depends on
+func (walker *uniformityWalker) taintLocal(name string, value taint) {
+	if name == "" {
+		return
+	}
+	if _, ok := walker.params[name]; ok {
+		walker.params[name] = walker.params[name].with(value)
+		return
+	}
+
+	current := walker.locals[name]
+	extended := current.with(value)
+	if len(extended) != len(current) || current == nil {
+		walker.changed = true
+	}
+	walker.locals[name] = extended
+}
+
+// expression returns what the value of the lexemes start..end depends on and
+// checks the calls it makes
+func (walker *uniformityWalker) expression(start, end int, cf taint) taint {
+	result := taint{}
+
+	for i := start; i < end && i < len(walker.lexemes); i++ {
+		lexeme := walker.lexemes[i]
+		if lexeme.Kind != LexIdent || (i > 0 && walker.text(i-1) == ".") {
+			continue
+		}
+
+		if walker.text(i+1) == "(" {
+			closing := skipBalanced(walker.lexemes, i+1, "(", ")")
+			result = result.with(walker.call(i, closing, cf))
+			i = closing - 1
+			continue
+		}
+
+		if value, ok := walker.locals[lexeme.Text]; ok {
+			result = result.with(value)
+		} else if value, ok := walker.params[lexeme.Text]; ok {
+			result = result.with(value)
+		} else if source := walker.moduleSource(lexeme.Text); source != "" {
+			result[source] = true
+		}
+	}
+
+	return result
+}
+
+// call checks the call whose name is at i and whose arguments end before
+// closing, and returns what its result depends on
+func (walker *uniformityWalker) call(i, closing int, cf taint) taint {
+	name := walker.text(i)
+
+	var args []taint
+	for j := i + 2; j < closing; {
+		end := min(walker.find(j, ","), closing-1)
+		args = append(args, walker.expression(j, end, cf))
+		j = end + 1
+	}
+
+	if slices.Contains(uniformBuiltins, name) {
+		walker.require(i, closing-1, cf, fmt.Sprintf("`%s` requires uniform control flow", name), "control flow")
+		walker.summary.requirement = lo.CoalesceOrEmpty(walker.summary.requirement, name)
+		if name == "workgroupUniformLoad" {
+			return taint{}
+		}
+		return taint{}.with(args...)
+	}
+
+	target, item, ok := walker.registry.ResolveItem(walker.file, name)
+	if !ok || !target.declaresFunction(item) {
+		// builtin functions and value constructors
+		return taint{}.with(args...)
+	}
+
+	callee := walker.registry.uniformitySummary(target, item, walker.summaries)
+
+	if callee.requirement != "" {
+		walker.require(i, closing-1, cf, fmt.Sprintf("`%s` requires uniform control flow, it calls `%s`", name, callee.requirement), "control flow")
+		walker.summary.requirement = lo.CoalesceOrEmpty(walker.summary.requirement, name)
+	}
+
+	for index, requirement := range callee.uniformParams {
+		if index < len(args) {
+			message := fmt.Sprintf("argument %d of `%s` must be uniform, %s depends on it", index+1, name, requirement)
+			walker.require(i, closing-1, args[index], message, "the argument")
+		}
+	}
+
+	result := taint{}
+	for label := range callee.returnTaint {
+		if n, ok := strings.CutPrefix(label, "param:"); ok {
+			if index, _ := strconv.Atoi(n); index < len(args) {
+				result = result.with(args[index])
+			}
+			continue
+		}
+		result[label] = true
+	}
+
+	return result
+}
+
+// require records a finding for the call at start..end when value has
+// non-uniform sources, and makes the parameters value depends on required to
+// be uniform
+func (walker *uniformityWalker) require(start, end int, value taint, message, subject string) {
+	for _, index := range value.params() {
+		if _, ok := walker.summary.uniformParams[index]; !ok {
+			walker.summary.uniformParams[index] = fmt.Sprintf("`%s`", walker.text(start))
+		}
+	}
+
+	sources := value.sources()
+	if len(sources) == 0 {
+		return
+	}
+
+	walker.findings[start] = newDiagnostic(walker.file, walker.fn, walker.lexemes, start, end, "uniformity",
+		fmt.Sprintf("%s, but %s depends on %s", message, subject, strings.Join(sources, ", ")))
+}
+
+// describes a module-scope variable whose value may differ between
+// invocations, or returns an empty string
+func (walker *uniformityWalker) moduleSource(name string) string {
+	target, item, ok := walker.registry.ResolveItem(walker.file, name)
+	if !ok {
+		return ""
+	}
+
+	for _, binding := range target.Bindings {
+		if binding.Name == item && bindingAddressSpace(binding) == "storage" && strings.Contains(binding.BindingType, "read_write") {
+			return fmt.Sprintf("`%s` (read_write storage)", name)
+		}
+	}
+	for _, moduleVar := range target.ModuleVars {
+		if moduleVar.Name == item && (moduleVar.AddressSpace == "workgroup" || moduleVar.AddressSpace == "private") {
+			return fmt.Sprintf("`%s` (%s)", name, moduleVar.AddressSpace)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,163 @@
+package wgsl
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	utils "main/utils"
+)
+
+// TypeUsage is a declaration whose type refers to a structure.
+type TypeUsage struct {
+	// field, param, return, binding, var or const
+	Kind   string `json:"kind"`
+	Item   string `json:"item"`
+	Module string `json:"module"`
+	Link   string `json:"link"`
+	Type   string `json:"type"`
+}
+
+type StructureRef struct {
+	Name   string `json:"name"`
+	Module string `json:"module"`
+	Link   string `json:"link"`
+}
+
+// StructureUsage is one node of the exported type usage index. Contains lists
+// the structures its fields are made of, the edges of the composition graph.
+type StructureUsage struct {
+	StructureRef
+	Contains []StructureRef `json:"contains,omitempty"`
+	UsedIn   []TypeUsage    `json:"usedIn,omitempty"`
+}
+
+type structureEntry struct {
+	file      *WgslFile
+	structure *Structure
+}
+
+// IndexTypeUsage finds, for every structure, the fields, parameters, return
+// types, bindings, variables and constants referring to it through the links
+// set by ResolveTypeLinks, which must have run on every file first.
+func (registry *ModuleRegistry) IndexTypeUsage() []StructureUsage {
+	structures := make(map[string]structureEntry)
+	var order []string
+
+	for _, file := range registry.Files {
+		for i := range file.Structures {
+			link := file.ItemLink(file.Structures[i].Name)
+			if _, ok := structures[link]; ok {
+				// declared again in another shader def branch
+				continue
+			}
+			structures[link] = structureEntry{file, &file.Structures[i]}
+			order = append(order, link)
+		}
+	}
+
+	record := func(file *WgslFile, typeInfo TypeInfo, usage TypeUsage) {
+		usage.Module = file.ModuleName()
+		usage.Type = typeInfo.Type
+
+		for _, link := range structureLinks(file, typeInfo) {
+			// items declared in several shader def branches are listed once
+			if target, ok := structures[link]; ok && !slices.Contains(target.structure.UsedIn, usage) {
+				target.structure.UsedIn = append(target.structure.UsedIn, usage)
+			}
+		}
+	}
+
+	for _, file := range registry.Files {
+		for i := range file.Structures {
+			structure := &file.Structures[i]
+
+			for _, field := range structure.Fields {
+				record(file, field.TypeInfo, TypeUsage{
+					Kind: "field",
+					Item: structure.Name + "." + field.Name,
+					Link: file.ItemLink(structure.Name),
+				})
+
+				for _, link := range structureLinks(file, field.TypeInfo) {
+					target, ok := structures[link]
+					if !ok || slices.ContainsFunc(structure.Contains, func(v StructureRef) bool { return v.Link == link }) {
+						continue
+					}
+					structure.Contains = append(structure.Contains, StructureRef{
+						Name:   target.structure.Name,
+						Module: target.file.ModuleName(),
+						Link:   link,
+					})
+				}
+			}
+		}
+
+		for _, fn := range file.Functions {
+			for _, param := range fn.Params {
+				record(file, param.TypeInfo, TypeUsage{
+					Kind: "param",
+					Item: fn.Name + "(" + param.Name + ")",
+					Link: file.ItemLink(fn.Name),
+				})
+			}
+
+			record(file, fn.ReturnTypeInfo, TypeUsage{
+				Kind: "return",
+				Item: fn.Name,
+				Link: file.ItemLink(fn.Name),
+			})
+		}
+
+		for _, binding := range file.Bindings {
+			record(file, binding.TypeInfo, TypeUsage{Kind: "binding", Item: binding.Name, Link: file.ItemLink(cmp.Or(binding.Anchor, binding.Name))})
+		}
+
+		for _, moduleVar := range file.ModuleVars {
+			record(file, moduleVar.TypeInfo, TypeUsage{Kind: "var", Item: moduleVar.Name, Link: file.ItemLink(moduleVar.Name)})
+		}
+
+		for _, constant := range file.Consts {
+			record(file, constant.TypeInfo, TypeUsage{Kind: "const", Item: constant.Name, Link: file.ItemLink(constant.Name)})
+		}
+	}
+
+	index := make([]StructureUsage, 0, len(order))
+	for _, link := range order {
+		entry := structures[link]
+		entry.structure.HasUsages = len(entry.structure.UsedIn) != 0
+
+		index = append(index, StructureUsage{
+			StructureRef: StructureRef{
+				Name:   entry.structure.Name,
+				Module: entry.file.ModuleName(),
+				Link:   link,
+			},
+			Contains: entry.structure.Contains,
+			UsedIn:   entry.structure.UsedIn,
+		})
+	}
+
+	return index
+}
+
+// absolute links of the structures a resolved type refers to, local
+// `#Name` links are made absolute with the link of file
+func structureLinks(file *WgslFile, typeInfo TypeInfo) []string {
+	links := []string{typeInfo.TypeLink}
+	for _, component := range typeInfo.Components {
+		links = append(links, component.Link)
+	}
+
+	var result []string
+	for _, link := range links {
+		if strings.HasPrefix(link, "#") {
+			link = utils.NormalizeLink(file.Link) + link
+		}
+		if link != "" && !slices.Contains(result, link) {
+			result = append(result, link)
+		}
+	}
+
+	return result
+}
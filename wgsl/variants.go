@@ -0,0 +1,315 @@
+package wgsl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var anchorUnsafePattern = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// ItemVariant is one definition of an item defined once per shader def
+// branch, such as a function written under both `#ifdef X` and `#else`.
+type ItemVariant struct {
+	Anchor     string `json:"anchor"`
+	Condition  string `json:"condition"`
+	LineNumber int    `json:"lineNumber"`
+}
+
+// VariantDiff compares the source of a variant with the first definition of
+// the item, row by row.
+type VariantDiff struct {
+	From ItemVariant `json:"from"`
+	To   ItemVariant `json:"to"`
+	Rows []DiffRow   `json:"rows"`
+}
+
+// DiffRow is one row of a side by side diff. Kind is "same", "changed",
+// "removed" or "added", Left is nil for added lines and Right for removed
+// ones.
+type DiffRow struct {
+	Kind  string      `json:"kind"`
+	Left  *SourceLine `json:"left,omitempty"`
+	Right *SourceLine `json:"right,omitempty"`
+}
+
+// a definition of a grouped item, with its highlighted source
+type variantSource struct {
+	variant ItemVariant
+	lines   []SourceLine
+	text    []string
+}
+
+// groupVariants moves the definitions of an item defined several times next
+// to its first one, gives each a variant anchor naming its shader def
+// condition and diffs them with the first definition.
+func (items *sourceItems) groupVariants(code string) {
+	codeLines := strings.Split(code, "\n")
+
+	items.functions = reorderVariants(items.functions, func(v Function) string { return v.Name })
+	for _, group := range variantGroups(items.functions, func(v Function) string { return v.Name }) {
+		sources := make([]variantSource, len(group))
+		for k, i := range group {
+			fn := &items.functions[i]
+			sources[k] = newVariantSource(fn.Name, fn.ShaderDefs, fn.LineNumber, fn.BodyEndLine, codeLines)
+		}
+
+		variants, diffs := compareVariants(sources)
+		for k, i := range group {
+			fn := &items.functions[i]
+			fn.Anchor = variants[k].Anchor
+			fn.IsVariant = true
+			fn.VariantCondition = variants[k].Condition
+		}
+		first := &items.functions[group[0]]
+		first.Variants = variants
+		first.VariantDiffs = diffs
+	}
+
+	items.structures = reorderVariants(items.structures, func(v Structure) string { return v.Name })
+	for _, group := range variantGroups(items.structures, func(v Structure) string { return v.Name }) {
+		sources := make([]variantSource, len(group))
+		for k, i := range group {
+			structure := &items.structures[i]
+			endLine := closingLine(code, codeLines, structure.LineNumber)
+			sources[k] = newVariantSource(structure.Name, structure.ShaderDefs, structure.LineNumber, endLine, codeLines)
+		}
+
+		variants, diffs := compareVariants(sources)
+		for k, i := range group {
+			structure := &items.structures[i]
+			structure.Anchor = variants[k].Anchor
+			structure.IsVariant = true
+			structure.VariantCondition = variants[k].Condition
+		}
+		first := &items.structures[group[0]]
+		first.Variants = variants
+		first.VariantDiffs = diffs
+	}
+
+	for i := range items.functions {
+		if items.functions[i].Anchor == "" {
+			items.functions[i].Anchor = items.functions[i].Name
+		}
+	}
+	for i := range items.structures {
+		if items.structures[i].Anchor == "" {
+			items.structures[i].Anchor = items.structures[i].Name
+		}
+	}
+	for i := range items.bindings {
+		if items.bindings[i].Anchor == "" {
+			items.bindings[i].Anchor = items.bindings[i].Name
+		}
+	}
+}
+
+// reorderVariants returns items with every later definition of a name moved
+// right after the first one, keeping the order otherwise
+func reorderVariants[T any](items []T, name func(T) string) []T {
+	byName := make(map[string][]T)
+	for _, item := range items {
+		byName[name(item)] = append(byName[name(item)], item)
+	}
+
+	reordered := make([]T, 0, len(items))
+	for _, item := range items {
+		if definitions, ok := byName[name(item)]; ok {
+			reordered = append(reordered, definitions...)
+			delete(byName, name(item))
+		}
+	}
+	return reordered
+}
+
+// variantGroups returns the indices of the items sharing a name with another
+// one, items must be reordered first
+func variantGroups[T any](items []T, name func(T) string) [][]int {
+	var groups [][]int
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && name(items[end]) == name(items[start]) {
+			end++
+		}
+		if end-start > 1 {
+			group := make([]int, 0, end-start)
+			for i := start; i < end; i++ {
+				group = append(group, i)
+			}
+			groups = append(groups, group)
+		}
+		start = end
+	}
+	return groups
+}
+
+func newVariantSource(name string, shaderDefs []DefResult, startLine, endLine int, codeLines []string) variantSource {
+	startLine = max(startLine, 1)
+	endLine = min(max(endLine, startLine), len(codeLines))
+	text := codeLines[startLine-1 : endLine]
+
+	return variantSource{
+		variant: ItemVariant{
+			Anchor:     variantAnchor(name, shaderDefs),
+			Condition:  variantCondition(shaderDefs),
+			LineNumber: startLine,
+		},
+		lines: highlightLines(strings.Join(text, "\n"), startLine, nil, specIdentLink),
+		text:  text,
+	}
+}
+
+// variantAnchor names a variant after the branches enclosing it, for example
+// `Light--MESHLET` or `Light--not-MESHLET`. GLSL overloads outside of any
+// branch are named `name--always`.
+func variantAnchor(name string, shaderDefs []DefResult) string {
+	if len(shaderDefs) == 0 {
+		return name + "--always"
+	}
+
+	parts := []string{name}
+	for _, def := range shaderDefs {
+		condition := branchCondition(def)
+		negated := strings.HasPrefix(condition, "!")
+		condition = strings.Trim(anchorUnsafePattern.ReplaceAllString(strings.TrimPrefix(condition, "!"), "-"), "-")
+		if negated {
+			condition = "not-" + condition
+		}
+		parts = append(parts, condition)
+	}
+	return strings.Join(parts, "--")
+}
+
+// variantCondition describes the branches enclosing a variant, such as
+// `MESHLET, !SKINNED`
+func variantCondition(shaderDefs []DefResult) string {
+	if len(shaderDefs) == 0 {
+		return "always"
+	}
+
+	conditions := make([]string, 0, len(shaderDefs))
+	for _, def := range shaderDefs {
+		conditions = append(conditions, branchCondition(def))
+	}
+	return strings.Join(conditions, ", ")
+}
+
+// the condition under which the branch of def is compiled, an `#else` branch
+// negates it
+func branchCondition(def DefResult) string {
+	if def.Branch != "else" {
+		return def.DefName
+	}
+	if negated, ok := strings.CutPrefix(def.DefName, "!"); ok {
+		return negated
+	}
+	if strings.ContainsAny(def.DefName, " =<>&|") {
+		return "!(" + def.DefName + ")"
+	}
+	return "!" + def.DefName
+}
+
+// compareVariants returns the variants of the sources, with anchors made
+// unique, and the diff of every variant with the first one
+func compareVariants(sources []variantSource) ([]ItemVariant, []VariantDiff) {
+	variants := make([]ItemVariant, len(sources))
+	seen := make(map[string]int)
+	for k, source := range sources {
+		variants[k] = source.variant
+		seen[variants[k].Anchor]++
+		if n := seen[variants[k].Anchor]; n > 1 {
+			variants[k].Anchor = fmt.Sprintf("%s-%d", variants[k].Anchor, n)
+		}
+	}
+
+	diffs := make([]VariantDiff, 0, len(sources)-1)
+	for k := 1; k < len(sources); k++ {
+		diffs = append(diffs, VariantDiff{
+			From: variants[0],
+			To:   variants[k],
+			Rows: diffSourceLines(sources[0], sources[k]),
+		})
+	}
+	return variants, diffs
+}
+
+// diffSourceLines aligns the lines of two sources on their longest common
+// subsequence, ignoring indentation. Runs of removed lines followed by added
+// ones are paired into changed rows.
+func diffSourceLines(left, right variantSource) []DiffRow {
+	n, m := len(left.text), len(right.text)
+	same := func(i, j int) bool {
+		return strings.TrimSpace(left.text[i]) == strings.TrimSpace(right.text[j])
+	}
+
+	// common[i][j] is the length of the common subsequence of left[i:] and right[j:]
+	common := make([][]int, n+1)
+	for i := range common {
+		common[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if same(i, j) {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var rows []DiffRow
+	var removed, added []*SourceLine
+
+	flush := func() {
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			row := DiffRow{Kind: "changed"}
+			if k < len(removed) {
+				row.Left = removed[k]
+			} else {
+				row.Kind = "added"
+			}
+			if k < len(added) {
+				row.Right = added[k]
+			} else {
+				row.Kind = "removed"
+			}
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && same(i, j):
+			flush()
+			rows = append(rows, DiffRow{Kind: "same", Left: &left.lines[i], Right: &right.lines[j]})
+			i++
+			j++
+		case j == m || (i < n && common[i+1][j] >= common[i][j+1]):
+			removed = append(removed, &left.lines[i])
+			i++
+		default:
+			added = append(added, &right.lines[j])
+			j++
+		}
+	}
+	flush()
+
+	return rows
+}
+
+// returns the line of the brace closing the first one opened on or after line
+func closingLine(code string, codeLines []string, line int) int {
+	offset := 0
+	for _, codeLine := range codeLines[:line-1] {
+		offset += len(codeLine) + 1
+	}
+
+	open := strings.IndexByte(code[offset:], '{')
+	if open == -1 {
+		return line
+	}
+	end := findMatchingBrace(code, offset+open)
+	return getLineNumber(code, end-1)
+}
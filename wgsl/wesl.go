@@ -0,0 +1,314 @@
+package wgsl
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	config "main/config"
+)
+
+const LanguageWESL = "wesl"
+
+var weslTomlRootPattern = regexp.MustCompile(`(?m)^\s*root\s*=\s*"([^"]*)"`)
+var weslNegationPattern = regexp.MustCompile(`^!\s*(\w+)$`)
+
+func IsWESLFile(filePath string) bool {
+	return filepath.Ext(filePath) == ".wesl"
+}
+
+// ParseWESLFile documents a WESL module with the WGSL extractors. `import`
+// statements become declared imports, `@if`/`@elif`/`@else` attributes become
+// shader def blocks and the module path is derived from the file path.
+func ParseWESLFile(config *config.Config, weslFilePath string) WgslFile {
+	modulePath, packageName := weslModulePath(config.SourcePath, weslFilePath)
+
+	conditions, normalizedCode := extractConditionalAttributes(readSourceFile(weslFilePath))
+
+	declaredImports, err := extractWeslImports(normalizedCode, modulePath, packageName)
+	if err != nil {
+		log.Fatal(fmt.Errorf("%s: %w", weslFilePath, err))
+	}
+
+	lineComments := extractComments(strings.Split(normalizedCode, "\n"))
+	shaderDefs := append(extractShaderDefsBlocks(normalizedCode), conditions...)
+	slices.SortStableFunc(shaderDefs, func(a, b ShaderDefBlock) int {
+		return a.IfdefLine - b.IfdefLine
+	})
+
+	wgslFile := newWgslFile(config, weslFilePath, normalizedCode, LanguageWESL, extractWgslItems(normalizedCode, lineComments, shaderDefs))
+	wgslFile.DeclaredImports = declaredImports
+	wgslFile.ImportLines = importLines(normalizedCode, declaredImports)
+	if wgslFile.ImportPath == nil {
+		wgslFile.ImportPath = &modulePath
+	}
+
+	return wgslFile
+}
+
+// weslModulePath maps a file to its module path. The package root is the
+// `root` of the closest wesl.toml, or the `src` directory of the enclosing
+// crate, in which case the package is named after the crate directory.
+func weslModulePath(sourcePath, filePath string) (string, string) {
+	root, packageName := sourcePath, ""
+
+	for dir := filepath.Dir(filePath); ; dir = filepath.Dir(dir) {
+		if toml, err := os.ReadFile(filepath.Join(dir, "wesl.toml")); err == nil {
+			root, packageName = dir, filepath.Base(dir)
+			if match := weslTomlRootPattern.FindSubmatch(toml); match != nil {
+				root = filepath.Join(dir, string(match[1]))
+			}
+			break
+		}
+
+		if filepath.Base(dir) == "src" {
+			root, packageName = dir, filepath.Base(filepath.Dir(dir))
+			break
+		}
+
+		if rel, err := filepath.Rel(sourcePath, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			break
+		}
+	}
+
+	rel, err := filepath.Rel(root, strings.TrimSuffix(filePath, filepath.Ext(filePath)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	packageName = strings.ReplaceAll(packageName, "-", "_")
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if packageName != "" {
+		parts = append([]string{packageName}, parts...)
+	}
+
+	return strings.Join(parts, "::"), packageName
+}
+
+// extractConditionalAttributes turns `@if(cond)`, `@elif(cond)` and `@else`
+// into shader def blocks spanning the declaration they are attached to and
+// blanks them out so the WGSL extractors don't see them. Conditions of the
+// form `!DEF` and `@else` map to the else branch of a def.
+func extractConditionalAttributes(code string) ([]ShaderDefBlock, string) {
+	var blocks []ShaderDefBlock
+	blanked := []byte(code)
+
+	lexemes := SignificantLexemes(Lex(code))
+	// conditions of the current @if/@elif chain
+	var chain []string
+
+	for i := 0; i+1 < len(lexemes); i++ {
+		if lexemes[i].Text != "@" || lexemes[i+1].Kind != LexIdent {
+			continue
+		}
+
+		attribute := lexemes[i+1].Text
+		if attribute != "if" && attribute != "elif" && attribute != "else" {
+			continue
+		}
+
+		start := lexemes[i].Pos
+		end := i + 2
+		condition := ""
+
+		if attribute != "else" {
+			if end >= len(lexemes) || lexemes[end].Text != "(" {
+				continue
+			}
+			closeIdx := skipBalanced(lexemes, end, "(", ")") - 1
+			if closeIdx >= len(lexemes) || lexemes[closeIdx].Text != ")" {
+				continue
+			}
+			condition = strings.TrimSpace(code[lexemes[end].Pos+1 : lexemes[closeIdx].Pos])
+			end = closeIdx + 1
+		}
+
+		for j := start; j < len(blanked) && (end >= len(lexemes) || j < lexemes[end].Pos); j++ {
+			if blanked[j] != '\n' {
+				blanked[j] = ' '
+			}
+		}
+
+		defName, negated := condition, false
+		switch attribute {
+		case "if", "elif":
+			if match := weslNegationPattern.FindStringSubmatch(condition); match != nil {
+				defName, negated = match[1], true
+			}
+			if attribute == "if" {
+				chain = nil
+			}
+			chain = append(chain, condition)
+		case "else":
+			// none of the conditions of the chain hold
+			defName, negated = strings.Join(chain, " || "), true
+			if len(chain) == 1 {
+				if match := weslNegationPattern.FindStringSubmatch(chain[0]); match != nil {
+					defName, negated = match[1], false
+				}
+			}
+		}
+
+		block := ShaderDefBlock{
+			DefName:   defName,
+			IfdefLine: lexemes[i].Line - 1,
+			EndifLine: declarationEndLine(lexemes, end) + 1,
+		}
+		if negated {
+			elseLine := block.IfdefLine
+			block.ElseLine = &elseLine
+		}
+		blocks = append(blocks, block)
+
+		i = end - 1
+	}
+
+	return blocks, string(blanked)
+}
+
+// returns the line on which the declaration or statement starting at lexeme
+// i ends: a `;` or `,` at depth zero, the brace closing its body, or the end
+// of the enclosing block
+func declarationEndLine(lexemes []Lexeme, i int) int {
+	depth := 0
+	line := 0
+	sawBody := false
+
+	for ; i < len(lexemes); i++ {
+		lexeme := lexemes[i]
+
+		switch lexeme.Text {
+		case "(", "[", "{":
+			depth++
+			if lexeme.Text == "{" && depth == 1 {
+				sawBody = true
+			}
+		case ")", "]", "}":
+			depth--
+			if depth < 0 {
+				return line
+			}
+			if lexeme.Text == "}" && depth == 0 && sawBody {
+				return lexeme.Line
+			}
+		case ";", ",":
+			if depth == 0 {
+				return lexeme.Line
+			}
+		}
+
+		line = lexeme.Line
+	}
+
+	return line
+}
+
+// extractWeslImports parses `import a::b::{c, d as e};` statements. Paths
+// starting with `package` or `super` are made absolute so they match the
+// module paths of the other files.
+func extractWeslImports(code, modulePath, packageName string) (DeclaredImports, error) {
+	declaredImports := make(DeclaredImports)
+	lexemes := SignificantLexemes(Lex(code))
+
+	for i := 0; i < len(lexemes); i++ {
+		if lexemes[i].Text != "import" || (i > 0 && !slices.Contains([]string{";", "}"}, lexemes[i-1].Text) && lexemes[i-1].Kind != LexDirective) {
+			continue
+		}
+
+		end, err := parseWeslImportTree(lexemes, i+1, "", declaredImports)
+		if err != nil {
+			return nil, err
+		}
+		if end >= len(lexemes) || lexemes[end].Text != ";" {
+			return nil, fmt.Errorf("expected `;` after import on line %d", lexemes[i].Line)
+		}
+		i = end
+	}
+
+	for name, paths := range declaredImports {
+		for j, path := range paths {
+			declaredImports[name][j] = resolveWeslPath(path, modulePath, packageName)
+		}
+	}
+
+	return declaredImports, nil
+}
+
+func parseWeslImportTree(lexemes []Lexeme, i int, prefix string, declaredImports DeclaredImports) (int, error) {
+	if i >= len(lexemes) || lexemes[i].Kind != LexIdent {
+		return i, fmt.Errorf("expected import path at position %d", lexemePos(lexemes, i))
+	}
+
+	path := prefix + lexemes[i].Text
+	i++
+
+	// a::b::{c, d}
+	if i+2 < len(lexemes) && lexemes[i].Text == ":" && lexemes[i+1].Text == ":" && lexemes[i+2].Text == "{" {
+		i += 3
+		for {
+			var err error
+			i, err = parseWeslImportTree(lexemes, i, path+"::", declaredImports)
+			if err != nil {
+				return i, err
+			}
+
+			if i < len(lexemes) && lexemes[i].Text == "," {
+				i++
+			}
+			if i < len(lexemes) && lexemes[i].Text == "}" {
+				return i + 1, nil
+			}
+			if i >= len(lexemes) {
+				return i, fmt.Errorf("unclosed import list at position %d", lexemePos(lexemes, i))
+			}
+		}
+	}
+
+	usedName := path[strings.LastIndex(path, ":")+1:]
+	if i+1 < len(lexemes) && lexemes[i].Text == "as" {
+		if lexemes[i+1].Kind != LexIdent {
+			return i, fmt.Errorf("expected identifier after `as` at position %d", lexemes[i].Pos)
+		}
+		usedName = lexemes[i+1].Text
+		i += 2
+	}
+
+	declaredImports[usedName] = append(declaredImports[usedName], path)
+	return i, nil
+}
+
+func lexemePos(lexemes []Lexeme, i int) int {
+	if i < len(lexemes) {
+		return lexemes[i].Pos
+	}
+	if len(lexemes) > 0 {
+		return lexemes[len(lexemes)-1].Pos
+	}
+	return 0
+}
+
+func resolveWeslPath(path, modulePath, packageName string) string {
+	parts := strings.Split(path, "::")
+
+	switch parts[0] {
+	case "package":
+		if packageName == "" {
+			return strings.Join(parts[1:], "::")
+		}
+		return packageName + "::" + strings.Join(parts[1:], "::")
+
+	case "super":
+		base := strings.Split(modulePath, "::")
+		for len(parts) > 0 && parts[0] == "super" && len(base) > 0 {
+			base = base[:len(base)-1]
+			parts = parts[1:]
+		}
+		return strings.Join(append(base, parts...), "::")
+	}
+
+	return path
+}
@@ -19,17 +19,65 @@ import (
 	lo "github.com/samber/lo"
 )
 
+// parses a shader source with the front end matching its extension, GLSL
+// modules end up in the same model as WGSL ones
+func ParseSourceFile(config *config.Config, filePath string) WgslFile {
+	if IsGLSLFile(filePath) {
+		return ParseGLSLFile(config, filePath)
+	}
+
+	if IsWESLFile(filePath) {
+		return ParseWESLFile(config, filePath)
+	}
+
+	return ParseWGSLFile(config, filePath)
+}
+
 func ParseWGSLFile(
 	config *config.Config, wgslFilePath string) WgslFile {
-	wgslCodeBytes, err := os.ReadFile(wgslFilePath)
+	normalizedCode := readSourceFile(wgslFilePath)
+
+	lineComments := extractComments(strings.Split(normalizedCode, "\n"))
+	shaderDefs := extractShaderDefsBlocks(normalizedCode)
+
+	return newWgslFile(config, wgslFilePath, normalizedCode, LanguageWGSL, extractWgslItems(normalizedCode, lineComments, shaderDefs))
+}
+
+func extractWgslItems(normalizedCode string, lineComments map[int]string, shaderDefs []ShaderDefBlock) sourceItems {
+	return sourceItems{
+		consts:     extractConsts(normalizedCode, lineComments, shaderDefs),
+		structures: extractStructures(normalizedCode, lineComments, shaderDefs),
+		functions:  extractFunctions(normalizedCode, lineComments, shaderDefs),
+		bindings:   extractBindings(normalizedCode, lineComments, shaderDefs),
+		moduleVars: extractModuleVars(normalizedCode, shaderDefs),
+		shaderDefs: shaderDefs,
+	}
+}
+
+// items extracted by a language front end
+type sourceItems struct {
+	consts     []Const
+	structures []Structure
+	functions  []Function
+	bindings   []Binding
+	moduleVars []ModuleVar
+	shaderDefs []ShaderDefBlock
+}
+
+func readSourceFile(filePath string) string {
+	codeBytes, err := os.ReadFile(filePath)
 	if err != nil {
 		log.Fatal(err)
 	}
-	normalizedCode := strings.ReplaceAll(string(wgslCodeBytes), "\n\r", "\n")
+	return strings.ReplaceAll(string(codeBytes), "\n\r", "\n")
+}
 
-	basename := filepath.Base(wgslFilePath)
-	filename := strings.TrimSuffix(basename, ".wgsl")
-	originalDir := filepath.Dir(wgslFilePath)
+// builds the file model shared by every front end: paths, links, naga_oil
+// imports and the extracted items
+func newWgslFile(config *config.Config, filePath, normalizedCode, language string, items sourceItems) WgslFile {
+	basename := filepath.Base(filePath)
+	filename := pageName(config, filePath)
+	originalDir := filepath.Dir(filePath)
 	dir := utils.DedupPathParts(strings.ReplaceAll(originalDir, "src/", ""))
 
 	innerPath, err := filepath.Rel(config.SourcePath, dir)
@@ -43,44 +91,94 @@ func ParseWGSLFile(
 		log.Fatal(err)
 	}
 
-	lineComments := extractComments(strings.Split(normalizedCode, "\n"))
-	shaderDefs := extractShaderDefsBlocks(normalizedCode)
 	importPath := extractImportPath(normalizedCode)
-	consts := extractConsts(normalizedCode, lineComments, shaderDefs)
-	structures := extractStructures(normalizedCode, lineComments, shaderDefs)
-	functions := extractFunctions(normalizedCode, lineComments, shaderDefs)
-	bindings := extractBindings(normalizedCode, lineComments, shaderDefs)
 	githubLink := GetGithubLink(config, originalDir, basename)
 
+	items.extractDocTags()
+	items.groupVariants(normalizedCode)
+	moduleDoc, moduleDocLine := extractModuleDoc(normalizedCode)
+
 	wgslFile := WgslFile{
 		Version:    config.Version,
 		ImportPath: importPath,
+		Language:   language,
+		IsGLSL:     language == LanguageGLSL,
+		IsWESL:     language == LanguageWESL,
 
-		Consts:           consts,
-		ConstsShaderDefs: anyShaderDefs(consts),
-		NotEmptyConsts:   len(consts) != 0,
+		ModuleDoc:     moduleDoc,
+		ModuleDocLine: moduleDocLine,
 
-		Bindings:           bindings,
-		BindingsShaderDefs: anyShaderDefs(bindings),
-		NotEmptyBindings:   len(bindings) != 0,
+		Consts:           items.consts,
+		ConstsShaderDefs: anyShaderDefs(items.consts),
+		NotEmptyConsts:   len(items.consts) != 0,
+		FlagGroups:       extractFlagGroups(items.consts),
 
-		Functions:         functions,
-		NotEmptyFunctions: len(functions) != 0,
+		Bindings:           items.bindings,
+		BindingsShaderDefs: anyShaderDefs(items.bindings),
+		NotEmptyBindings:   len(items.bindings) != 0,
 
-		Structures:           structures,
-		StructuresShaderDefs: anyShaderDefs(structures),
-		NotEmptyStructures:   len(structures) != 0,
+		ModuleVars:         items.moduleVars,
+		NotEmptyModuleVars: len(items.moduleVars) != 0,
+
+		Functions:         items.functions,
+		NotEmptyFunctions: len(items.functions) != 0,
+
+		Structures:           items.structures,
+		StructuresShaderDefs: anyShaderDefs(items.structures),
+		NotEmptyStructures:   len(items.structures) != 0,
 		DeclaredImports:      declaredImports,
+		ImportLines:          importLines(normalizedCode, declaredImports),
+		Aliases:              extractAliases(normalizedCode),
+		ShaderDefBlocks:      items.shaderDefs,
 
 		Filename:   basename,
+		FilePath:   filePath,
 		WgslPath:   wgslPath,
 		GithubLink: githubLink,
 		Link:       fmt.Sprintf("%s/%s", config.Version, wgslPath),
 	}
+	wgslFile.Notes = extractNotes(normalizedCode, &wgslFile)
 
 	return wgslFile
 }
 
+// pageName is the filename of a source without its extension, or with it
+// when another source of the directory has the same name, like `a.wgsl` next
+// to `a.glsl`, so that both get their own page
+func pageName(config *config.Config, filePath string) string {
+	basename := filepath.Base(filePath)
+	stem := strings.TrimSuffix(basename, filepath.Ext(basename))
+
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == basename || entry.IsDir() || strings.TrimSuffix(name, filepath.Ext(name)) != stem {
+			continue
+		}
+		if isSourceFile(config, name) {
+			return basename
+		}
+	}
+
+	return stem
+}
+
+// reports whether name is a shader source documented with the file filter
+func isSourceFile(config *config.Config, name string) bool {
+	if config.FileFilter == "" {
+		return filepath.Ext(name) == ".wgsl" || IsWESLFile(name) || IsGLSLFile(name)
+	}
+	for _, pattern := range strings.Split(config.FileFilter, ",") {
+		if matched, _ := filepath.Match(strings.TrimSpace(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
 func (wgslFile *WgslFile) ResolveTypeLinks(declaredImportPaths map[string]string) {
 	importsMap := make(map[string]string)
 	structuresList := lo.Map(wgslFile.Structures, func(v Structure, _ int) string {
@@ -107,27 +205,37 @@ func (wgslFile *WgslFile) ResolveTypeLinks(declaredImportPaths map[string]string
 		}
 	}
 
+	specLinks := !wgslFile.IsGLSL
+
 	for i := range wgslFile.Structures {
 		for j := range wgslFile.Structures[i].Fields {
-			wgslFile.Structures[i].Fields[j].TypeInfo.ResolveTypeLink(importsMap, structuresList)
+			wgslFile.Structures[i].Fields[j].TypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
 		}
 	}
 
 	for i := range wgslFile.Consts {
-		wgslFile.Consts[i].TypeInfo.ResolveTypeLink(importsMap, structuresList)
+		wgslFile.Consts[i].TypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
 	}
 
 	for i := range wgslFile.Bindings {
-		wgslFile.Bindings[i].TypeInfo.ResolveTypeLink(importsMap, structuresList)
+		binding := &wgslFile.Bindings[i]
+		binding.TypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
+
+		if binding.BindingType != "" && !wgslFile.IsGLSL {
+			binding.BindingTypeComponents = resolveTypeComponents(binding.BindingType, importsMap, structuresList, specLinks)
+		}
+	}
 
+	for i := range wgslFile.ModuleVars {
+		wgslFile.ModuleVars[i].TypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
 	}
 
 	for i := range wgslFile.Functions {
 		for j := range wgslFile.Functions[i].Params {
-			wgslFile.Functions[i].Params[j].TypeInfo.ResolveTypeLink(importsMap, structuresList)
+			wgslFile.Functions[i].Params[j].TypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
 		}
 
-		wgslFile.Functions[i].ReturnTypeInfo.ResolveTypeLink(importsMap, structuresList)
+		wgslFile.Functions[i].ReturnTypeInfo.resolveTypeLink(importsMap, structuresList, specLinks)
 	}
 }
 
@@ -150,33 +258,63 @@ func (wgslFile *WgslFile) GenerateWgslPage(compiledTemplate *raymond.Template, o
 	}
 }
 
+// extractShaderDefsBlocks lists the `#ifdef`, `#ifndef` and `#if` blocks of a
+// module. `#ifndef X` is recorded as the condition `!X` and `#if` keeps its
+// comparison, e.g. `MAX_LIGHTS > 4`. `#else ifdef Y` closes the current
+// branch and opens a block for `Y` ending at the shared `#endif`.
 func extractShaderDefsBlocks(code string) []ShaderDefBlock {
 	lines := strings.Split(code, "\n")
 	var blocks []ShaderDefBlock
 	var stack []ShaderDefBlock
+	// whether the block on the stack was opened by `#else ifdef`
+	var chained []bool
+
+	pop := func(lineNum int) {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		chained = chained[:len(chained)-1]
+		current.EndifLine = lineNum
+		blocks = append(blocks, current)
+	}
 
 	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive, args := fields[0], strings.Join(fields[1:], " ")
 		lineNum := i + 1
 
-		if strings.HasPrefix(trimmed, "#ifdef") {
+		switch directive {
+		case "#ifdef", "#ifndef", "#if":
 			stack = append(stack, ShaderDefBlock{
-				DefName:   strings.TrimSpace(trimmed[6:]),
+				DefName:   shaderDefCondition(directive, args),
 				IfdefLine: lineNum,
 			})
-		} else if strings.HasPrefix(trimmed, "#else") {
-			if len(stack) > 0 {
-				current := &stack[len(stack)-1]
-				if current.ElseLine == nil {
-					current.ElseLine = &lineNum
-				}
+			chained = append(chained, false)
+
+		case "#else":
+			if len(stack) == 0 {
+				continue
+			}
+			current := &stack[len(stack)-1]
+			if current.ElseLine == nil {
+				current.ElseLine = &lineNum
+			}
+			if len(fields) > 1 {
+				stack = append(stack, ShaderDefBlock{
+					DefName:   shaderDefCondition("#"+fields[1], strings.Join(fields[2:], " ")),
+					IfdefLine: lineNum,
+				})
+				chained = append(chained, true)
+			}
+
+		case "#endif":
+			for len(stack) > 0 && chained[len(chained)-1] {
+				pop(lineNum)
 			}
-		} else if strings.HasPrefix(trimmed, "#endif") {
 			if len(stack) > 0 {
-				current := stack[len(stack)-1]
-				stack = stack[:len(stack)-1]
-				current.EndifLine = lineNum
-				blocks = append(blocks, current)
+				pop(lineNum)
 			}
 		}
 	}
@@ -188,15 +326,26 @@ func extractShaderDefsBlocks(code string) []ShaderDefBlock {
 	return blocks
 }
 
+func shaderDefCondition(directive, args string) string {
+	if directive == "#ifndef" {
+		return "!" + args
+	}
+	return args
+}
+
 func extractConsts(normalizedCode string, lineComments map[int]string, shaderDefs []ShaderDefBlock) []Const {
-	matches := constPattern.FindAllStringSubmatch(normalizedCode, -1)
+	matches := constPattern.FindAllStringSubmatchIndex(normalizedCode, -1)
 	var results []Const
-	for _, match := range matches {
-		name, typ, value := match[1], match[2], match[3]
+	for _, matchIdx := range matches {
+		submatch := func(n int) string {
+			if matchIdx[2*n] == -1 {
+				return ""
+			}
+			return normalizedCode[matchIdx[2*n]:matchIdx[2*n+1]]
+		}
+		name, typ, value := submatch(1), submatch(2), submatch(3)
 
-		// FIXME:
-		// lineNumber := getLineNumber(normalizedCode, match[0])
-		lineNumber := 0
+		lineNumber := getLineNumber(normalizedCode, matchIdx[0])
 		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
 
 		// If type is not provided, infer it based on value
@@ -219,12 +368,41 @@ func extractConsts(normalizedCode string, lineComments map[int]string, shaderDef
 			Value:         value,
 			HasShaderDefs: len(thisShaderDefs) > 0,
 			ShaderDefs:    thisShaderDefs,
+			Comment:       strings.Join(getItemComments(lineNumber, lineComments), "\n"),
 			TypeInfo: TypeInfo{
 				Type: typ,
 			},
 		})
 	}
 
+	for _, match := range overridePattern.FindAllStringSubmatchIndex(normalizedCode, -1) {
+		annotations, _ := parseAttributes(normalizedCode[match[2]:match[3]])
+		lineNumber := getLineNumber(normalizedCode, match[0])
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		var typ, value string
+		if match[6] != -1 {
+			typ = utils.RemovePath(normalizedCode[match[6]:match[7]])
+		}
+		if match[8] != -1 {
+			value = normalizedCode[match[8]:match[9]]
+		}
+
+		results = append(results, Const{
+			LineNumber:    lineNumber,
+			Name:          normalizedCode[match[4]:match[5]],
+			Value:         value,
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			Comment:       strings.Join(getItemComments(lineNumber, lineComments), "\n"),
+			TypeInfo: TypeInfo{
+				Type: typ,
+			},
+			IsOverride:  true,
+			Annotations: annotations,
+		})
+	}
+
 	return results
 }
 
@@ -235,7 +413,8 @@ func extractComments(lines []string) map[int]string {
 
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "// TODO:") {
+		// module documentation, see extractModuleDoc
+		if strings.HasPrefix(trimmed, "// TODO:") || strings.HasPrefix(trimmed, "//!") {
 			continue
 		}
 
@@ -350,28 +529,34 @@ func extractFunctions(normalizedCode string, lineComments map[int]string, shader
 	fullCode := normalizedCode
 
 	matches := functionPattern.FindAllStringSubmatchIndex(fullCode, -1)
+	lexemes := SignificantLexemes(Lex(fullCode))
 
 	for _, matchIdx := range matches {
-		startIdx := matchIdx[0]
+		startIdx := attributesStart(lexemes, matchIdx[0])
 		endIdx := matchIdx[1]
-		signature := strings.TrimSpace(fullCode[startIdx:endIdx])
+		annotations, _ := parseAttributes(fullCode[startIdx:matchIdx[0]])
+		signature := strings.TrimSpace(fullCode[matchIdx[0]:endIdx])
 		// TODO: check all comments
 		signature = regexp.MustCompile(`//.*`).ReplaceAllString(signature, "")
 		signature = strings.TrimSuffix(signature, "{")
 
 		var stageAttr string
-		var workgroupSize []string
-		if stageMatch := shaderStagePattern.FindStringSubmatch(signature); len(stageMatch) > 1 {
-			stageAttr = stageMatch[1]
-
-			if stageAttr == "compute" {
-				workgroupSizeMatch := strings.TrimSpace(workgroupSizePattern.FindStringSubmatch(signature)[1])
-				workgroupSize = lo.Map(strings.Split(workgroupSizeMatch, ","), func(v string, _ int) string {
-					return strings.TrimSpace(v)
-				})
+		var otherAnnotations []Annotation
+		for _, annotation := range annotations {
+			switch annotation.Name {
+			case "vertex", "fragment", "compute":
+				stageAttr = annotation.Name
+			case "workgroup_size":
+			default:
+				otherAnnotations = append(otherAnnotations, annotation)
 			}
 		}
 
+		var workgroupSize []string
+		if stageAttr == "compute" {
+			workgroupSize, _ = annotationArgs(annotations, "workgroup_size")
+		}
+
 		var name, rawParams string
 		var sigMatch []string
 
@@ -390,30 +575,17 @@ func extractFunctions(normalizedCode string, lineComments map[int]string, shader
 		returnType := "void"
 		returnTypeAnnotations := make([]Annotation, 0)
 
-		if rt := regexp.MustCompile(`->(.*)`).FindStringSubmatch(signature); len(rt) > 1 {
-			trimmedRt := strings.TrimSpace(rt[1])
-
-			matches := annotationPattern.FindAllStringSubmatchIndex(trimmedRt, -1)
-
-			for _, match := range matches {
-				returnTypeAnnotations = append(returnTypeAnnotations, Annotation{
-					Name:  trimmedRt[match[2]:match[3]],
-					Value: trimmedRt[match[4]:match[5]],
-				})
-			}
-
-			if len(matches) > 0 {
-				last := matches[len(matches)-1]
-				returnType = strings.TrimSpace(trimmedRt[last[1]:])
-			} else {
-				returnType = trimmedRt
-			}
+		if rt := regexp.MustCompile(`->([\s\S]*)`).FindStringSubmatch(signature); len(rt) > 1 {
+			returnTypeAnnotations, returnType = parseAttributes(rt[1])
 		}
 
 		lineNumber := getLineNumber(fullCode, startIdx)
 		comments := getItemComments(lineNumber, lineComments)
 		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
 
+		bodyEndIdx := findMatchingBrace(fullCode, endIdx-1)
+		body := fullCode[endIdx-1 : bodyEndIdx]
+
 		functions = append(functions, Function{
 			StageAttribute:   stageAttr,
 			WorkgroupSize:    workgroupSize,
@@ -425,10 +597,16 @@ func extractFunctions(normalizedCode string, lineComments map[int]string, shader
 			HasShaderDefs:    len(thisShaderDefs) > 0,
 			ShaderDefs:       thisShaderDefs,
 			Comment:          strings.Join(comments, "\n"),
+			Annotations:      annotations,
+			OtherAnnotations: otherAnnotations,
 			ReturnTypeInfo: TypeInfo{
 				Type:        returnType,
 				Annotations: returnTypeAnnotations,
 			},
+			Body:            body,
+			BodyStartLine:   getLineNumber(fullCode, endIdx-1),
+			BodyStartColumn: getColumnNumber(fullCode, endIdx-1),
+			BodyEndLine:     getLineNumber(fullCode, bodyEndIdx-1),
 		})
 	}
 
@@ -443,23 +621,16 @@ func extractBindings(code string, lineComments map[int]string, shaderDefs []Shad
 		match := code[matchIdx[0]:matchIdx[1]]
 		submatches := bindingPattern.FindStringSubmatch(match)
 
-		groupIndex := submatches[1]
-		bindingIndex := submatches[2]
-		bindingType := submatches[3]
-		name := submatches[4]
-		typeStr := utils.RemovePath(submatches[5])
+		annotations, _ := parseAttributes(submatches[1])
+		if _, ok := annotationValue(annotations, "binding"); !ok {
+			continue
+		}
+
+		bindingType := submatches[2]
+		name := submatches[3]
+		typeStr := utils.RemovePath(submatches[4])
 		lineNumber := getLineNumber(code, matchIdx[0])
 		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
-		annotations := []Annotation{
-			{
-				Name:  "group",
-				Value: groupIndex,
-			},
-			{
-				Name:  "binding",
-				Value: bindingIndex,
-			},
-		}
 
 		bindings = append(bindings, Binding{
 			LineNumber:    lineNumber,
@@ -468,9 +639,10 @@ func extractBindings(code string, lineComments map[int]string, shaderDefs []Shad
 			BindingType:   bindingType,
 			HasShaderDefs: len(thisShaderDefs) > 0,
 			ShaderDefs:    thisShaderDefs,
+			Comment:       strings.Join(getItemComments(lineNumber, lineComments), "\n"),
 			TypeInfo: TypeInfo{
 				Type:         typeStr,
-				FullTypePath: submatches[5],
+				FullTypePath: submatches[4],
 			},
 		})
 	}
@@ -478,6 +650,44 @@ func extractBindings(code string, lineComments map[int]string, shaderDefs []Shad
 	return bindings
 }
 
+func extractModuleVars(code string, shaderDefs []ShaderDefBlock) []ModuleVar {
+	var moduleVars []ModuleVar
+
+	for _, match := range moduleVarPattern.FindAllStringSubmatchIndex(code, -1) {
+		lineNumber := getLineNumber(code, match[0])
+		thisShaderDefs := getShaderDefsByLine(shaderDefs, lineNumber)
+
+		addressSpace := "private"
+		if match[2] != -1 {
+			addressSpace = strings.TrimSpace(code[match[2]:match[3]])
+		}
+		fullTypePath := strings.TrimSpace(code[match[6]:match[7]])
+
+		moduleVars = append(moduleVars, ModuleVar{
+			LineNumber:    lineNumber,
+			Name:          code[match[4]:match[5]],
+			AddressSpace:  addressSpace,
+			HasShaderDefs: len(thisShaderDefs) > 0,
+			ShaderDefs:    thisShaderDefs,
+			TypeInfo: TypeInfo{
+				Type:         utils.RemovePath(fullTypePath),
+				FullTypePath: fullTypePath,
+			},
+		})
+	}
+
+	return moduleVars
+}
+
+// maps the name of every `alias` declaration to the type it stands for
+func extractAliases(normalizedCode string) map[string]string {
+	aliases := make(map[string]string)
+	for _, match := range aliasPattern.FindAllStringSubmatch(normalizedCode, -1) {
+		aliases[match[1]] = match[2]
+	}
+	return aliases
+}
+
 func extractImportPath(normalizedCode string) *string {
 	re := regexp.MustCompile(`#define_import_path\s+(.*)`)
 	match := re.FindStringSubmatch(normalizedCode)
@@ -497,21 +707,8 @@ func parseNamedTypeString(str, fullCode string, shaderDefs []ShaderDefBlock) []N
 	var result []NamedType
 
 	for _, entry := range entries {
-		annotations := make([]Annotation, 0)
-		matches := annotationPattern.FindAllStringSubmatchIndex(entry, -1)
-
-		for _, match := range matches {
-			annotations = append(annotations, Annotation{
-				Name:  entry[match[2]:match[3]],
-				Value: entry[match[4]:match[5]],
-			})
-		}
-
-		param := strings.ReplaceAll(entry, " ", "")
-		if len(matches) > 0 {
-			last := matches[len(matches)-1]
-			param = strings.ReplaceAll(entry[last[1]:], " ", "")
-		}
+		annotations, param := parseAttributes(entry)
+		param = strings.ReplaceAll(param, " ", "")
 
 		splittedParam := strings.Split(param, ":")
 
@@ -565,6 +762,34 @@ func getItemComments(lineNumber int, lineComments map[int]string) []string {
 	return comments
 }
 
+// returns the index just past the brace closing the one at openIdx,
+// skipping braces inside comments
+func findMatchingBrace(code string, openIdx int) int {
+	depth := 0
+
+	for i := openIdx; i < len(code); i++ {
+		switch {
+		case strings.HasPrefix(code[i:], "//"):
+			end := strings.IndexByte(code[i:], '\n')
+			if end == -1 {
+				return len(code)
+			}
+			i += end
+		case strings.HasPrefix(code[i:], "/*"):
+			i = skipBlockComment(code, i) - 1
+		case code[i] == '{':
+			depth++
+		case code[i] == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(code)
+}
+
 func getLineNumber(code string, matchIndex int) int {
 	if matchIndex > len(code) {
 		matchIndex = len(code)
@@ -573,8 +798,19 @@ func getLineNumber(code string, matchIndex int) int {
 	return strings.Count(codeBeforeMatch, "\n") + 1
 }
 
+func getColumnNumber(code string, index int) int {
+	return index - strings.LastIndex(code[:index], "\n")
+}
+
 func (typeInfo *TypeInfo) ResolveTypeLink(imports map[string]string, definedStructuresList []string) {
-	if len(typeInfo.TypeLink) == 0 {
+	typeInfo.resolveTypeLink(imports, definedStructuresList, true)
+}
+
+// specLinks is false for GLSL, whose builtin types only share names with WGSL
+func (typeInfo *TypeInfo) resolveTypeLink(imports map[string]string, definedStructuresList []string, specLinks bool) {
+	typeInfo.resolveComponents(imports, definedStructuresList, specLinks)
+
+	if len(typeInfo.TypeLink) == 0 && specLinks {
 		typeInfo.TypeLink = utils.GetTypeLink(typeInfo.Type)
 	}
 
@@ -586,18 +822,60 @@ func (typeInfo *TypeInfo) ResolveTypeLink(imports map[string]string, definedStru
 		typeInfo.FullTypePath = typeInfo.Type
 	}
 
-	importTarget := strings.Split(typeInfo.FullTypePath, "::")[0]
+	typeInfo.TypeLink, typeInfo.TypeLinkBlank = resolveIdentLink(typeInfo.FullTypePath, typeInfo.Type, imports, definedStructuresList)
+}
 
-	if typeLink, ok := imports[importTarget]; ok {
-		typeInfo.TypeLink = typeLink + "#" + typeInfo.Type
-		typeInfo.TypeLinkBlank = true
+func (typeInfo *TypeInfo) resolveComponents(imports map[string]string, definedStructuresList []string, specLinks bool) {
+	if !strings.ContainsAny(typeInfo.Type, "<[") || len(typeInfo.Components) != 0 {
 		return
 	}
 
-	if slices.Contains(definedStructuresList, typeInfo.Type) {
-		typeInfo.TypeLink = "#" + typeInfo.Type
-		typeInfo.TypeLinkBlank = false
+	typeInfo.Components = resolveTypeComponents(typeInfo.Type, imports, definedStructuresList, specLinks)
+}
+
+// splits a type string into identifiers, numbers and the punctuation between
+// them, linking every identifier that resolves to the spec or to a known
+// structure
+func resolveTypeComponents(typ string, imports map[string]string, definedStructuresList []string, specLinks bool) []TypeComponent {
+	var components []TypeComponent
+
+	for _, match := range typeComponentPattern.FindAllString(typ, -1) {
+		component := TypeComponent{Text: match}
+
+		if lexemes := Lex(match); len(lexemes) == 1 && lexemes[0].Kind == LexNumber {
+			component.Class = "hl-number"
+		}
+
+		if typeIdentPattern.MatchString(match) {
+			component.Class = "hl-type"
+			if specLinks {
+				component.Link = utils.GetTypeComponentLink(match)
+			}
+			if component.Link == "" {
+				component.Link, component.LinkBlank = resolveIdentLink(match, utils.RemovePath(match), imports, definedStructuresList)
+			} else {
+				component.LinkBlank = true
+			}
+		}
+
+		components = append(components, component)
+	}
+
+	return components
+}
+
+func resolveIdentLink(fullPath, name string, imports map[string]string, definedStructuresList []string) (string, bool) {
+	importTarget := strings.Split(fullPath, "::")[0]
+
+	if typeLink, ok := imports[importTarget]; ok {
+		return typeLink + "#" + name, true
 	}
+
+	if slices.Contains(definedStructuresList, name) {
+		return "#" + name, false
+	}
+
+	return "", false
 }
 
 // checks if any item has shader definitions
@@ -1,8 +1,14 @@
 package wgsl
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	config "main/config"
+	utils "main/utils"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,7 +25,7 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 
 	expectedConsts := []Const{
 		{
-			LineNumber: 0,
+			LineNumber: 2,
 			Name:       "COLOR_MATERIAL_FLAGS_TEXTURE_BIT",
 			TypeInfo: TypeInfo{
 				Type:          "u32",
@@ -29,7 +35,7 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 			HasShaderDefs: false,
 		},
 		{
-			LineNumber: 0,
+			LineNumber: 3,
 			Name:       "COLOR_MATERIAL_FLAGS_ALPHA_MODE_RESERVED_BITS",
 			TypeInfo: TypeInfo{
 				Type:          "u32",
@@ -39,7 +45,7 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 			HasShaderDefs: false,
 		},
 		{
-			LineNumber: 0,
+			LineNumber: 4,
 			Name:       "COLOR_MATERIAL_FLAGS_ALPHA_MODE_OPAQUE",
 			TypeInfo: TypeInfo{
 				Type:          "u32",
@@ -49,7 +55,7 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 			HasShaderDefs: false,
 		},
 		{
-			LineNumber: 0,
+			LineNumber: 5,
 			Name:       "COLOR_MATERIAL_FLAGS_ALPHA_MODE_MASK",
 			TypeInfo: TypeInfo{
 				Type:          "u32",
@@ -59,7 +65,7 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 			HasShaderDefs: false,
 		},
 		{
-			LineNumber: 0,
+			LineNumber: 6,
 			Name:       "COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND",
 			TypeInfo: TypeInfo{
 				Type:          "u32",
@@ -75,6 +81,25 @@ const COLOR_MATERIAL_FLAGS_ALPHA_MODE_BLEND: u32         = 2147483648u; // (2u32
 	}
 }
 
+func TestConstLineNumbers(t *testing.T) {
+	code := `#define_import_path my::consts
+
+/// Number of cascades.
+const CASCADES: u32 = 4u;
+#ifdef HIGH_QUALITY
+const SAMPLES = 16;
+#endif
+override scale: f32 = 1.0;
+`
+	shaderDefs := extractShaderDefsBlocks(code)
+	consts := extractConsts(code, extractComments(strings.Split(code, "\n")), shaderDefs)
+
+	assert.Equal(t, []int{4, 6, 8}, []int{consts[0].LineNumber, consts[1].LineNumber, consts[2].LineNumber})
+	// comments and shader defs are looked up by line
+	assert.Equal(t, "Number of cascades.", consts[0].Comment)
+	assert.Equal(t, []DefResult{{DefName: "HIGH_QUALITY", Branch: "if", LineNumber: 5}}, consts[1].ShaderDefs)
+}
+
 func TestStructuresExtraction(t *testing.T) {
 	code := `
 struct BoxShadowVertexOutput {
@@ -94,7 +119,7 @@ struct BoxShadowVertexOutput {
 		Fields: []NamedType{
 			{
 				Annotations: []Annotation{
-					{Name: "builtin", Value: "position"},
+					{Name: "builtin", Value: "position", Args: []string{"position"}},
 				},
 				Name: "position",
 				TypeInfo: TypeInfo{
@@ -109,7 +134,7 @@ struct BoxShadowVertexOutput {
 			},
 			{
 				Annotations: []Annotation{
-					{Name: "location", Value: "0"},
+					{Name: "location", Value: "0", Args: []string{"0"}},
 				},
 				Name: "point",
 				TypeInfo: TypeInfo{
@@ -124,7 +149,7 @@ struct BoxShadowVertexOutput {
 			},
 			{
 				Annotations: []Annotation{
-					{Name: "location", Value: "1"},
+					{Name: "location", Value: "1", Args: []string{"1"}},
 				},
 				Name: "color",
 				TypeInfo: TypeInfo{
@@ -139,8 +164,8 @@ struct BoxShadowVertexOutput {
 			},
 			{
 				Annotations: []Annotation{
-					{Name: "location", Value: "2"},
-					{Name: "interpolate", Value: "flat"},
+					{Name: "location", Value: "2", Args: []string{"2"}},
+					{Name: "interpolate", Value: "flat", Args: []string{"flat"}},
 				},
 				Name: "size",
 				TypeInfo: TypeInfo{
@@ -155,8 +180,8 @@ struct BoxShadowVertexOutput {
 			},
 			{
 				Annotations: []Annotation{
-					{Name: "location", Value: "3"},
-					{Name: "interpolate", Value: "flat"},
+					{Name: "location", Value: "3", Args: []string{"3"}},
+					{Name: "interpolate", Value: "flat", Args: []string{"flat"}},
 				},
 				Name: "radius",
 				TypeInfo: TypeInfo{
@@ -171,8 +196,8 @@ struct BoxShadowVertexOutput {
 			},
 			{
 				Annotations: []Annotation{
-					{Name: "location", Value: "4"},
-					{Name: "interpolate", Value: "flat"},
+					{Name: "location", Value: "4", Args: []string{"4"}},
+					{Name: "interpolate", Value: "flat", Args: []string{"flat"}},
 				},
 				Name: "blur",
 				TypeInfo: TypeInfo{
@@ -210,8 +235,8 @@ func TestBindingExtractions(t *testing.T) {
 			Name:        "exposure",
 			BindingType: "storage, read_write",
 			Annotations: []Annotation{
-				{Name: "group", Value: "0"},
-				{Name: "binding", Value: "7"},
+				{Name: "group", Value: "0", Args: []string{"0"}},
+				{Name: "binding", Value: "7", Args: []string{"7"}},
 			},
 			TypeInfo: TypeInfo{
 				Annotations:   nil,
@@ -228,8 +253,8 @@ func TestBindingExtractions(t *testing.T) {
 			Name:        "material_color",
 			BindingType: "storage",
 			Annotations: []Annotation{
-				{Name: "group", Value: "1"},
-				{Name: "binding", Value: "0"},
+				{Name: "group", Value: "1", Args: []string{"1"}},
+				{Name: "binding", Value: "0", Args: []string{"0"}},
 			},
 			TypeInfo: TypeInfo{
 				Annotations:   nil,
@@ -246,8 +271,8 @@ func TestBindingExtractions(t *testing.T) {
 			Name:        "material_color_texture",
 			BindingType: "",
 			Annotations: []Annotation{
-				{Name: "group", Value: "1"},
-				{Name: "binding", Value: "4"},
+				{Name: "group", Value: "1", Args: []string{"1"}},
+				{Name: "binding", Value: "4", Args: []string{"4"}},
 			},
 			TypeInfo: TypeInfo{
 				Annotations:   nil,
@@ -264,8 +289,8 @@ func TestBindingExtractions(t *testing.T) {
 			Name:        "material_color_sampler",
 			BindingType: "",
 			Annotations: []Annotation{
-				{Name: "group", Value: "1"},
-				{Name: "binding", Value: "2"},
+				{Name: "group", Value: "1", Args: []string{"1"}},
+				{Name: "binding", Value: "2", Args: []string{"2"}},
 			},
 			TypeInfo: TypeInfo{
 				Annotations:   nil,
@@ -282,8 +307,8 @@ func TestBindingExtractions(t *testing.T) {
 			Name:        "material_color",
 			BindingType: "uniform",
 			Annotations: []Annotation{
-				{Name: "group", Value: "2"},
-				{Name: "binding", Value: "3"},
+				{Name: "group", Value: "2", Args: []string{"2"}},
+				{Name: "binding", Value: "3", Args: []string{"3"}},
 			},
 			TypeInfo: TypeInfo{
 				Annotations:   nil,
@@ -385,10 +410,15 @@ fn map_axis_with_repeat(
 				TypeLink:      "",
 				TypeLinkBlank: false,
 			},
-			HasShaderDefs: false,
-			ShaderDefs:    nil,
-			Comment:       "",
-			HasParams:     true,
+			HasShaderDefs:   false,
+			ShaderDefs:      nil,
+			Comment:         "",
+			HasParams:       true,
+			Annotations:     []Annotation{},
+			Body:            "{\n  // stuff\n}",
+			BodyStartLine:   2,
+			BodyStartColumn: 52,
+			BodyEndLine:     4,
 		},
 		{
 			StageAttribute: "vertex",
@@ -397,7 +427,7 @@ fn map_axis_with_repeat(
 			Params: []NamedType{
 				{
 					Annotations: []Annotation{
-						{Name: "location", Value: "0"},
+						{Name: "location", Value: "0", Args: []string{"0"}},
 					},
 					Name: "vertex_position",
 					TypeInfo: TypeInfo{
@@ -418,10 +448,15 @@ fn map_axis_with_repeat(
 				TypeLink:      "",
 				TypeLinkBlank: false,
 			},
-			HasShaderDefs: false,
-			ShaderDefs:    nil,
-			Comment:       "",
-			HasParams:     true,
+			HasShaderDefs:   false,
+			ShaderDefs:      nil,
+			Comment:         "",
+			HasParams:       true,
+			Annotations:     []Annotation{{Name: "vertex"}},
+			Body:            "{\n  // stuff\n}",
+			BodyStartLine:   9,
+			BodyStartColumn: 28,
+			BodyEndLine:     11,
 		},
 		{
 			StageAttribute: "fragment",
@@ -444,17 +479,22 @@ fn map_axis_with_repeat(
 			},
 			ReturnTypeInfo: TypeInfo{
 				Annotations: []Annotation{
-					{Name: "location", Value: "0"},
+					{Name: "location", Value: "0", Args: []string{"0"}},
 				},
 				Type:          "vec4<f32>",
 				FullTypePath:  "",
 				TypeLink:      "",
 				TypeLinkBlank: false,
 			},
-			HasShaderDefs: false,
-			ShaderDefs:    nil,
-			Comment:       "",
-			HasParams:     true,
+			HasShaderDefs:   false,
+			ShaderDefs:      nil,
+			Comment:         "",
+			HasParams:       true,
+			Annotations:     []Annotation{{Name: "fragment"}},
+			Body:            "{\n  // stuff\n}",
+			BodyStartLine:   16,
+			BodyStartColumn: 29,
+			BodyEndLine:     18,
 		},
 		{
 			StageAttribute:   "compute",
@@ -465,7 +505,7 @@ fn map_axis_with_repeat(
 			Params: []NamedType{
 				{
 					Annotations: []Annotation{
-						{Name: "builtin", Value: "num_workgroups"},
+						{Name: "builtin", Value: "num_workgroups", Args: []string{"num_workgroups"}},
 					},
 					Name: "num_workgroups",
 					TypeInfo: TypeInfo{
@@ -480,7 +520,7 @@ fn map_axis_with_repeat(
 				},
 				{
 					Annotations: []Annotation{
-						{Name: "builtin", Value: "workgroup_id"},
+						{Name: "builtin", Value: "workgroup_id", Args: []string{"workgroup_id"}},
 					},
 					Name: "workgroup_id",
 					TypeInfo: TypeInfo{
@@ -495,7 +535,7 @@ fn map_axis_with_repeat(
 				},
 				{
 					Annotations: []Annotation{
-						{Name: "builtin", Value: "local_invocation_index"},
+						{Name: "builtin", Value: "local_invocation_index", Args: []string{"local_invocation_index"}},
 					},
 					Name: "local_invocation_index",
 					TypeInfo: TypeInfo{
@@ -516,10 +556,15 @@ fn map_axis_with_repeat(
 				TypeLink:      "",
 				TypeLinkBlank: false,
 			},
-			HasShaderDefs: false,
-			ShaderDefs:    nil,
-			Comment:       "",
-			HasParams:     true,
+			HasShaderDefs:   false,
+			ShaderDefs:      nil,
+			Comment:         "",
+			HasParams:       true,
+			Annotations:     []Annotation{{Name: "compute"}, {Name: "workgroup_size", Value: "256, 1, 1", Args: []string{"256", "1", "1"}}},
+			Body:            "{\n  // stuff\n}",
+			BodyStartLine:   25,
+			BodyStartColumn: 3,
+			BodyEndLine:     27,
 		},
 		{
 			StageAttribute:   "",
@@ -562,10 +607,15 @@ fn map_axis_with_repeat(
 				TypeLink:      "",
 				TypeLinkBlank: false,
 			},
-			HasShaderDefs: false,
-			ShaderDefs:    nil,
-			Comment:       "",
-			HasParams:     true,
+			HasShaderDefs:   false,
+			ShaderDefs:      nil,
+			Comment:         "",
+			HasParams:       true,
+			Annotations:     []Annotation{},
+			Body:            "{\n  // stuff\n}",
+			BodyStartLine:   34,
+			BodyStartColumn: 10,
+			BodyEndLine:     36,
 		},
 	}
 
@@ -573,3 +623,1576 @@ fn map_axis_with_repeat(
 		assert.Equal(t, expectedFunctions[i], functions[i])
 	}
 }
+
+func TestTypeComponentsResolution(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+
+	typeInfo := TypeInfo{Type: "array<PointLight, 4>"}
+	typeInfo.ResolveTypeLink(map[string]string{}, []string{"PointLight"})
+
+	assert.Equal(t, []TypeComponent{
+		{Text: "array", Link: "https://www.w3.org/TR/WGSL/#array-builtin", LinkBlank: true, Class: "hl-type"},
+		{Text: "<"},
+		{Text: "PointLight", Link: "#PointLight", LinkBlank: false, Class: "hl-type"},
+		{Text: ", "},
+		{Text: "4", Class: "hl-number"},
+		{Text: ">"},
+	}, typeInfo.Components)
+
+	storage := resolveTypeComponents("storage, read_write", map[string]string{}, []string{}, true)
+	assert.Equal(t, "https://www.w3.org/TR/WGSL/#address-spaces-storage", storage[0].Link)
+	assert.Equal(t, "https://www.w3.org/TR/WGSL/#access-read_write", storage[2].Link)
+
+	assert.Equal(t, "https://www.w3.org/TR/WGSL/#sampler-type", utils.GetTypeComponentLink("sampler"))
+}
+
+func parseTestFile(code string, filename string) WgslFile {
+	declaredImports, _ := ExtractAllImports(code)
+	lineComments := extractComments(strings.Split(code, "\n"))
+	shaderDefs := extractShaderDefsBlocks(code)
+
+	return WgslFile{
+		ImportPath:      extractImportPath(code),
+		Filename:        filename,
+		Link:            "0.16.0/" + filename + ".html",
+		DeclaredImports: declaredImports,
+		ImportLines:     importLines(code, declaredImports),
+		Aliases:         extractAliases(code),
+		Consts:          extractConsts(code, lineComments, shaderDefs),
+		Structures:      extractStructures(code, lineComments, shaderDefs),
+		Functions:       extractFunctions(code, lineComments, shaderDefs),
+		Bindings:        extractBindings(code, lineComments, shaderDefs),
+		ModuleVars:      extractModuleVars(code, shaderDefs),
+		ShaderDefBlocks: shaderDefs,
+	}
+}
+
+func TestResourceUsageAnalysis(t *testing.T) {
+	bindings := parseTestFile(`#define_import_path my::bindings
+@group(0) @binding(0) var<uniform> view: View;
+@group(0) @binding(1) var<storage, read_write> counters: array<atomic<u32>>;
+@group(0) @binding(2) var unused_texture: texture_2d<f32>;
+
+fn bump(i: u32) {
+    atomicAdd(&counters[i], 1u);
+}
+`, "bindings")
+
+	root := parseTestFile(`#import my::bindings::{view, bump}
+#import my::bindings
+
+var<private> scratch: f32;
+
+@fragment
+fn fragment(@builtin(position) position: vec4<f32>) -> @location(0) vec4<f32> {
+    let view = 1.0;
+    scratch = view;
+    bindings::bump(0u);
+    return vec4(scratch);
+}
+`, "root")
+
+	registry := NewModuleRegistry([]WgslFile{bindings, root})
+	registry.AnalyzeResourceUsage()
+
+	fragment := registry.Files[1].Functions[0]
+	assert.Equal(t, []ResourceUsage{
+		{
+			Name:         "counters",
+			Kind:         "binding",
+			Module:       "my::bindings",
+			Link:         "/0.16.0/bindings.html#counters",
+			Group:        "0",
+			Binding:      "1",
+			AddressSpace: "storage",
+			Access:       "read_write",
+			File:         registry.Files[0],
+		},
+		{
+			Name:         "scratch",
+			Kind:         "var",
+			Module:       "root",
+			Link:         "/0.16.0/root.html#scratch",
+			AddressSpace: "private",
+			Access:       "read_write",
+			File:         registry.Files[1],
+		},
+	}, fragment.Resources)
+
+	groups := parseTestFile(`@group(10) @binding(0) var<uniform> late: f32;
+@group(2) @binding(0) var<uniform> early: f32;
+
+@fragment
+fn fragment() -> @location(0) vec4<f32> {
+    return vec4(late + early);
+}
+`, "groups")
+
+	registry = NewModuleRegistry([]WgslFile{groups})
+	registry.AnalyzeResourceUsage()
+
+	resources := registry.Files[0].Functions[0].Resources
+	assert.Equal(t, "early", resources[0].Name)
+	assert.Equal(t, "late", resources[1].Name)
+}
+
+func TestShaderDefReachability(t *testing.T) {
+	lighting := parseTestFile(`#define_import_path my::lighting
+
+struct Light {
+    color: vec3<f32>,
+#ifdef SHADOWS
+    shadow_index: u32,
+#endif
+}
+
+fn shade(light: Light) -> vec3<f32> {
+#if MAX_LIGHTS > 4
+    return light.color * 0.5;
+#else ifdef TONEMAP
+    return light.color * 2.0;
+#endif
+    return light.color;
+}
+
+#ifndef SKINNED
+fn unused() {}
+#endif
+`, "lighting")
+
+	root := parseTestFile(`#import my::lighting::{Light, shade}
+
+@fragment
+fn fragment() -> @location(0) vec4<f32> {
+    var light: Light;
+#if MAX_LIGHTS == 8
+    light.color = vec3(1.0);
+#endif
+    return vec4(shade(light), 1.0);
+}
+`, "root")
+
+	elseLine := 13
+	assert.Equal(t, []ShaderDefBlock{
+		{DefName: "SHADOWS", IfdefLine: 5, EndifLine: 7},
+		{DefName: "MAX_LIGHTS > 4", IfdefLine: 11, ElseLine: &elseLine, EndifLine: 15},
+		{DefName: "TONEMAP", IfdefLine: 13, EndifLine: 15},
+		{DefName: "!SKINNED", IfdefLine: 19, EndifLine: 21},
+	}, lighting.ShaderDefBlocks)
+
+	registry := NewModuleRegistry([]WgslFile{lighting, root})
+	registry.AnalyzeShaderDefReachability()
+
+	fragment := registry.Files[1].Functions[0]
+	assert.Equal(t, []RelevantShaderDef{
+		{Name: "MAX_LIGHTS", Values: []string{"4", "8"}, Modules: []string{"my::lighting", "root"}},
+		{Name: "SHADOWS", Modules: []string{"my::lighting"}},
+		{Name: "TONEMAP", Modules: []string{"my::lighting"}},
+	}, fragment.RelevantShaderDefs)
+	assert.Equal(t, uint64(3*2*2), fragment.ShaderVariants)
+	assert.Empty(t, registry.Files[0].Functions[0].RelevantShaderDefs)
+}
+
+func TestTypeUsageIndex(t *testing.T) {
+	types := parseTestFile(`#define_import_path my::types
+
+struct Light {
+    color: vec3<f32>,
+}
+
+struct Lights {
+    items: array<Light, 4>,
+    count: u32,
+}
+`, "types")
+
+	root := parseTestFile(`#import my::types::{Light, Lights}
+
+@group(0) @binding(0) var<uniform> lights: Lights;
+
+fn shade(light: Light) -> Light {
+    return light;
+}
+`, "root")
+
+	registry := NewModuleRegistry([]WgslFile{types, root})
+	for _, file := range registry.Files {
+		file.ResolveTypeLinks(map[string]string{"my::types": "/0.16.0/types.html"})
+	}
+	index := registry.IndexTypeUsage()
+
+	light := StructureRef{Name: "Light", Module: "my::types", Link: "/0.16.0/types.html#Light"}
+	assert.Equal(t, []StructureUsage{
+		{
+			StructureRef: light,
+			UsedIn: []TypeUsage{
+				{Kind: "field", Item: "Lights.items", Module: "my::types", Link: "/0.16.0/types.html#Lights", Type: "array<Light,4>"},
+				{Kind: "param", Item: "shade(light)", Module: "root", Link: "/0.16.0/root.html#shade", Type: "Light"},
+				{Kind: "return", Item: "shade", Module: "root", Link: "/0.16.0/root.html#shade", Type: "Light"},
+			},
+		},
+		{
+			StructureRef: StructureRef{Name: "Lights", Module: "my::types", Link: "/0.16.0/types.html#Lights"},
+			Contains:     []StructureRef{light},
+			UsedIn: []TypeUsage{
+				{Kind: "binding", Item: "lights", Module: "root", Link: "/0.16.0/root.html#lights", Type: "Lights"},
+			},
+		},
+	}, index)
+	assert.True(t, registry.Files[0].Structures[0].HasUsages)
+}
+
+func TestSignatureSearch(t *testing.T) {
+	index := []SignatureEntry{
+		{Name: "dot_light", Params: []string{"vec3<f32>", "vec3<f32>"}, ReturnType: "f32"},
+		{Name: "attenuate", Params: []string{"f32", "vec3<f32>", "u32"}, ReturnType: "f32"},
+		{Name: "to_srgb", Params: []string{"vec3<f32>"}, ReturnType: "vec3<f32>"},
+		{Name: "load", Params: []string{"ptr<function, array<f32, 4>>"}, ReturnType: "void"},
+	}
+
+	names := func(query string) []string {
+		var result []string
+		for _, match := range SearchSignatures(index, ParseSignatureQuery(query)) {
+			result = append(result, match.Name)
+		}
+		return result
+	}
+
+	assert.Equal(t, SignatureQuery{Params: []string{"vec3<f32>", "mat4x4<f32>"}, ReturnType: "f32"}, ParseSignatureQuery("vec3f, mat4x4< f32 > -> f32"))
+	assert.Equal(t, []string{"dot_light"}, names("vec3<f32>, vec3<f32> -> f32"))
+	// partial and unordered
+	assert.Equal(t, []string{"attenuate"}, names("vec3f, f32 ->"))
+	assert.Equal(t, []string{"to_srgb", "dot_light", "attenuate"}, names("vec3"))
+	// type variables bind once
+	assert.Equal(t, []string{"to_srgb", "attenuate"}, names("T -> T"))
+	assert.Equal(t, []string{"load"}, names("ptr<_, array<f32, 4>>"))
+
+	assert.Equal(t, "vec3<f32>", NormalizeSignatureType("vec3", true))
+	assert.Equal(t, "mat4x4<f32>", NormalizeSignatureType("mat4", true))
+	assert.Equal(t, "View", NormalizeSignatureType("bevy_render::view::View", false))
+
+	// the penalty of deprecated functions is exported with the index
+	file := parseTestFile(`fn old_srgb(c: vec3<f32>) -> vec3<f32> {
+    return c;
+}
+
+fn srgb(c: vec3<f32>, gamma: f32) -> vec3<f32> {
+    return c;
+}
+`, "color")
+	file.Functions[0].Tags.Deprecated = true
+	entries := NewModuleRegistry([]WgslFile{file}).SignatureIndex()
+	assert.Equal(t, []int{deprecatedPenalty, 0}, []int{entries[0].RankPenalty, entries[1].RankPenalty})
+
+	matches := SearchSignatures(entries, ParseSignatureQuery("vec3f -> vec3f"))
+	assert.Equal(t, []string{"srgb", "old_srgb"}, []string{matches[0].Name, matches[1].Name})
+	assert.Equal(t, deprecatedPenalty, matches[1].Penalty)
+
+	// project aliases are expanded, locally and through imports
+	types := parseTestFile(`#define_import_path my::types
+alias Color = vec4f;
+alias Palette = array<Color, 4>;
+`, "types")
+	palette := parseTestFile(`#import my::types::{Color, Palette}
+#import my::types
+alias Weight = f32;
+
+fn pick(palette: Palette, w: Weight) -> types::Color {
+    return palette[0];
+}
+`, "palette")
+	entries = NewModuleRegistry([]WgslFile{types, palette}).SignatureIndex()
+	assert.Equal(t, []string{"array<vec4<f32>, 4>", "f32"}, entries[0].Params)
+	assert.Equal(t, "vec4<f32>", entries[0].ReturnType)
+	index = entries
+	assert.Equal(t, []string{"pick"}, names("array<vec4f, 4>, f32 -> vec4f"))
+}
+
+func TestComplexityMetrics(t *testing.T) {
+	file := parseTestFile(`@group(0) @binding(0) var t: texture_2d<f32>;
+@group(0) @binding(1) var s: sampler;
+
+fn sample(uv: vec2<f32>) -> vec4<f32> {
+    return textureSample(t, s, uv);
+}
+
+fn blur(uv: vec2<f32>) -> vec4<f32> {
+    var sum = vec4(0.0);
+    for (var i = 0; i < 4; i++) {
+        if (i == 2 && uv.x > 0.5) {
+            continue;
+        }
+        // one tap
+        sum += sample(uv + fwidth(uv) * f32(i));
+    }
+    return sum;
+}
+
+@fragment
+fn fragment(@location(0) uv: vec2<f32>) -> @location(0) vec4<f32> {
+    return blur(uv);
+}
+`, "blur")
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.AnalyzeComplexity()
+
+	assert.Equal(t, FunctionMetrics{Lines: 1, Cyclomatic: 1, TextureSamples: 1}, registry.Files[0].Functions[0].Metrics)
+	assert.Equal(t, FunctionMetrics{
+		Lines:        8,
+		Cyclomatic:   4,
+		Loops:        1,
+		NestingDepth: 2,
+		Derivatives:  1,
+		CallDepth:    1,
+	}, registry.Files[0].Functions[1].Metrics)
+	assert.Equal(t, 2, registry.Files[0].Functions[2].Metrics.CallDepth)
+}
+
+func TestDuplicateDetection(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+
+	a := parseTestFile(`fn octahedral_encode(v: vec3<f32>) -> vec2<f32> {
+    var n = v / (abs(v.x) + abs(v.y) + abs(v.z));
+    let sign = select(vec2(-1.0), vec2(1.0), n.xy >= vec2(0.0));
+    return select(n.xy, (1.0 - abs(n.yx)) * sign, n.z < 0.0);
+}
+
+fn luminance(c: vec3<f32>) -> f32 {
+    return dot(c, vec3<f32>(0.2126, 0.7152, 0.0722));
+}
+`, "a")
+
+	b := parseTestFile(`// copied from a
+fn encode_normal(normal: vec3<f32>) -> vec2<f32> {
+    var n = normal / (abs(normal.x) + abs(normal.y) + abs(normal.z));
+    let s = select(vec2(-1.0), vec2(1.0), n.xy >= vec2(0.0));
+    return select(n.xy, (1.0 - abs(n.yx)) * s, n.z < 0.0);
+}
+
+fn octahedral_encode(v: vec3<f32>) -> vec2<f32> {
+    var n = v / (abs(v.x) + abs(v.y) + abs(v.z));
+    let sign = select(vec2(-1.0), vec2(1.0), n.xy >= vec2(0.0));
+    return select(n.xy, (1.0 - abs(n.yx)) * sign, n.z < 0.0);
+}
+`, "b")
+
+	registry := NewModuleRegistry([]WgslFile{a, b})
+	pairs := registry.FindDuplicates()
+
+	assert.Len(t, pairs, 2)
+	assert.Equal(t, "exact", pairs[0].Kind)
+	assert.Equal(t, "/0.16.0/b.html#octahedral_encode", pairs[0].B.Link)
+	assert.Equal(t, "renamed", pairs[1].Kind)
+	assert.Equal(t, DuplicateFunction{Name: "encode_normal", Module: "b", Link: "/0.16.0/b.html#encode_normal", SourceLink: "#L2"}, pairs[1].B)
+}
+
+func TestUniformityAnalysis(t *testing.T) {
+	file := parseTestFile(`@group(0) @binding(0) var t: texture_2d<f32>;
+@group(0) @binding(1) var s: sampler;
+@group(0) @binding(2) var<uniform> blur: f32;
+
+fn sample(uv: vec2<f32>) -> vec4<f32> {
+    return textureSample(t, s, uv);
+}
+
+fn sample_if(enabled: f32, uv: vec2<f32>) -> vec4<f32> {
+    if (enabled > 0.0) {
+        return sample(uv);
+    }
+    return vec4(0.0);
+}
+
+@fragment
+fn fragment(@location(0) uv: vec2<f32>) -> @location(0) vec4<f32> {
+    var color = sample_if(blur, uv);
+    for (var i = 0; f32(i) < uv.x * 4.0; i++) {
+        color += vec4(0.1);
+    }
+    color += sample(uv);
+#ifdef EDGES
+    if (uv.y > 0.5) {
+        color += vec4(fwidth(uv), 0.0, 0.0);
+    }
+#endif
+    color += sample_if(uv.x, uv);
+    if (color.a < 0.1) {
+        return color;
+    }
+    return color + sample(uv);
+}
+`, "uniformity")
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.AnalyzeUniformity()
+
+	functions := registry.Files[0].Functions
+	assert.Empty(t, functions[0].Diagnostics)
+	assert.Empty(t, functions[1].Diagnostics, "branching on a parameter moves the requirement to the callers")
+
+	diagnostics := functions[2].Diagnostics
+	assert.True(t, functions[2].HasDiagnostics)
+	assert.Len(t, diagnostics, 3)
+
+	assert.Equal(t, "uniformity", diagnostics[0].Code)
+	assert.Equal(t, SeverityWarning, diagnostics[0].Severity)
+	assert.Equal(t, "fragment", diagnostics[0].Item)
+	assert.Equal(t, "`fwidth` requires uniform control flow, but control flow depends on `uv` (fragment input)", diagnostics[0].Message)
+	assert.Equal(t, Span{Line: 25, Column: 23, EndLine: 25, EndColumn: 33}, diagnostics[0].Span)
+	assert.Equal(t, []DefResult{{DefName: "EDGES", Branch: "if", LineNumber: 23}}, diagnostics[0].ShaderDefs)
+
+	assert.Equal(t, "argument 1 of `sample_if` must be uniform, `sample` depends on it, but the argument depends on `uv` (fragment input)", diagnostics[1].Message)
+	assert.Equal(t, 28, diagnostics[1].Span.Line)
+	assert.Empty(t, diagnostics[1].ShaderDefs)
+
+	assert.Equal(t, "`sample` requires uniform control flow, it calls `textureSample`, but control flow depends on `uv` (fragment input)", diagnostics[2].Message)
+	assert.Equal(t, 32, diagnostics[2].Span.Line)
+
+	assert.Equal(t, diagnostics, registry.Diagnostics.All())
+}
+
+func TestUniformityShaderDefBranches(t *testing.T) {
+	file := parseTestFile(`@group(0) @binding(0) var t: texture_2d<f32>;
+@group(0) @binding(1) var s: sampler;
+
+@fragment
+fn fragment(@location(0) uv: vec2<f32>) -> @location(0) vec4<f32> {
+#ifdef CLIP
+    if (uv.x < 0.0) {
+        return vec4(0.0);
+    }
+#else
+    let d = fwidth(uv);
+#endif
+#ifdef MASKED
+    if (uv.y > 0.5) {
+#else
+    {
+#endif
+        let c = textureSample(t, s, uv);
+    }
+    return textureSample(t, s, uv);
+}
+`, "branches")
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.AnalyzeUniformity()
+
+	// the return of the CLIP arm does not taint `fwidth` in the #else arm,
+	// only the lines after the branches, and the braces of each arm match
+	diagnostics := registry.Files[0].Functions[0].Diagnostics
+	assert.Len(t, diagnostics, 2)
+	assert.Equal(t, "`textureSample` requires uniform control flow, but control flow depends on `uv` (fragment input)", diagnostics[0].Message)
+	assert.Equal(t, Span{Line: 18, Column: 17, EndLine: 18, EndColumn: 40}, diagnostics[0].Span)
+	assert.Equal(t, Span{Line: 20, Column: 12, EndLine: 20, EndColumn: 35}, diagnostics[1].Span)
+}
+
+func TestBodyHighlighting(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+
+	code := `#ifdef MOTION
+fn blur(uv: vec2<f32>) -> f32 {
+    // a < b
+    let x = 1.5;
+#ifdef WIDE
+    return fwidth(uv).x * x;
+#endif
+    return x;
+}
+#endif
+`
+	shaderDefs := extractShaderDefsBlocks(code)
+	fn := extractFunctions(code, map[int]string{}, shaderDefs)[0]
+	lines := highlightLines(fn.Body, fn.BodyStartLine, shaderDefs, nil)
+
+	assert.Equal(t, []SourceLine{
+		{Number: 2, Html: "{"},
+		{Number: 3, Html: `    <span class="hl-comment">// a &lt; b</span>`},
+		{Number: 4, Html: `    <span class="hl-keyword">let</span> x = <span class="hl-number">1.5</span>;`},
+		{Number: 5, Html: `<span class="hl-directive">#ifdef WIDE</span>`, IsDirective: true},
+		{
+			Number:        6,
+			Html:          `    <span class="hl-keyword">return</span> <span class="hl-function">fwidth</span>(uv).x * x;`,
+			ShaderDefs:    []DefResult{{DefName: "WIDE", Branch: "if", LineNumber: 5}},
+			HasShaderDefs: true,
+		},
+		{Number: 7, Html: `<span class="hl-directive">#endif</span>`, IsDirective: true},
+		{Number: 8, Html: `    <span class="hl-keyword">return</span> x;`},
+		{Number: 9, Html: "}"},
+	}, lines)
+}
+
+func TestSourceHighlighting(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+
+	types := parseTestFile(`#define_import_path my::types
+
+struct Mesh {
+    model: mat4x4<f32>,
+}
+`, "types")
+
+	root := parseTestFile(`#import my::types::Mesh
+
+/// Example:
+/// `+"```wgsl"+`
+/// let l = lighting(mesh);
+/// `+"```"+`
+@must_use
+fn shade(mesh: Mesh) -> f32 {
+    let lighting = 2.0;
+    return lighting * fade(mesh.model[0].x);
+}
+
+fn lighting(mesh: Mesh) -> f32 {
+    return 1.0;
+}
+
+fn fade(x: f32) -> f32 {
+    return x;
+}
+`, "root")
+
+	registry := NewModuleRegistry([]WgslFile{types, root})
+	registry.HighlightSources()
+	shade := registry.Files[1].Functions[0]
+
+	header := highlightCode("@must_use\nfn shade(mesh: Mesh) -> f32", registry.codeLinker(registry.Files[1]))
+	assert.Equal(t, `<span class="hl-attribute">@</span><a class="hl-attribute" href="https://www.w3.org/TR/WGSL/#must_use-attr" target="_blank" rel="noopener noreferrer">must_use</a>
+<span class="hl-keyword">fn</span> <a class="hl-function" href="/0.16.0/root.html#shade">shade</a>(mesh: <a href="/0.16.0/types.html#Mesh">Mesh</a>) -&gt; <a class="hl-type" href="https://www.w3.org/TR/WGSL/#f32-builtin" target="_blank" rel="noopener noreferrer">f32</a>`, header)
+
+	// the local shadowing `lighting` is not linked, the call of `fade` is
+	assert.Equal(t, `    <span class="hl-keyword">let</span> lighting = <span class="hl-number">2.0</span>;`, shade.BodyLines[1].Html)
+	assert.Equal(t, `    <span class="hl-keyword">return</span> lighting * <a class="hl-function" href="/0.16.0/root.html#fade">fade</a>(mesh.model[<span class="hl-number">0</span>].x);`, shade.BodyLines[2].Html)
+
+	assert.Equal(t, "Example:\n\n"+`<pre class="highlighted-code code-background"><code><span class="hl-keyword">let</span> l = <a class="hl-function" href="/0.16.0/root.html#lighting">lighting</a>(mesh);</code></pre>`+"\n", shade.Comment)
+}
+
+func TestAttributeExtraction(t *testing.T) {
+	code := `@binding(1) @group(0) var<uniform> params: Params;
+
+@id(0) override BLOCK_SIZE: u32 = 64u;
+
+struct Params {
+    @size(16) @align(16) scale: f32,
+}
+
+struct VertexOutput {
+    @builtin(position) @invariant position: vec4<f32>,
+    @location(0) @interpolate(perspective, centroid) uv: vec2<f32>,
+}
+
+@must_use
+fn luminance(c: vec3<f32>) -> f32 {
+    return dot(c, vec3(0.2126, 0.7152, 0.0722));
+}
+
+@fragment
+@diagnostic(off, derivative_uniformity)
+fn fragment(in: VertexOutput) -> @location(0) @blend_src(1) vec4<f32> {
+    return vec4(1.0);
+}
+
+@compute
+@workgroup_size(8, max(1, 2), #{WORKGROUP_DEPTH})
+fn main() {}
+`
+	bindings := extractBindings(code, map[int]string{}, nil)
+	assert.Len(t, bindings, 1)
+	assert.Equal(t, []Annotation{
+		{Name: "binding", Value: "1", Args: []string{"1"}},
+		{Name: "group", Value: "0", Args: []string{"0"}},
+	}, bindings[0].Annotations)
+
+	consts := extractConsts(code, map[int]string{}, nil)
+	assert.Equal(t, []Const{{
+		LineNumber:  3,
+		Name:        "BLOCK_SIZE",
+		TypeInfo:    TypeInfo{Type: "u32"},
+		Value:       "64u",
+		IsOverride:  true,
+		Annotations: []Annotation{{Name: "id", Value: "0", Args: []string{"0"}}},
+	}}, consts)
+
+	structures := extractStructures(code, map[int]string{}, nil)
+	assert.Equal(t, []Annotation{
+		{Name: "size", Value: "16", Args: []string{"16"}},
+		{Name: "align", Value: "16", Args: []string{"16"}},
+	}, structures[0].Fields[0].Annotations)
+	assert.Equal(t, []Annotation{{Name: "builtin", Value: "position", Args: []string{"position"}}, {Name: "invariant"}}, structures[1].Fields[0].Annotations)
+	assert.Equal(t, "position", structures[1].Fields[0].Name)
+	assert.Equal(t, []Annotation{
+		{Name: "location", Value: "0", Args: []string{"0"}},
+		{Name: "interpolate", Value: "perspective, centroid", Args: []string{"perspective", "centroid"}},
+	}, structures[1].Fields[1].Annotations)
+	assert.Equal(t, "vec2<f32>", structures[1].Fields[1].TypeInfo.Type)
+
+	functions := extractFunctions(code, map[int]string{}, nil)
+	assert.Equal(t, []Annotation{{Name: "must_use"}}, functions[0].Annotations)
+	assert.Equal(t, 14, functions[0].LineNumber)
+
+	assert.Equal(t, "fragment", functions[1].StageAttribute)
+	assert.Equal(t, []Annotation{{Name: "diagnostic", Value: "off, derivative_uniformity", Args: []string{"off", "derivative_uniformity"}}}, functions[1].OtherAnnotations)
+	assert.Equal(t, 19, functions[1].LineNumber)
+	assert.Equal(t, []Annotation{
+		{Name: "location", Value: "0", Args: []string{"0"}},
+		{Name: "blend_src", Value: "1", Args: []string{"1"}},
+	}, functions[1].ReturnTypeInfo.Annotations)
+	assert.Equal(t, "vec4<f32>", functions[1].ReturnTypeInfo.Type)
+
+	assert.Equal(t, "compute", functions[2].StageAttribute)
+	assert.Equal(t, []string{"8", "max(1, 2)", "#{WORKGROUP_DEPTH}"}, functions[2].WorkgroupSize)
+}
+
+func TestDocTags(t *testing.T) {
+	tags, comment := parseDocTags("Old lighting model.\n@deprecated use `pbr_lighting` instead\n@since 0.12\n@unstable")
+	assert.Equal(t, DocTags{
+		Deprecated:        true,
+		DeprecationReason: "use `pbr_lighting` instead",
+		Since:             "0.12",
+		Unstable:          true,
+	}, tags)
+	assert.Equal(t, "Old lighting model.", comment)
+
+	lib := parseTestFile(`#define_import_path my::lib
+
+/// Old lighting model.
+/// @deprecated use pbr_lighting instead
+fn old_lighting(x: f32) -> f32 {
+    return x;
+}
+
+/// @internal
+fn pbr_lighting(x: f32) -> f32 {
+    return x * 2.0;
+}
+`, "lib")
+	items := sourceItems{functions: lib.Functions}
+	items.extractDocTags()
+
+	assert.Equal(t, "Old lighting model.", lib.Functions[0].Comment)
+	assert.Equal(t, DocTags{Deprecated: true, DeprecationReason: "use pbr_lighting instead"}, lib.Functions[0].Tags)
+	assert.Equal(t, DocTags{Internal: true}, lib.Functions[1].Tags)
+
+	root := parseTestFile(`#import my::lib::{old_lighting, pbr_lighting}
+
+fn shade(x: f32) -> f32 {
+    let y = pbr_lighting(x);
+    return old_lighting(y);
+}
+`, "root")
+
+	unused := parseTestFile(`#import my::lib::pbr_lighting
+
+#import my::lib::{
+    old_lighting,
+}
+
+fn shade(x: f32) -> f32 {
+    return pbr_lighting(x);
+}
+`, "unused")
+
+	registry := NewModuleRegistry([]WgslFile{lib, root, unused})
+	registry.CheckDeprecatedImports()
+
+	assert.Equal(t, []Diagnostic{{
+		// never used, reported on its import
+		Severity: SeverityWarning,
+		Code:     "deprecated-import",
+		Message:  "imports deprecated `my::lib::old_lighting`: use pbr_lighting instead",
+		Module:   "unused",
+		Item:     "old_lighting",
+		Link:     "/0.16.0/lib.html#old_lighting",
+		Span:     Span{Line: 3, EndLine: 3},
+	}, {
+		Severity: SeverityWarning,
+		Code:     "deprecated-import",
+		Message:  "imports deprecated `my::lib::old_lighting`: use pbr_lighting instead",
+		Module:   "root",
+		Item:     "old_lighting",
+		Link:     "/0.16.0/lib.html#old_lighting",
+		Span:     Span{Line: 5, EndLine: 5},
+	}}, registry.Diagnostics.All())
+}
+
+func TestParamDocs(t *testing.T) {
+	docs, comment := parseParamDocs("Blends two colors.\n@param a first color\n@param b second color,\nweighted by `t`\n\n@returns the blended color\n@param missing nothing")
+	assert.Equal(t, []paramDoc{
+		{name: "a", doc: "first color"},
+		{name: "b", doc: "second color, weighted by `t`"},
+		{name: "", doc: "the blended color"},
+		{name: "missing", doc: "nothing"},
+	}, docs)
+	assert.Equal(t, "Blends two colors.", comment)
+
+	file := parseTestFile(`/// Blends two colors.
+/// @param a first color
+/// @param c unknown
+/// @returns the blended color
+fn blend(a: vec3<f32>, b: vec3<f32>) -> vec3<f32> {
+    return a + b;
+}
+`, "blend")
+	items := sourceItems{functions: file.Functions}
+	items.extractDocTags()
+
+	blend := file.Functions[0]
+	assert.Equal(t, "Blends two colors.", blend.Comment)
+	assert.Equal(t, "first color", blend.Params[0].Doc)
+	assert.Equal(t, "", blend.Params[1].Doc)
+	assert.Equal(t, "the blended color", blend.ReturnTypeInfo.Doc)
+	assert.True(t, blend.HasParamDocs)
+	assert.Equal(t, []string{"c"}, blend.UnknownParamDocs)
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.CheckParamDocs()
+
+	assert.Equal(t, []Diagnostic{{
+		Severity: SeverityWarning,
+		Code:     "unknown-param-doc",
+		Message:  "`@param c` does not name a parameter of `blend`",
+		Module:   "blend",
+		Item:     "blend",
+		Link:     "/0.16.0/blend.html#blend",
+		Span:     Span{Line: 5, EndLine: 5},
+	}}, registry.Diagnostics.All())
+}
+
+func TestVariantGrouping(t *testing.T) {
+	code := `#ifdef MESHLET
+fn shade(x: f32) -> f32 {
+    let y = x * 2.0;
+    return y;
+}
+#else
+fn shade(x: f32) -> f32 {
+    return x;
+}
+#endif
+
+fn other() {}
+
+#ifndef SKINNED
+struct Vertex {
+    position: vec3<f32>,
+}
+#else
+struct Vertex {
+    position: vec3<f32>,
+    joints: vec4<u32>,
+}
+#endif
+`
+	file := parseTestFile(code, "variants")
+	// a later definition is moved next to the first one
+	functions := []Function{file.Functions[0], file.Functions[2], file.Functions[1]}
+	items := sourceItems{functions: functions, structures: file.Structures}
+	items.groupVariants(code)
+
+	var anchors []string
+	for _, fn := range items.functions {
+		anchors = append(anchors, fn.Anchor)
+	}
+	for _, structure := range items.structures {
+		anchors = append(anchors, structure.Anchor)
+	}
+	assert.Equal(t, []string{"shade--MESHLET", "shade--not-MESHLET", "other", "Vertex--not-SKINNED", "Vertex--SKINNED"}, anchors)
+
+	shade := items.functions[0]
+	assert.True(t, shade.IsVariant)
+	assert.Equal(t, "MESHLET", shade.VariantCondition)
+	assert.Equal(t, []ItemVariant{
+		{Anchor: "shade--MESHLET", Condition: "MESHLET", LineNumber: 2},
+		{Anchor: "shade--not-MESHLET", Condition: "!MESHLET", LineNumber: 7},
+	}, shade.Variants)
+	assert.Equal(t, "!MESHLET", items.functions[1].VariantCondition)
+	assert.Nil(t, items.functions[1].Variants)
+	assert.False(t, items.functions[2].IsVariant)
+
+	diffKinds := func(diff VariantDiff) []string {
+		var kinds []string
+		for _, row := range diff.Rows {
+			kinds = append(kinds, row.Kind)
+		}
+		return kinds
+	}
+	assert.Equal(t, []string{"same", "changed", "removed", "same"}, diffKinds(shade.VariantDiffs[0]))
+	assert.Equal(t, 3, shade.VariantDiffs[0].Rows[1].Left.Number)
+	assert.Equal(t, 8, shade.VariantDiffs[0].Rows[1].Right.Number)
+	assert.Nil(t, shade.VariantDiffs[0].Rows[2].Right)
+
+	vertex := items.structures[0]
+	assert.Equal(t, "SKINNED", items.structures[1].VariantCondition)
+	assert.Equal(t, []string{"same", "same", "added", "same"}, diffKinds(vertex.VariantDiffs[0]))
+
+	assert.Equal(t, "Light--x-2", variantAnchor("Light", []DefResult{{DefName: "x == 2", Branch: "if"}}))
+	assert.Equal(t, "!(x == 2)", branchCondition(DefResult{DefName: "x == 2", Branch: "else"}))
+}
+
+func TestDocLinks(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+
+	types := parseTestFile(`#define_import_path my::types
+
+struct Mesh {
+    model: mat4x4<f32>,
+}
+`, "types")
+
+	root := parseTestFile(`#import my::types::Mesh
+
+/// Shades a [`+"`Mesh`"+`] with [`+"`lighting()`"+`], see [`+"`my::types::Mesh`"+`] and [`+"`my::types`"+`].
+/// Uses [`+"`dot`"+`], fixes #123 but not `+"`#45`"+` or [`+"`missing`"+`] or [maybe].
+/// [docs](https://example.com) [`+"`Mesh`"+`]: https://example.com
+/// `+"```wgsl"+`
+/// [`+"`lighting`"+`] #7
+/// `+"```"+`
+fn shade(mesh: Mesh) -> f32 {
+    return lighting();
+}
+
+fn lighting() -> f32 {
+    return 1.0;
+}
+`, "root")
+
+	registry := NewModuleRegistry([]WgslFile{types, root})
+	registry.ResolveDocLinks("https://github.com/bevyengine/bevy")
+
+	assert.Equal(t, strings.Join([]string{
+		"Shades a [`Mesh`](/0.16.0/types.html#Mesh) with [`lighting()`](/0.16.0/root.html#lighting), see [`my::types::Mesh`](/0.16.0/types.html#Mesh) and [`my::types`](/0.16.0/types.html).",
+		"Uses [`dot`](https://www.w3.org/TR/WGSL/#dot-builtin), fixes [#123](https://github.com/bevyengine/bevy/issues/123) but not `#45` or [`missing`] or [maybe].",
+		"[docs](https://example.com) [`Mesh`]: https://example.com",
+		"```wgsl",
+		"[`lighting`] #7",
+		"```",
+	}, "\n"), registry.Files[1].Functions[0].Comment)
+
+	assert.Equal(t, []Diagnostic{{
+		Severity: SeverityWarning,
+		Code:     "unresolved-doc-link",
+		Message:  "doc link [`missing`] does not name an item",
+		Module:   "root",
+		Item:     "shade",
+		Link:     "/0.16.0/root.html#shade",
+		Span:     Span{Line: 9, EndLine: 9},
+	}}, registry.Diagnostics.All())
+
+	assert.Equal(t, "https://github.com/bevyengine/bevy", utils.RepositoryURL("https://github.com/bevyengine/bevy/tree/release-0.15.0/"))
+}
+
+func TestMathDiagnostics(t *testing.T) {
+	file := parseTestFile(`/// Lambert term $\frac{\rho}{\pi}$, see #12.
+/// Broken $\frac{a}$ formula.
+fn lambert(rho: f32) -> f32 {
+    return rho;
+}
+`, "brdf")
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.CheckMath()
+	registry.ResolveDocLinks("https://github.com/bevyengine/bevy")
+
+	assert.Equal(t, "Lambert term $\\frac{\\rho}{\\pi}$, see [#12](https://github.com/bevyengine/bevy/issues/12).\nBroken $\\frac{a}$ formula.", registry.Files[0].Functions[0].Comment)
+	assert.Equal(t, []Diagnostic{{
+		Severity: SeverityWarning,
+		Code:     "malformed-math",
+		Message:  "malformed TeX `\\frac{a}`: missing argument",
+		Module:   "brdf",
+		Item:     "lambert",
+		Link:     "/0.16.0/brdf.html#lambert",
+		Span:     Span{Line: 3, EndLine: 3},
+	}}, registry.Diagnostics.All())
+}
+
+func TestCommentMarkupDiagnostics(t *testing.T) {
+	assert.NoError(t, utils.LoadWgslSpec(""))
+	utils.LoadHtmlAllowlist("")
+
+	file := parseTestFile(`/// Uses `+"```wgsl"+`
+/// dot(a, b)
+/// `+"```"+`
+fn shade() -> f32 {
+    return 1.0;
+}
+
+/// <img src="x" onerror="alert(1)"> <script>steal()</script>
+fn lighting() -> f32 {
+    return 1.0;
+}
+`, "root")
+
+	registry := NewModuleRegistry([]WgslFile{file})
+	registry.HighlightSources()
+	registry.CheckCommentMarkup()
+
+	// the highlighted code blocks pass the allowlist
+	assert.Equal(t, []Diagnostic{{
+		Severity: SeverityWarning,
+		Code:     "stripped-markup",
+		Message:  "stripped `onerror` attribute of `<img>`, `<script>` element from the documentation",
+		Module:   "root",
+		Item:     "lighting",
+		Link:     "/0.16.0/root.html#lighting",
+		Span:     Span{Line: 9, EndLine: 9},
+	}}, registry.Diagnostics.All())
+}
+
+func TestModuleDoc(t *testing.T) {
+	doc, line := extractModuleDoc(`// SPDX-License-Identifier: MIT OR Apache-2.0
+// Copyright (c) 2024 Bevy Contributors
+
+#define_import_path bevy_pbr::lighting
+
+/*
+ * # Lighting
+ *
+ * Shades surfaces with the
+ * [` + "`Light`" + `] of the scene.
+ */
+
+#import bevy_pbr::{
+    mesh_types::Mesh,
+}
+
+// TODO: cluster lights
+
+// Computes the light of a fragment.
+fn shade() -> f32 {
+    return 1.0;
+}
+`)
+	assert.Equal(t, "# Lighting\n\nShades surfaces with the\n[`Light`] of the scene.", doc)
+	assert.Equal(t, 6, line)
+	file := WgslFile{ModuleDoc: doc}
+	assert.Equal(t, "Shades surfaces with the [`Light`] of the scene.", file.ModuleSummary())
+
+	code := `#define_import_path my::fog
+//! Distance fog.
+//!
+//! - linear
+//!   falloff
+
+// Fog density.
+fn density() -> f32 {
+    return 1.0;
+}
+`
+	doc, line = extractModuleDoc(code)
+	assert.Equal(t, "Distance fog.\n\n- linear\n  falloff", doc)
+	assert.Equal(t, 2, line)
+
+	// a comment attached to the first item is not the module documentation
+	doc, _ = extractModuleDoc(`#define_import_path my::fog
+// Fog density.
+fn density() -> f32 {
+    return 1.0;
+}
+`)
+	assert.Equal(t, "", doc)
+
+	// `//!` lines are not item comments
+	lineComments := extractComments(strings.Split("//! Module.\nfn f() {}", "\n"))
+	assert.Empty(t, getItemComments(2, lineComments))
+	assert.Equal(t, "Fog density.", extractFunctions(code, extractComments(strings.Split(code, "\n")), nil)[0].Comment)
+}
+
+func TestShaderNotes(t *testing.T) {
+	code := `#define_import_path my::fog
+// TODO: cluster the lights,
+// one draw per cluster
+
+// FIXME(alice): wrong in HDR
+fn fog(x: f32) -> f32 {
+    let d = x * 2.0; // HACK: magic number
+    // keep it positive
+    /* NOTE this is
+       clamped below */
+    return max(d, 0.0);
+}
+
+struct Fog {
+    // TODO: pack
+    density: f32,
+}
+
+// Note that the density is linear.
+const DENSITY: f32 = 1.0;
+`
+	file := parseTestFile(code, "fog")
+	file.GithubLink = "https://github.com/bevyengine/bevy/blob/main/fog.wgsl"
+	notes := extractNotes(code, &file)
+
+	assert.Equal(t, []ShaderNote{
+		{Kind: "TODO", Text: "cluster the lights, one draw per cluster", Module: "my::fog", Filename: "fog", Line: 2, Link: "/0.16.0/fog.html", SourceLink: "https://github.com/bevyengine/bevy/blob/main/fog.wgsl#L2"},
+		{Kind: "FIXME", Text: "wrong in HDR", Module: "my::fog", Filename: "fog", Line: 5, Item: "fog", Link: "/0.16.0/fog.html#fog", SourceLink: "https://github.com/bevyengine/bevy/blob/main/fog.wgsl#L5"},
+		{Kind: "HACK", Text: "magic number", Module: "my::fog", Filename: "fog", Line: 7, Item: "fog", Link: "/0.16.0/fog.html#fog", SourceLink: "https://github.com/bevyengine/bevy/blob/main/fog.wgsl#L7"},
+		{Kind: "NOTE", Text: "this is clamped below", Module: "my::fog", Filename: "fog", Line: 9, Item: "fog", Link: "/0.16.0/fog.html#fog", SourceLink: "https://github.com/bevyengine/bevy/blob/main/fog.wgsl#L9"},
+		{Kind: "TODO", Text: "pack", Module: "my::fog", Filename: "fog", Line: 15, Item: "Fog", Link: "/0.16.0/fog.html#Fog", SourceLink: "https://github.com/bevyengine/bevy/blob/main/fog.wgsl#L15"},
+	}, notes)
+
+	previous := []ShaderNote{
+		{Kind: "TODO", Text: "pack", Module: "my::fog", Item: "Fog", Line: 40},
+		{Kind: "FIXME", Text: "NaN on mobile", Module: "my::fog", Item: "fog"},
+	}
+	diff := DiffNotes(previous, notes)
+	assert.Equal(t, []ShaderNote{previous[1]}, diff.Resolved)
+	assert.Equal(t, []ShaderNote{notes[0], notes[1], notes[2], notes[3]}, diff.Added)
+}
+
+func TestFlagGroups(t *testing.T) {
+	types := parseTestFile(`#define_import_path my::types
+
+struct Mesh {
+    model: mat4x4<f32>,
+    flags: u32,
+}
+
+const MESH_FLAGS_SHADOW_RECEIVER_BIT: u32 = 1u << 29u;
+const MESH_FLAGS_TRANSMITTED_SHADOW_RECEIVER_BIT: u32 = 1u << 30u;
+const MESH_FLAGS_SIGN_DETERMINANT_MODEL_3X3_BIT: u32 = 2147483648u;
+const MESH_FLAGS_NO_FRUSTUM_CULLING_BIT: u32 = 0x10000000u;
+
+const STANDARD_MATERIAL_FLAGS_BASE_COLOR_TEXTURE_BIT: u32 = 1u;
+const STANDARD_MATERIAL_FLAGS_EMISSIVE_TEXTURE_BIT: u32 = 1u << 1u;
+const STANDARD_MATERIAL_FLAGS_UNLIT_BIT: u32 = 1u << 4u;
+const STANDARD_MATERIAL_FLAGS_ALPHA_MODE_SHIFT: u32 = 29u;
+const STANDARD_MATERIAL_FLAGS_ALPHA_MODE_RESERVED_BITS: u32 = 7u << STANDARD_MATERIAL_FLAGS_ALPHA_MODE_SHIFT;
+const STANDARD_MATERIAL_FLAGS_ALPHA_MODE_OPAQUE: u32 = 0u << 29u;
+const STANDARD_MATERIAL_FLAGS_ALPHA_MODE_MASK: u32 = 1u << 29u;
+
+const VIEW_LAYER_OPAQUE: u32 = 0x1u;
+const VIEW_LAYER_ALPHA: u32 = 0x2u;
+const MAX_LIGHTS: u32 = 256u;
+const EPSILON: f32 = 1e-4;
+`, "types")
+	types.FlagGroups = extractFlagGroups(types.Consts)
+
+	material := parseTestFile(`#import my::types::Mesh
+
+struct StandardMaterial {
+    base_color: vec4<f32>,
+    flags: u32,
+    mesh_flags: u32,
+}
+`, "material")
+
+	registry := NewModuleRegistry([]WgslFile{types, material})
+	registry.LinkFlagGroups()
+	groups := registry.Files[0].FlagGroups
+
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, FlagGroup{
+		Name:   "MESH_FLAGS",
+		Anchor: "flags-MESH_FLAGS",
+		Flags: []FlagEntry{
+			{Name: "MESH_FLAGS_SHADOW_RECEIVER_BIT", Value: "1u << 29u", Mask: "0x20000000", Bits: "29"},
+			{Name: "MESH_FLAGS_TRANSMITTED_SHADOW_RECEIVER_BIT", Value: "1u << 30u", Mask: "0x40000000", Bits: "30"},
+			{Name: "MESH_FLAGS_SIGN_DETERMINANT_MODEL_3X3_BIT", Value: "2147483648u", Mask: "0x80000000", Bits: "31"},
+			{Name: "MESH_FLAGS_NO_FRUSTUM_CULLING_BIT", Value: "0x10000000u", Mask: "0x10000000", Bits: "28"},
+		},
+		Mask: "0xF0000000",
+	}, groups[0])
+
+	materialFlags := groups[1]
+	assert.Equal(t, "STANDARD_MATERIAL_FLAGS", materialFlags.Name)
+	assert.Equal(t, 6, len(materialFlags.Flags))
+	assert.Equal(t, []string{"2–3", "5–28"}, materialFlags.Gaps)
+	assert.True(t, materialFlags.HasOverlaps)
+	assert.Equal(t, FlagEntry{
+		Name:     "STANDARD_MATERIAL_FLAGS_ALPHA_MODE_RESERVED_BITS",
+		Value:    "7u << STANDARD_MATERIAL_FLAGS_ALPHA_MODE_SHIFT",
+		Mask:     "0xE0000000",
+		Bits:     "29–31",
+		Overlaps: []string{"STANDARD_MATERIAL_FLAGS_ALPHA_MODE_MASK"},
+	}, materialFlags.Flags[3])
+	assert.Equal(t, FlagEntry{Name: "STANDARD_MATERIAL_FLAGS_ALPHA_MODE_OPAQUE", Value: "0u << 29u", Mask: "0x00000000"}, materialFlags.Flags[4])
+
+	// grouped by the longest prefix shared with a neighbour
+	assert.Equal(t, "VIEW_LAYER", groups[2].Name)
+	assert.Equal(t, 2, len(groups[2].Flags))
+
+	mesh := registry.Files[0].Structures[0]
+	assert.Equal(t, "MESH_FLAGS", mesh.Fields[1].FlagGroupName)
+	assert.Equal(t, "/0.16.0/types.html#flags-MESH_FLAGS", mesh.Fields[1].FlagGroupLink)
+
+	standardMaterial := registry.Files[1].Structures[0]
+	assert.Equal(t, "", standardMaterial.Fields[0].FlagGroupLink)
+	assert.Equal(t, "/0.16.0/types.html#flags-STANDARD_MATERIAL_FLAGS", standardMaterial.Fields[1].FlagGroupLink)
+	assert.Equal(t, "/0.16.0/types.html#flags-MESH_FLAGS", standardMaterial.Fields[2].FlagGroupLink)
+}
+
+func TestPipelineReflection(t *testing.T) {
+	module := parseTestFile(`#define_import_path my::types
+const MAX_LIGHTS: u32 = 4u;
+struct Light {
+    color: vec3<f32>,
+    range: f32,
+    direction: vec3f,
+};
+struct Lights {
+    data: array<Light, MAX_LIGHTS>,
+    count: u32,
+};
+@group(0) @binding(0) var<uniform> lights: Lights;
+@group(0) @binding(1) var output: texture_storage_2d<rgba16float, write>;
+@group(1) @binding(0) var shadow_maps: binding_array<texture_depth_2d, MAX_LIGHTS>;
+@group(1) @binding(1) var shadow_sampler: sampler_comparison;
+
+@compute @workgroup_size(8, 8)
+fn main(@builtin(global_invocation_id) id: vec3<u32>) {
+    let light = lights.data[0];
+    let depth = textureSampleCompareLevel(shadow_maps[0], shadow_sampler, vec2(0.0), 0.0);
+    textureStore(output, id.xy, vec4(light.color * depth, 1.0));
+}
+`, "types")
+
+	registry := NewModuleRegistry([]WgslFile{module})
+	registry.AnalyzeResourceUsage()
+
+	file := registry.Files[0]
+	reflection := registry.PipelineReflection(file, &file.Functions[0])
+
+	assert.Equal(t, &[3]uint32{8, 8, 1}, reflection.WorkgroupSize)
+	assert.Len(t, reflection.BindGroups, 2)
+
+	uniform := reflection.BindGroups[0].Entries[0].Ty
+	assert.Equal(t, "Uniform", uniform.BufferType)
+	// 4 lights of 32 bytes, count padded to the 16 byte uniform struct alignment
+	assert.Equal(t, uint64(144), *uniform.MinBindingSize)
+
+	storage := reflection.BindGroups[0].Entries[1].Ty
+	assert.Equal(t, "StorageTexture", storage.Type)
+	assert.Equal(t, "Rgba16Float", storage.Format)
+	assert.Equal(t, "WriteOnly", storage.Access)
+
+	shadowMaps := reflection.BindGroups[1].Entries[0]
+	assert.Equal(t, "Depth", shadowMaps.Ty.SampleType)
+	assert.Equal(t, uint32(4), *shadowMaps.Count)
+	assert.Equal(t, []string{"COMPUTE"}, shadowMaps.Visibility)
+	assert.Equal(t, "Comparison", reflection.BindGroups[1].Entries[1].Ty.SamplerType)
+
+	// root shaders of different directories sharing a filename
+	first := parseTestFile(`@group(0) @binding(0) var<uniform> tint: vec4<f32>;
+
+@fragment
+fn fragment() -> @location(0) vec4<f32> {
+    return tint;
+}
+`, "prepass")
+	second := parseTestFile(`@group(0) @binding(3) var<uniform> depth_bias: f32;
+
+@fragment
+fn fragment() -> @location(0) vec4<f32> {
+    return vec4(depth_bias);
+}
+`, "prepass")
+
+	registry = NewModuleRegistry([]WgslFile{first, second})
+	registry.AnalyzeResourceUsage()
+
+	file = registry.Files[1]
+	reflection = registry.PipelineReflection(file, &file.Functions[0])
+	assert.Equal(t, "depth_bias", reflection.BindGroups[0].Entries[0].Name)
+	assert.Equal(t, uint32(3), reflection.BindGroups[0].Entries[0].Binding)
+}
+
+func TestRecursiveStructures(t *testing.T) {
+	module := parseTestFile(`#define_import_path my::nodes
+struct Node {
+    value: f32,
+    children: array<Node, 2>,
+};
+struct Leaf {
+    value: f32,
+};
+struct Tree {
+    root: Leaf,
+};
+@group(0) @binding(0) var<uniform> nodes: Node;
+@group(0) @binding(1) var<uniform> tree: Tree;
+`, "nodes")
+
+	registry := NewModuleRegistry([]WgslFile{module})
+	groups := registry.FileBindGroupLayouts(registry.Files[0], nil)
+	assert.Nil(t, groups[0].Entries[0].Ty.MinBindingSize)
+	assert.Equal(t, uint64(16), *groups[0].Entries[1].Ty.MinBindingSize)
+
+	registry.CheckRecursiveStructures()
+	diagnostics := registry.Diagnostics.All()
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "recursive-struct", diagnostics[0].Code)
+	assert.Equal(t, "`Node` contains itself through field `children`", diagnostics[0].Message)
+	assert.Equal(t, Span{Line: 2, EndLine: 2}, diagnostics[0].Span)
+}
+
+func TestRustBindGroupLayoutGeneration(t *testing.T) {
+	module := parseTestFile(`#define_import_path my::material
+@group(2) @binding(0) var<uniform> material: StandardMaterial;
+@group(2) @binding(1) var base_color_texture: texture_2d<f32>;
+@group(2) @binding(2) var base_color_sampler: sampler;
+@group(3) @binding(1) var<storage> instances: array<mat4x4<f32>>;
+`, "material")
+
+	registry := NewModuleRegistry([]WgslFile{module})
+	groups := registry.FileBindGroupLayouts(registry.Files[0], nil)
+	rust, err := GenerateRustBindGroupLayouts("my::material", groups, []string{"fragment"})
+	assert.NoError(t, err)
+
+	assert.Contains(t, rust, "let group_2_layout_entries = BindGroupLayoutEntries::sequential(\n    ShaderStages::FRAGMENT,")
+	assert.Contains(t, rust, "        uniform_buffer::<StandardMaterial>(false),\n")
+	assert.Contains(t, rust, "        texture_2d(TextureSampleType::Float { filterable: true }),\n")
+	assert.Contains(t, rust, "        sampler(SamplerBindingType::Filtering),\n")
+	assert.Contains(t, rust, "let group_3_layout_entries = BindGroupLayoutEntries::with_indices(")
+	assert.Contains(t, rust, "        (1, storage_buffer_read_only_sized(false, None)),\n")
+
+	for typ, expected := range map[string]string{
+		"vec3<f16>":   "",
+		"mat2x2<f16>": "",
+		"atomic":      "",
+		"vec3<u32>":   "UVec3",
+		"f16":         "f16",
+	} {
+		rustType, ok := rustShaderType(typ)
+		assert.Equal(t, expected, rustType, typ)
+		assert.Equal(t, expected != "", ok, typ)
+	}
+
+	external := parseTestFile(`@group(0) @binding(0) var video: texture_external;
+`, "external")
+	registry = NewModuleRegistry([]WgslFile{external})
+	groups = registry.FileBindGroupLayouts(registry.Files[0], nil)
+	_, err = GenerateRustBindGroupLayouts("external", groups, []string{"fragment"})
+	assert.EqualError(t, err, "binding `video` has unsupported type `texture_external`")
+}
+
+func TestGLSLBindingTypes(t *testing.T) {
+	sourcePath := t.TempDir()
+	filePath := filepath.Join(sourcePath, "opaque.frag")
+	err := os.WriteFile(filePath, []byte(`layout(set = 0, binding = 0) uniform texture2D color_texture;
+layout(set = 0, binding = 1) uniform sampler color_sampler;
+layout(set = 0, binding = 2) uniform samplerShadow shadow_sampler;
+layout(set = 0, binding = 3) uniform utexture2DArray ids[4];
+layout(set = 0, binding = 4) uniform texture2DMS msaa_texture;
+layout(rgba16f, set = 0, binding = 5) uniform writeonly image2D output_image;
+layout(set = 0, binding = 6) uniform sampler2D combined;
+`), 0644)
+	assert.NoError(t, err)
+
+	file := ParseSourceFile(&config.Config{SourcePath: sourcePath}, filePath)
+	registry := NewModuleRegistry([]WgslFile{file})
+	groups := registry.FileBindGroupLayouts(registry.Files[0], nil)
+	entries := groups[0].Entries
+
+	yes, no := true, false
+	assert.Equal(t, BindingType{Type: "Texture", SampleType: "Float", Filterable: &yes, ViewDimension: "D2", Multisampled: &no}, entries[0].Ty)
+	assert.Equal(t, BindingType{Type: "Sampler", SamplerType: "Filtering"}, entries[1].Ty)
+	assert.Equal(t, BindingType{Type: "Sampler", SamplerType: "Comparison"}, entries[2].Ty)
+	assert.Equal(t, BindingType{Type: "Texture", SampleType: "Uint", ViewDimension: "D2Array", Multisampled: &no}, entries[3].Ty)
+	assert.Equal(t, uint32(4), *entries[3].Count)
+	assert.Equal(t, BindingType{Type: "Texture", SampleType: "Float", Filterable: &no, ViewDimension: "D2", Multisampled: &yes}, entries[4].Ty)
+	assert.Equal(t, BindingType{Type: "StorageTexture", ViewDimension: "D2", Format: "Rgba16Float", Access: "WriteOnly"}, entries[5].Ty)
+	assert.Equal(t, BindingType{Type: "Unknown"}, entries[6].Ty)
+
+	_, err = GenerateRustBindGroupLayouts("opaque", groups, []string{"fragment"})
+	assert.EqualError(t, err, "binding `combined` has unsupported type `sampler2D`")
+
+	groups[0].Entries = entries[:6]
+	rust, err := GenerateRustBindGroupLayouts("opaque", groups, []string{"fragment"})
+	assert.NoError(t, err)
+	assert.Contains(t, rust, "        texture_2d_array(TextureSampleType::Uint).count(NonZero::<u32>::new(4).unwrap()),\n")
+	assert.Contains(t, rust, "        texture_storage_2d(TextureFormat::Rgba16Float, StorageTextureAccess::WriteOnly),\n")
+}
+
+func TestGLSLExtraction(t *testing.T) {
+	sourcePath := t.TempDir()
+	filePath := filepath.Join(sourcePath, "custom.frag")
+	err := os.WriteFile(filePath, []byte(`#define_import_path my::custom
+const float GAMMA = 2.2;
+
+layout(set = 2, binding = 0) uniform CustomMaterial {
+    vec4 Color;
+#ifdef USE_TINT
+    vec4 Tint;
+#endif
+} material;
+layout(set = 2, binding = 1) uniform texture2D color_texture;
+layout(std430, set = 3, binding = 0) readonly buffer Lights {
+    vec4 positions[];
+};
+
+layout(location = 0) in vec2 v_Uv;
+
+// Converts to linear
+vec3 to_linear(in vec3 color, out float luminance) {
+    return pow(color, vec3(GAMMA));
+}
+
+void main() {
+    o_Target = material.Color;
+}
+
+// Gamma of older displays
+// @deprecated use GAMMA
+const float OLD_GAMMA = 2.4;
+`), 0644)
+	assert.NoError(t, err)
+
+	file := ParseSourceFile(&config.Config{SourcePath: sourcePath, Version: "0.16.0"}, filePath)
+
+	assert.True(t, file.IsGLSL)
+	assert.Equal(t, "custom.html", file.WgslPath)
+	assert.Equal(t, "my::custom", *file.ImportPath)
+
+	assert.Equal(t, "GAMMA", file.Consts[0].Name)
+	assert.Equal(t, "", file.Consts[0].Comment)
+	assert.Equal(t, Const{
+		LineNumber: 28,
+		Name:       "OLD_GAMMA",
+		Value:      "2.4",
+		Comment:    "Gamma of older displays",
+		TypeInfo:   TypeInfo{Type: "float"},
+		Tags:       DocTags{Deprecated: true, DeprecationReason: "use GAMMA"},
+	}, file.Consts[1])
+
+	assert.Equal(t, []Binding{
+		{
+			LineNumber:  4,
+			Name:        "material",
+			Anchor:      "material",
+			BindingType: "uniform",
+			Annotations: []Annotation{{Name: "group", Value: "2", Args: []string{"2"}}, {Name: "binding", Value: "0", Args: []string{"0"}}},
+			Layout:      "set = 2, binding = 0",
+			Qualifier:   "uniform",
+			TypeInfo:    TypeInfo{Type: "CustomMaterial", FullTypePath: "CustomMaterial"},
+		},
+		{
+			LineNumber:  10,
+			Name:        "color_texture",
+			Anchor:      "color_texture",
+			Annotations: []Annotation{{Name: "group", Value: "2", Args: []string{"2"}}, {Name: "binding", Value: "1", Args: []string{"1"}}},
+			Layout:      "set = 2, binding = 1",
+			Qualifier:   "uniform",
+			TypeInfo:    TypeInfo{Type: "texture2D", FullTypePath: "texture2D"},
+		},
+		{
+			LineNumber:  11,
+			Name:        "Lights",
+			Anchor:      "Lights-binding",
+			BindingType: "storage, read",
+			Annotations: []Annotation{{Name: "group", Value: "3", Args: []string{"3"}}, {Name: "binding", Value: "0", Args: []string{"0"}}},
+			Layout:      "std430, set = 3, binding = 0",
+			Qualifier:   "readonly buffer",
+			TypeInfo:    TypeInfo{Type: "Lights", FullTypePath: "Lights"},
+		},
+	}, file.Bindings)
+
+	assert.Equal(t, []string{"CustomMaterial", "Lights"}, []string{file.Structures[0].Name, file.Structures[1].Name})
+	material := file.Structures[0]
+	assert.Equal(t, "Color", material.Fields[0].Name)
+	assert.Equal(t, "Tint", material.Fields[1].Name)
+	assert.Equal(t, "USE_TINT", material.Fields[1].ShaderDefs[0].DefName)
+	assert.False(t, material.Fields[0].HasShaderDefs)
+	assert.Equal(t, "vec4[]", file.Structures[1].Fields[0].TypeInfo.Type)
+
+	assert.Equal(t, "in", file.ModuleVars[0].AddressSpace)
+	assert.Equal(t, "location = 0", file.ModuleVars[0].Layout)
+
+	toLinear := file.Functions[0]
+	assert.Equal(t, "to_linear", toLinear.Name)
+	assert.Equal(t, "Converts to linear", toLinear.Comment)
+	assert.Equal(t, "vec3", toLinear.ReturnTypeInfo.Type)
+	assert.Equal(t, []string{"", "out"}, []string{toLinear.Params[0].Qualifier, toLinear.Params[1].Qualifier})
+	assert.Equal(t, []string{"color", "luminance"}, []string{toLinear.Params[0].Name, toLinear.Params[1].Name})
+
+	main := file.Functions[1]
+	assert.Equal(t, "fragment", main.StageAttribute)
+	assert.Equal(t, "void", main.ReturnTypeInfo.Type)
+
+	// GLSL builtin types are not linked to the WGSL spec
+	file.ResolveTypeLinks(map[string]string{})
+	assert.Equal(t, "", file.Functions[0].ReturnTypeInfo.TypeLink)
+	assert.Equal(t, "#CustomMaterial", file.Bindings[0].TypeInfo.TypeLink)
+
+	// a WGSL module with the same name keeps the extension of both pages
+	assert.NoError(t, os.WriteFile(filepath.Join(sourcePath, "custom.wgsl"), []byte("fn f() {}\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(sourcePath, "custom.spv"), []byte{}, 0644))
+	filter := &config.Config{SourcePath: sourcePath, Version: "0.16.0", FileFilter: "*.wgsl,*.frag"}
+	assert.Equal(t, "custom.frag.html", ParseSourceFile(filter, filePath).WgslPath)
+	assert.Equal(t, "0.16.0/custom.wgsl.html", ParseSourceFile(filter, filepath.Join(sourcePath, "custom.wgsl")).Link)
+	assert.Equal(t, "custom.frag.html", ParseSourceFile(&config.Config{SourcePath: sourcePath}, filePath).WgslPath)
+	assert.Equal(t, "custom.html", ParseSourceFile(&config.Config{SourcePath: sourcePath, FileFilter: "*.frag"}, filePath).WgslPath)
+}
+
+func TestWESLExtraction(t *testing.T) {
+	sourcePath := t.TempDir()
+	packageDir := filepath.Join(sourcePath, "my_lib")
+	assert.NoError(t, os.MkdirAll(filepath.Join(packageDir, "shaders", "lighting"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(packageDir, "wesl.toml"), []byte("edition = \"unstable_2025\"\nroot = \"shaders\"\n"), 0644))
+
+	filePath := filepath.Join(packageDir, "shaders", "lighting", "main.wesl")
+	assert.NoError(t, os.WriteFile(filePath, []byte(`import package::util::{Light, shadow as light_shadow};
+import super::common;
+import bevy_pbr::mesh_functions::{
+    get_world_from_local,
+};
+
+struct Params {
+    color: vec4<f32>,
+    @if(SHADOWS) cascades: u32,
+}
+
+@if(SHADOWS && !MOBILE)
+fn shade(light: Light) -> f32 {
+    return light_shadow(light);
+}
+
+@else
+fn shade(light: Light) -> f32 {
+    return 1.0;
+}
+
+@if(!MOBILE)
+@group(0) @binding(0) var<uniform> params: Params;
+`), 0644))
+
+	file := ParseSourceFile(&config.Config{SourcePath: sourcePath, Version: "0.16.0"}, filePath)
+
+	assert.True(t, file.IsWESL)
+	assert.Equal(t, "my_lib::lighting::main", *file.ImportPath)
+	assert.Equal(t, DeclaredImports{
+		"Light":                {"my_lib::util::Light"},
+		"light_shadow":         {"my_lib::util::shadow"},
+		"common":               {"my_lib::lighting::common"},
+		"get_world_from_local": {"bevy_pbr::mesh_functions::get_world_from_local"},
+	}, file.DeclaredImports)
+
+	params := file.Structures[0]
+	assert.Equal(t, []string{"color", "cascades"}, []string{params.Fields[0].Name, params.Fields[1].Name})
+	assert.False(t, params.Fields[0].HasShaderDefs)
+	assert.Equal(t, []DefResult{{DefName: "SHADOWS", Branch: "if", LineNumber: 8}}, params.Fields[1].ShaderDefs)
+	assert.Empty(t, params.Fields[1].Annotations)
+
+	assert.Equal(t, "shade", file.Functions[0].Name)
+	assert.Equal(t, []DefResult{{DefName: "SHADOWS && !MOBILE", Branch: "if", LineNumber: 11}}, file.Functions[0].ShaderDefs)
+	assert.Equal(t, []DefResult{{DefName: "SHADOWS && !MOBILE", Branch: "else", LineNumber: 16}}, file.Functions[1].ShaderDefs)
+
+	assert.Equal(t, "params", file.Bindings[0].Name)
+	assert.Equal(t, []DefResult{{DefName: "MOBILE", Branch: "else", LineNumber: 21}}, file.Bindings[0].ShaderDefs)
+}
+
+func TestComposer(t *testing.T) {
+	sourcePath := t.TempDir()
+	files := map[string]string{
+		"view.wgsl": `#define_import_path my::view
+
+struct View {
+    exposure: f32,
+};
+
+@group(0) @binding(0) var<uniform> view: View;
+
+fn exposure(view: View) -> f32 {
+    return view.exposure;
+}
+
+fn unused() {}
+`,
+		"lighting.wgsl": `#define_import_path my::lighting
+
+#import my::view::{view, exposure}
+
+fn light(color: vec3<f32>) -> vec3<f32> {
+#ifdef TONEMAP
+    return color * exposure(view);
+#else if MAX_LIGHTS == 4
+    return color * 4.0;
+#else
+    return color;
+#endif
+}
+`,
+		"custom_lighting.wgsl": `#define_import_path my::custom_lighting
+
+#import my::lighting
+
+override fn lighting::light(color: vec3<f32>) -> vec3<f32> {
+    return lighting::light(color) * #{STRENGTH};
+}
+`,
+		"root.wgsl": `#import my::lighting::light
+#import my::custom_lighting
+
+@fragment
+fn fragment(@location(0) color: vec3<f32>) -> @location(0) vec4<f32> {
+    return vec4(light(color), 1.0);
+}
+
+@vertex
+fn vertex() -> @builtin(position) vec4<f32> {
+    return vec4(0.0);
+}
+`,
+	}
+
+	parsed := make([]WgslFile, 0, len(files))
+	for _, name := range []string{"view.wgsl", "lighting.wgsl", "custom_lighting.wgsl", "root.wgsl"} {
+		filePath := filepath.Join(sourcePath, name)
+		assert.NoError(t, os.WriteFile(filePath, []byte(files[name]), 0644))
+		parsed = append(parsed, ParseSourceFile(&config.Config{SourcePath: sourcePath}, filePath))
+	}
+
+	registry := NewModuleRegistry(parsed)
+	root := registry.Files[3]
+
+	assert.Equal(t, "viewX_naga_oil_mod_XNV4TUOTWNFSXOX", MangleName("my::view", "view"))
+
+	composed, err := registry.Compose(root, "fragment", ParseShaderDefs("TONEMAP,STRENGTH=2.0"))
+	assert.NoError(t, err)
+
+	view := MangleName("my::view", "View")
+	viewBinding := MangleName("my::view", "view")
+	exposure := MangleName("my::view", "exposure")
+	light := MangleName("my::lighting", "light")
+	customLight := MangleName("my::custom_lighting", "light")
+
+	assert.Equal(t, `// module my::view
+struct `+view+` {
+    exposure: f32,
+}
+
+@group(0) @binding(0) var<uniform> `+viewBinding+`: `+view+`;
+
+fn `+exposure+`(view: `+view+`) -> f32 {
+    return view.exposure;
+}
+
+// module my::lighting
+fn `+light+`(color: vec3<f32>) -> vec3<f32> {
+    return color * `+exposure+`(`+viewBinding+`);
+}
+
+// module my::custom_lighting
+fn `+customLight+`(color: vec3<f32>) -> vec3<f32> {
+    return `+light+`(color) * 2.0;
+}
+
+// module root.wgsl
+@fragment
+fn fragment(@location(0) color: vec3<f32>) -> @location(0) vec4<f32> {
+    return vec4(`+customLight+`(color), 1.0);
+}
+`, composed.Source)
+
+	assert.Equal(t, SourceMapping{Line: 2, Module: "my::view", File: filepath.Join(sourcePath, "view.wgsl"), SourceLine: 3, Link: "/view.wgsl#L3"}, composed.SourceMap[1])
+	assert.Equal(t, SourceMapping{Line: 14, Module: "my::lighting", File: filepath.Join(sourcePath, "lighting.wgsl"), SourceLine: 7, Link: "/lighting.wgsl#L7"}, composed.SourceMap[13])
+
+	composed, err = registry.Compose(registry.Files[1], "", ParseShaderDefs("MAX_LIGHTS=4"))
+	assert.NoError(t, err)
+	assert.Equal(t, `// module my::lighting
+fn light(color: vec3<f32>) -> vec3<f32> {
+    return color * 4.0;
+}
+`, composed.Source)
+}